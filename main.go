@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 
 	"kcl-lang.io/krm-kcl/pkg/options"
 )
@@ -49,7 +52,45 @@ func main() {
 	//     source: |
 	//       [resource | {if resource.kind == "Deployment": metadata.annotations: {"managed-by" = "krm-kcl"}} for resource in option("resource_list").items]
 	// ```
-	if err := options.NewRunOptions().Run(); err != nil {
+	if len(os.Args) > 1 && os.Args[1] == "lock" {
+		lock(os.Args[2:])
+		return
+	}
+	o := options.NewRunOptions()
+	flag.StringVar(&o.Profile, "profile", "", "the active profile of the KCLRun, which takes precedence over the KCL_PROFILE environment variable and the krm.kcl.dev/profile annotation")
+	flag.BoolVar(&o.Sandbox, "sandbox", false, "run all the KCLRuns in the sandbox mode, which can also be enabled by the KCL_SANDBOX environment variable")
+	flag.DurationVar(&o.Timeout, "timeout", 0, "the default timeout of the KCLRuns, e.g., 1m, which takes precedence over the KCL_TIMEOUT environment variable")
+	flag.IntVar(&o.Retries, "retries", 0, "the max number of retries of a failed remote source fetch with the exponential backoff")
+	flag.BoolVar(&o.Cache, "cache", false, "cache the fetched remote sources in the KCL_CACHE_DIR directory or the user cache directory")
+	flag.StringVar(&o.CacheDir, "cache-dir", "", "the source cache directory, which enables the cache")
+	flag.DurationVar(&o.CacheTTL, "cache-ttl", 0, "the time to live of the cached sources of the mutable refs e.g., the Git branches and the OCI tags, defaults to 1h")
+	flag.BoolVar(&o.Offline, "offline", false, "only use the cached sources and fail when a source is not cached, which enables the cache")
+	flag.StringVar(&o.LockFile, "lock", "", "the lock file written by the lock command, and the sources and the dependencies are verified against it, also KCL_LOCK_FILE")
+	flag.StringVar(&o.PublicKey, "public-key", "", "the public key file to verify the signatures of the OCI and HTTP sources, e.g., cosign.pub, also KCL_PUBLIC_KEY")
+	flag.Parse()
+	// Ctrl-C cancels the KCL runs, e.g., the remote source fetches.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	err := o.RunContext(ctx)
+	stop()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+// lock runs the lock command, e.g., krm-kcl lock [-o krm-kcl.lock] [path]
+func lock(args []string) {
+	o := options.NewLockOptions()
+	fs := flag.NewFlagSet("lock", flag.ExitOnError)
+	fs.StringVar(&o.LockFile, "o", "", "the lock file, which defaults to the krm-kcl.lock file in the package directory")
+	_ = fs.Parse(args)
+	if fs.NArg() > 0 {
+		o.Path = fs.Arg(0)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	err := o.Run(ctx)
+	stop()
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 		os.Exit(1)
 	}
@@ -14,13 +14,83 @@ const (
 	// ParamsKey is the key for the params field in the KCLRun resource, which denotes the top level dynamic arguments.
 	ParamsKey = "params"
 
+	// ParamsFromKey is the key for the params from field in the KCLRun resource, which denotes the ConfigMaps and
+	// Secrets in the input resources providing the params.
+	ParamsFromKey = "paramsFrom"
+
+	// ProfilesKey is the key for the profiles field in the KCLRun resource, which denotes the params overlays
+	// keyed by the profile names.
+	ProfilesKey = "profiles"
+
+	// ParamsMergeKey is the key for the params merge field in the KCLRun resource, which denotes how the params
+	// layers are merged.
+	ParamsMergeKey = "paramsMerge"
+
 	// ConfigKey is the key for the config field in the KCLRun resource, which denotes the KCL CLI running config.
 	ConfigKey = "config"
 
+	// DependenciesKey is the key for the dependencies field in the KCLRun resource, which denotes the external
+	// dependencies for the KCL code.
+	DependenciesKey = "dependencies"
+
 	// MatchConstraintsKey is the key for the match constraints field in the KCLRun resource.
 	MatchConstraintsKey = "matchConstraints"
+
+	// StepsKey is the key for the steps field in the KCLRun resource, which denotes the KCL pipeline steps.
+	StepsKey = "steps"
+
+	// EnforcementActionKey is the key for the enforcement action field in the KCLRun resource.
+	EnforcementActionKey = "enforcementAction"
+
+	// EnvKey is the key for the env field in the KCLRun resource, which denotes the environment variables
+	// exposed to the KCL program.
+	EnvKey = "env"
+
+	// SandboxKey is the key for the sandbox field in the KCLRun resource, which denotes the sandbox mode.
+	SandboxKey = "sandbox"
+
+	// TimeoutKey is the key for the timeout field in the KCLRun resource, which denotes the timeout of the run.
+	TimeoutKey = "timeout"
+)
+
+const (
+	// DenyAction denotes the violations fail the function run. It is the default enforcement action.
+	DenyAction = "deny"
+	// WarnAction denotes the violations are reported as the warning results and the function run succeeds.
+	WarnAction = "warn"
+	// DryRunAction denotes the violations are only recorded as the info results and the function run succeeds.
+	DryRunAction = "dryrun"
+)
+
+const (
+	// ReplaceListMerge denotes the lists in the upper params layer replace the lists in the lower layer.
+	// It is the default list merge strategy.
+	ReplaceListMerge = "replace"
+	// AppendListMerge denotes the lists in the upper params layer are appended to the lists in the lower layer.
+	AppendListMerge = "append"
+	// MergeByKeyListMerge denotes the object items of the lists are merged by the value of the merge key,
+	// and the items with new keys are appended.
+	MergeByKeyListMerge = "mergeByKey"
+	// DefaultListMergeKey is the default merge key of the list items for the mergeByKey strategy.
+	DefaultListMergeKey = "name"
 )
 
+// StepSpec defines a step of the KCL pipeline in a KCLRun, and the output of a step is the input of the next step.
+type StepSpec struct {
+	// Name is the optional name of the step, which is used in the error messages.
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Source is a required field for providing the KCL source of the step.
+	Source string `json:"source" yaml:"source"`
+	// Params are the parameters in key-value pairs format.
+	Params map[string]interface{} `json:"params,omitempty" yaml:"params,omitempty"`
+	// Config is the compile config.
+	Config ConfigSpec `json:"config,omitempty" yaml:"config,omitempty"`
+	// MatchConstraints defines the resource matching rules.
+	MatchConstraints MatchConstraintsSpec `json:"matchConstraints,omitempty" yaml:"matchConstraints,omitempty"`
+	// Dependencies are the external dependencies for the KCL code.
+	Dependencies string `json:"dependencies,omitempty" yaml:"dependencies,omitempty"`
+}
+
 // ConfigSpec defines the compile config.
 type ConfigSpec struct {
 	// Arguments is the list of top level dynamic arguments for the kcl option function, e.g., env="prod"
@@ -48,17 +118,163 @@ type ConfigSpec struct {
 // CredSpec defines authentication credentials for remote locations
 type CredSpec struct {
 	Url      string `json:"url,omitempty" yaml:"url,omitempty"`
-	Username string `json:"username" yaml:"username"`
-	Password string `json:"password" yaml:"password"`
+	Username string `json:"username,omitempty" yaml:"username,omitempty"`
+	Password string `json:"password,omitempty" yaml:"password,omitempty"`
+	// UsernameFrom is the reference to the username, which is resolved at run time.
+	UsernameFrom *ValueSource `json:"usernameFrom,omitempty" yaml:"usernameFrom,omitempty"`
+	// PasswordFrom is the reference to the password, which is resolved at run time.
+	PasswordFrom *ValueSource `json:"passwordFrom,omitempty" yaml:"passwordFrom,omitempty"`
+}
+
+// ValueSource is the reference to a value e.g., a credential, and only one of the fields can be set.
+type ValueSource struct {
+	// Value is the literal value, e.g., the inline credentials of a v1alpha1 KCLRun converted to v1beta1,
+	// and it is rejected in the v1beta1 configs.
+	Value string `json:"value,omitempty" yaml:"value,omitempty"`
+	// Env is the name of the environment variable which holds the value.
+	Env string `json:"env,omitempty" yaml:"env,omitempty"`
+	// File is the path of the file which holds the value, and the trailing newline is trimmed.
+	File string `json:"file,omitempty" yaml:"file,omitempty"`
+	// SecretKeyRef selects a key of a Secret in the input resource list.
+	SecretKeyRef *SecretKeySelector `json:"secretKeyRef,omitempty" yaml:"secretKeyRef,omitempty"`
+	// DockerConfig selects the auth entry of a registry in a Docker config.json file,
+	// and the username or the password of the entry is used.
+	DockerConfig *DockerConfigSelector `json:"dockerConfig,omitempty" yaml:"dockerConfig,omitempty"`
+}
+
+// SecretKeySelector selects a key of a Secret in the input resource list.
+type SecretKeySelector struct {
+	// Name is the name of the Secret.
+	Name string `json:"name" yaml:"name"`
+	// Namespace is the namespace of the Secret, and the Secret in any namespace is matched if it is empty.
+	Namespace string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	// Key is the key in the `data` or `stringData` of the Secret.
+	Key string `json:"key" yaml:"key"`
+}
+
+// DockerConfigSelector selects the auth entry of a registry in a Docker config.json file.
+type DockerConfigSelector struct {
+	// Registry is the registry host of the auth entry, e.g., ghcr.io
+	Registry string `json:"registry" yaml:"registry"`
+	// Path is the path of the Docker config file, and defaults to `$DOCKER_CONFIG/config.json` or `~/.docker/config.json`.
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+}
+
+// ParamsFromSource references a ConfigMap or a Secret in the input resource list which provides the params.
+type ParamsFromSource struct {
+	// Kind is the kind of the resource, the valid values are "ConfigMap" and "Secret".
+	Kind string `json:"kind" yaml:"kind"`
+	// Name is the name of the resource.
+	Name string `json:"name" yaml:"name"`
+	// Namespace is the namespace of the resource, and the resource in any namespace is matched if it is empty.
+	Namespace string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	// Key is the data key whose value is a YAML object of the params. All the data entries are used as the
+	// string params if it is empty.
+	Key string `json:"key,omitempty" yaml:"key,omitempty"`
+}
+
+// EnvVar declares the environment variables exposed to the KCL program as `option("env")`,
+// and only one of the `name` and `prefix` fields can be set.
+type EnvVar struct {
+	// Name is the name of the environment variable, and the process environment variable with the name
+	// is exposed unless the `value` is set.
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Prefix exposes all the process environment variables with the name prefix, e.g., APP_
+	Prefix string `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+	// Value is the explicit value of the environment variable with the name.
+	Value *string `json:"value,omitempty" yaml:"value,omitempty"`
+}
+
+// SandboxSpec defines the sandbox mode which limits what the KCL program can touch. In the sandbox mode,
+// the KCL plugins and the file system writes are blocked, the file reads are restricted to the source
+// directory and the output size is capped.
+type SandboxSpec struct {
+	// Enabled enables the sandbox mode.
+	Enabled bool `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	// MaxOutputSize is the max size of the program output in bytes, and defaults to 10MiB.
+	MaxOutputSize int64 `json:"maxOutputSize,omitempty" yaml:"maxOutputSize,omitempty"`
+}
+
+// ParamsMergeSpec defines how the params layers are merged. The objects are always merged recursively.
+type ParamsMergeSpec struct {
+	// Lists is the merge strategy of the lists, the valid values are "replace", "append" and "mergeByKey",
+	// and defaults to "replace".
+	Lists string `json:"lists,omitempty" yaml:"lists,omitempty"`
+	// Key is the key of the list items for the "mergeByKey" strategy, and defaults to "name".
+	Key string `json:"key,omitempty" yaml:"key,omitempty"`
 }
 
 // MatchConstraintsSpec defines the resource matching rules.
 type MatchConstraintsSpec struct {
+	// ResourceRules is the list of rules to match resources, and a resource is matched when any of the rules matches it.
+	// All resources are matched if the list is empty.
 	ResourceRules []ResourceRule `json:"resourceRules,omitempty" yaml:"resourceRules,omitempty"`
+	// ExcludeResourceRules is the list of rules to exclude resources, and a resource is excluded when any of the rules matches it.
+	ExcludeResourceRules []ResourceRule `json:"excludeResourceRules,omitempty" yaml:"excludeResourceRules,omitempty"`
+	// ObjectSelector selects resources by the labels of the resource.
+	ObjectSelector *LabelSelector `json:"objectSelector,omitempty" yaml:"objectSelector,omitempty"`
+	// NamespaceSelector selects namespaced resources by the labels of the namespace, which is found in the input resources.
+	// Namespace resources are selected by their own labels and the other cluster-scoped resources are always selected.
+	NamespaceSelector *LabelSelector `json:"namespaceSelector,omitempty" yaml:"namespaceSelector,omitempty"`
+	// MatchConditions is the list of CEL conditions, and a resource is matched when all of the conditions are true.
+	MatchConditions []MatchCondition `json:"matchConditions,omitempty" yaml:"matchConditions,omitempty"`
+}
+
+// MatchCondition defines a CEL precondition of the resource.
+type MatchCondition struct {
+	// Name is the identifier of the condition, which is used in the error messages.
+	Name string `json:"name" yaml:"name"`
+	// Expression is the CEL expression which must evaluate to a bool, and the resource is bound to the `object`
+	// variable, e.g., `object.spec.replicas > 1 && has(object.metadata.labels.team)`. The resource is not matched
+	// when the expression evaluates to an error, e.g., accessing a field that does not exist.
+	Expression string `json:"expression" yaml:"expression"`
 }
 
-// ResourceRule defines a rule for matching resources.
+const (
+	// ClusterScope denotes the rule matches cluster-scoped resources only.
+	ClusterScope = "Cluster"
+	// NamespacedScope denotes the rule matches namespaced resources only.
+	NamespacedScope = "Namespaced"
+	// AllScopes denotes the rule matches both cluster-scoped and namespaced resources.
+	AllScopes = "*"
+)
+
+// ResourceRule defines a rule for matching resources. An empty list or a list contains "*" matches all values.
 type ResourceRule struct {
+	// APIGroups is the list of API groups, e.g., "apps". The core API group is denoted as "".
+	APIGroups []string `json:"apiGroups,omitempty" yaml:"apiGroups,omitempty"`
+	// APIVersions is the list of API versions, e.g., "apps/v1". The versions without a group, e.g., "v1",
+	// match the version in the APIGroups, or the core API group if the APIGroups is empty.
 	APIVersions []string `json:"apiVersions,omitempty" yaml:"apiVersions,omitempty"`
-	Kinds       []string `json:"kinds,omitempty" yaml:"kinds,omitempty"`
+	// Kinds is the list of resource kinds, e.g., "Deployment".
+	Kinds []string `json:"kinds,omitempty" yaml:"kinds,omitempty"`
+	// ResourceNames is the list of resource name glob patterns, e.g., "nginx-*".
+	ResourceNames []string `json:"resourceNames,omitempty" yaml:"resourceNames,omitempty"`
+	// Namespaces is the list of namespace glob patterns. It matches the namespace of namespaced resources
+	// and the name of Namespace resources, other cluster-scoped resources are not matched.
+	Namespaces []string `json:"namespaces,omitempty" yaml:"namespaces,omitempty"`
+	// Scope specifies the scope of the rule, the valid values are "Cluster", "Namespaced" and "*".
+	// Defaults to "*".
+	Scope string `json:"scope,omitempty" yaml:"scope,omitempty"`
+}
+
+// LabelSelector is a label query over a set of resources, which has the same semantics as
+// the Kubernetes label selector.
+type LabelSelector struct {
+	// MatchLabels is a map of {key,value} pairs.
+	MatchLabels map[string]string `json:"matchLabels,omitempty" yaml:"matchLabels,omitempty"`
+	// MatchExpressions is a list of label selector requirements. The requirements are ANDed.
+	MatchExpressions []LabelSelectorRequirement `json:"matchExpressions,omitempty" yaml:"matchExpressions,omitempty"`
+}
+
+// LabelSelectorRequirement is a selector that contains values, a key, and an operator that
+// relates the key and values.
+type LabelSelectorRequirement struct {
+	// Key is the label key that the selector applies to.
+	Key string `json:"key" yaml:"key"`
+	// Operator represents a key's relationship to a set of values.
+	// Valid operators are In, NotIn, Exists and DoesNotExist.
+	Operator string `json:"operator" yaml:"operator"`
+	// Values is an array of string values.
+	Values []string `json:"values,omitempty" yaml:"values,omitempty"`
 }
@@ -0,0 +1,250 @@
+package v1beta1
+
+import (
+	"encoding/json"
+
+	"kcl-lang.io/krm-kcl/pkg/api"
+	sigsjson "sigs.k8s.io/json"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const (
+	// KCLRunGroup represents the API group for the KCLRun resource.
+	KCLRunGroup = "krm.kcl.dev"
+
+	// KCLRunVersion represents the API version for the KCLRun resource.
+	KCLRunVersion = "v1beta1"
+
+	// KCLRunAPIVersion is a combination of the API group and version for the KCLRun resource.
+	KCLRunAPIVersion = KCLRunGroup + "/" + KCLRunVersion
+)
+
+// KCLRun is the v1beta1 KCLRun resource, which has the structured source,
+// the credential references and the typed params.
+type KCLRun struct {
+	yaml.ResourceMeta `json:",inline" yaml:",inline"`
+	// Spec is the KCLRun spec.
+	Spec KCLRunSpec `json:"spec,omitempty" yaml:"spec,omitempty"`
+}
+
+// KCLRunSpec defines the KCL program, params and config of the KCLRun.
+type KCLRunSpec struct {
+	// Source is the KCL source, and exactly one of the source fields must be set.
+	// It is mutually exclusive with the `steps` field.
+	Source *SourceSpec `json:"source,omitempty" yaml:"source,omitempty"`
+	// Params are the typed parameters of the KCL program.
+	Params Params `json:"params,omitempty" yaml:"params,omitempty"`
+	// ParamsFrom are the ConfigMaps and Secrets in the input resources which provide the params. They are
+	// deep-merged into the params in order, and the `params` take precedence over them.
+	ParamsFrom []api.ParamsFromSource `json:"paramsFrom,omitempty" yaml:"paramsFrom,omitempty"`
+	// Profiles are the typed params overlays keyed by the profile names, and the overlay of the active profile
+	// is deep-merged onto the params.
+	Profiles map[string]Params `json:"profiles,omitempty" yaml:"profiles,omitempty"`
+	// ParamsMerge defines how the params layers are merged, e.g., the list merge strategy.
+	ParamsMerge api.ParamsMergeSpec `json:"paramsMerge,omitempty" yaml:"paramsMerge,omitempty"`
+	// Config is the compile config.
+	Config api.ConfigSpec `json:"config,omitempty" yaml:"config,omitempty"`
+	// Credentials are the references to the credentials for the remote source locations.
+	Credentials *CredentialsSpec `json:"credentials,omitempty" yaml:"credentials,omitempty"`
+	// HostCredentials are the references to the credentials of the OCI registries and the Git hosts,
+	// and the `url` of each credentials is the host glob pattern, e.g., `ghcr.io` or `*.example.com`.
+	HostCredentials []CredentialsSpec `json:"hostCredentials,omitempty" yaml:"hostCredentials,omitempty"`
+	// MatchConstraints defines the resource matching rules.
+	MatchConstraints api.MatchConstraintsSpec `json:"matchConstraints,omitempty" yaml:"matchConstraints,omitempty"`
+	// Dependencies are the external dependencies for the KCL code.
+	// The format of the `dependencies` field is same as the `[dependencies]` in the `kcl.mod` file
+	Dependencies string `json:"dependencies,omitempty" yaml:"dependencies,omitempty"`
+	// EnforcementAction is the action for the violations, e.g., the assertion failures and the error results.
+	// The valid values are "deny", "warn" and "dryrun", and defaults to "deny".
+	EnforcementAction string `json:"enforcementAction,omitempty" yaml:"enforcementAction,omitempty"`
+	// Env declares the environment variables exposed to the KCL program as `option("env")` and `option("PATH")`,
+	// and nothing is exposed if it is empty unless the annotation `krm.kcl.dev/allow-all-env` is set.
+	Env []api.EnvVar `json:"env,omitempty" yaml:"env,omitempty"`
+	// Sandbox limits what the KCL program can touch, and the sandbox mode can also be enabled globally.
+	Sandbox api.SandboxSpec `json:"sandbox,omitempty" yaml:"sandbox,omitempty"`
+	// Timeout is the timeout of the KCLRun, e.g., "30s", which covers the source fetching, the dependency resolution
+	// and the evaluation. It takes precedence over the global default timeout.
+	Timeout string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	// Steps is the ordered list of the KCL pipeline steps, and the output of a step is the input of the next step.
+	Steps []StepSpec `json:"steps,omitempty" yaml:"steps,omitempty"`
+}
+
+// StepSpec defines a step of the KCL pipeline in a KCLRun.
+type StepSpec struct {
+	// Name is the optional name of the step, which is used in the error messages.
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Source is the KCL source of the step, and exactly one of the source fields must be set.
+	Source SourceSpec `json:"source" yaml:"source"`
+	// Params are the typed parameters of the step.
+	Params Params `json:"params,omitempty" yaml:"params,omitempty"`
+	// Config is the compile config.
+	Config api.ConfigSpec `json:"config,omitempty" yaml:"config,omitempty"`
+	// MatchConstraints defines the resource matching rules.
+	MatchConstraints api.MatchConstraintsSpec `json:"matchConstraints,omitempty" yaml:"matchConstraints,omitempty"`
+	// Dependencies are the external dependencies for the KCL code.
+	Dependencies string `json:"dependencies,omitempty" yaml:"dependencies,omitempty"`
+}
+
+// SourceSpec defines the structured KCL source, and exactly one of the source fields must be set.
+// The source can also be the string shorthand, e.g., oci://ghcr.io/kcl-lang/set-annotation:0.1.1,
+// whose kind is detected from the string in the same way as the v1alpha1 source.
+type SourceSpec struct {
+	// Shorthand is the string shorthand of the source, which is mutually exclusive with the source fields.
+	Shorthand string `json:"-" yaml:"-"`
+	// Inline is the inline KCL code.
+	Inline string `json:"inline,omitempty" yaml:"inline,omitempty"`
+	// Local is the local file or directory.
+	Local *LocalSource `json:"local,omitempty" yaml:"local,omitempty"`
+	// OCI is the OCI artifact.
+	OCI *OCISource `json:"oci,omitempty" yaml:"oci,omitempty"`
+	// Git is the Git repository.
+	Git *GitSource `json:"git,omitempty" yaml:"git,omitempty"`
+	// HTTP is the file or archive at an HTTP or HTTPS URL.
+	HTTP *HTTPSource `json:"http,omitempty" yaml:"http,omitempty"`
+}
+
+// LocalSource defines the local KCL source.
+type LocalSource struct {
+	// Path is the file or directory path, and the relative path is relative to the working directory.
+	Path string `json:"path" yaml:"path"`
+}
+
+// OCISource defines the KCL source of an OCI artifact.
+type OCISource struct {
+	// Ref is the artifact reference without the tag and the digest, e.g., ghcr.io/kcl-lang/set-annotation
+	Ref string `json:"ref" yaml:"ref"`
+	// Tag is the artifact tag, e.g., 0.1.1, and defaults to the latest version.
+	Tag string `json:"tag,omitempty" yaml:"tag,omitempty"`
+	// Digest is the manifest digest which pins the artifact, e.g., sha256:...
+	Digest string `json:"digest,omitempty" yaml:"digest,omitempty"`
+}
+
+// GitSource defines the KCL source of a Git repository.
+type GitSource struct {
+	// Url is the repository URL, e.g., https://github.com/kcl-lang/krm-kcl
+	Url string `json:"url" yaml:"url"`
+	// Ref is the branch, the tag or the commit, and defaults to the default branch.
+	Ref string `json:"ref,omitempty" yaml:"ref,omitempty"`
+	// Path is the directory of the KCL program in the repository, e.g., examples/mutation/set-labels
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+}
+
+// HTTPSource defines the KCL source of a file or an archive at an HTTP or HTTPS URL.
+type HTTPSource struct {
+	// Url is the HTTP or HTTPS URL, e.g., https://raw.githubusercontent.com/kcl-lang/krm-kcl/main/examples/main.k
+	Url string `json:"url" yaml:"url"`
+	// Checksum is the checksum which verifies the downloaded content, e.g., sha256:...
+	Checksum string `json:"checksum,omitempty" yaml:"checksum,omitempty"`
+}
+
+// sourceSpec has the same fields as SourceSpec without the custom marshalers.
+type sourceSpec SourceSpec
+
+// MarshalJSON implements json.Marshaler.
+func (s SourceSpec) MarshalJSON() ([]byte, error) {
+	if s.Shorthand != "" {
+		return json.Marshal(s.Shorthand)
+	}
+	return json.Marshal(sourceSpec(s))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *SourceSpec) UnmarshalJSON(data []byte) error {
+	*s = SourceSpec{}
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, &s.Shorthand)
+	}
+	// The unknown fields are reported by the schema validation.
+	return sigsjson.UnmarshalCaseSensitivePreserveInts(data, (*sourceSpec)(s))
+}
+
+// MarshalYAML implements yaml.Marshaler.
+func (s SourceSpec) MarshalYAML() (interface{}, error) {
+	if s.Shorthand != "" {
+		return s.Shorthand, nil
+	}
+	return sourceSpec(s), nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (s *SourceSpec) UnmarshalYAML(node *yaml.Node) error {
+	*s = SourceSpec{}
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&s.Shorthand)
+	}
+	return node.Decode((*sourceSpec)(s))
+}
+
+// CredentialsSpec defines the references to the authentication credentials for the remote locations.
+type CredentialsSpec struct {
+	// Url is the registry or repository URL which the credentials are used for.
+	Url string `json:"url,omitempty" yaml:"url,omitempty"`
+	// UsernameFrom is the reference to the username.
+	UsernameFrom *api.ValueSource `json:"usernameFrom,omitempty" yaml:"usernameFrom,omitempty"`
+	// PasswordFrom is the reference to the password.
+	PasswordFrom *api.ValueSource `json:"passwordFrom,omitempty" yaml:"passwordFrom,omitempty"`
+}
+
+// Params are the typed parameters of the KCL program keyed by the param names.
+type Params map[string]ParamValue
+
+// ParamValue is a param value which holds any JSON value, e.g., a string, number, bool, list or object.
+type ParamValue struct {
+	// Raw is the JSON encoding of the value.
+	Raw json.RawMessage `json:"-" yaml:"-"`
+}
+
+// NewParamValue returns the param value of the given value.
+func NewParamValue(v interface{}) (ParamValue, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return ParamValue{}, err
+	}
+	return ParamValue{Raw: raw}, nil
+}
+
+// Value decodes the param value into the untyped Go value.
+func (v ParamValue) Value() (interface{}, error) {
+	if len(v.Raw) == 0 {
+		return nil, nil
+	}
+	// Keep the integers as int64 values in the same way as decoding the v1alpha1 params.
+	var value interface{}
+	if err := sigsjson.UnmarshalCaseSensitivePreserveInts(v.Raw, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (v ParamValue) MarshalJSON() ([]byte, error) {
+	if len(v.Raw) == 0 {
+		return []byte("null"), nil
+	}
+	return v.Raw, nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (v *ParamValue) UnmarshalJSON(data []byte) error {
+	v.Raw = append(v.Raw[:0], data...)
+	return nil
+}
+
+// MarshalYAML implements yaml.Marshaler.
+func (v ParamValue) MarshalYAML() (interface{}, error) {
+	return v.Value()
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (v *ParamValue) UnmarshalYAML(node *yaml.Node) error {
+	var value interface{}
+	if err := node.Decode(&value); err != nil {
+		return err
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	v.Raw = raw
+	return nil
+}
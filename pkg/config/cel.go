@@ -0,0 +1,86 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/google/cel-go/cel"
+	"kcl-lang.io/krm-kcl/pkg/api"
+	"kcl-lang.io/krm-kcl/pkg/kube"
+)
+
+// ObjectVariableName is the variable name of the resource in the CEL match conditions.
+const ObjectVariableName = "object"
+
+// MatchConditions is the compiled CEL match conditions.
+type MatchConditions struct {
+	conditions []compiledCondition
+}
+
+type compiledCondition struct {
+	name    string
+	program cel.Program
+}
+
+// CompileMatchConditions compiles the CEL match conditions and returns an error
+// naming the offending condition if any of them can not be compiled.
+func CompileMatchConditions(conditions []api.MatchCondition) (*MatchConditions, error) {
+	env, err := cel.NewEnv(cel.Variable(ObjectVariableName, cel.DynType))
+	if err != nil {
+		return nil, err
+	}
+	result := &MatchConditions{}
+	names := make(map[string]bool)
+	var errs []error
+	for i, c := range conditions {
+		if c.Name == "" {
+			errs = append(errs, fmt.Errorf("matchConditions[%d]: `name` must not be empty", i))
+			continue
+		}
+		if names[c.Name] {
+			errs = append(errs, fmt.Errorf("matchConditions[%d]: duplicate name %q", i, c.Name))
+			continue
+		}
+		names[c.Name] = true
+		ast, issues := env.Compile(c.Expression)
+		if issues != nil && issues.Err() != nil {
+			errs = append(errs, fmt.Errorf("matchConditions[%d] %q: failed to compile the expression: %v", i, c.Name, issues.Err()))
+			continue
+		}
+		if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+			errs = append(errs, fmt.Errorf("matchConditions[%d] %q: the expression must evaluate to bool, but got %v", i, c.Name, ast.OutputType()))
+			continue
+		}
+		program, err := env.Program(ast)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("matchConditions[%d] %q: %v", i, c.Name, err))
+			continue
+		}
+		result.conditions = append(result.conditions, compiledCondition{c.Name, program})
+	}
+	if len(errs) > 0 {
+		return nil, aggregate(errs)
+	}
+	return result, nil
+}
+
+// Match checks if the given Kubernetes object satisfies all of the conditions. The object
+// is not matched when any of the conditions evaluates to an error or a non-bool value.
+func (m *MatchConditions) Match(obj *kube.KubeObject) bool {
+	if m == nil || len(m.conditions) == 0 {
+		return true
+	}
+	object, err := obj.Node().Map()
+	if err != nil {
+		return false
+	}
+	for _, c := range m.conditions {
+		out, _, err := c.program.Eval(map[string]interface{}{ObjectVariableName: object})
+		if err != nil {
+			return false
+		}
+		if v, ok := out.Value().(bool); !ok || !v {
+			return false
+		}
+	}
+	return true
+}
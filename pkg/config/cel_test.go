@@ -0,0 +1,130 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"kcl-lang.io/krm-kcl/pkg/api"
+	"kcl-lang.io/krm-kcl/pkg/kube"
+)
+
+func TestCompileMatchConditions(t *testing.T) {
+	testcases := []struct {
+		name         string
+		conditions   []api.MatchCondition
+		expectErrMsg string
+	}{
+		{
+			name: "valid conditions",
+			conditions: []api.MatchCondition{
+				{Name: "replicas", Expression: "object.spec.replicas > 1"},
+				{Name: "team", Expression: "has(object.metadata.labels.team)"},
+			},
+		},
+		{
+			name:         "missing name",
+			conditions:   []api.MatchCondition{{Expression: "true"}},
+			expectErrMsg: "matchConditions[0]: `name` must not be empty",
+		},
+		{
+			name: "duplicate name",
+			conditions: []api.MatchCondition{
+				{Name: "always", Expression: "true"},
+				{Name: "always", Expression: "true"},
+			},
+			expectErrMsg: `matchConditions[1]: duplicate name "always"`,
+		},
+		{
+			name:         "syntax error",
+			conditions:   []api.MatchCondition{{Name: "bad-syntax", Expression: "object.spec.replicas >"}},
+			expectErrMsg: `matchConditions[0] "bad-syntax": failed to compile the expression`,
+		},
+		{
+			name:         "undeclared variable",
+			conditions:   []api.MatchCondition{{Name: "bad-variable", Expression: "request.kind == 'Pod'"}},
+			expectErrMsg: `matchConditions[0] "bad-variable": failed to compile the expression`,
+		},
+		{
+			name:         "non-bool result",
+			conditions:   []api.MatchCondition{{Name: "non-bool", Expression: "'true'"}},
+			expectErrMsg: `matchConditions[0] "non-bool": the expression must evaluate to bool`,
+		},
+	}
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := CompileMatchConditions(tc.conditions)
+			if tc.expectErrMsg == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectErrMsg)
+			}
+		})
+	}
+}
+
+func TestMatchConditions(t *testing.T) {
+	conditions, err := CompileMatchConditions([]api.MatchCondition{
+		{Name: "replicas-and-team", Expression: "object.spec.replicas > 1 && has(object.metadata.labels.team)"},
+	})
+	assert.NoError(t, err)
+	testcases := []struct {
+		name   string
+		object string
+		expect bool
+	}{
+		{
+			name: "all conditions are true",
+			object: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+  labels:
+    team: web
+spec:
+  replicas: 3
+`,
+			expect: true,
+		},
+		{
+			name: "condition is false",
+			object: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+  labels:
+    team: web
+spec:
+  replicas: 1
+`,
+			expect: false,
+		},
+		{
+			name: "evaluation error",
+			object: `apiVersion: v1
+kind: Service
+metadata:
+  name: nginx
+  labels:
+    team: web
+`,
+			expect: false,
+		},
+	}
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			obj, err := kube.ParseKubeObject([]byte(tc.object))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expect, conditions.Match(obj))
+			constraints := &api.MatchConstraintsSpec{
+				MatchConditions: []api.MatchCondition{
+					{Name: "replicas-and-team", Expression: "object.spec.replicas > 1 && has(object.metadata.labels.team)"},
+				},
+			}
+			assert.Equal(t, tc.expect, MatchResourceRules(obj, constraints, WithMatchConditions(conditions)))
+			assert.Equal(t, tc.expect, MatchResourceRules(obj, constraints))
+		})
+	}
+}
@@ -50,6 +50,272 @@ spec:
 `,
 			expectErrMsg: "",
 		},
+		{
+			name: "KCLRun with invalid matchConditions",
+			config: `apiVersion: krm.kcl.dev/v1alpha1
+kind: KCLRun
+metadata:
+  name: my-kcl-fn
+spec:
+  source: |
+    [item | {metadata.namespace = "baz"} for item in option("resource_list")]
+  matchConstraints:
+    matchConditions:
+    - name: has-replicas
+      expression: object.spec.replicas >
+`,
+			expectErrMsg: `matchConditions[0] "has-replicas": failed to compile the expression`,
+		},
+		{
+			name: "KCLRun with invalid enforcementAction",
+			config: `apiVersion: krm.kcl.dev/v1alpha1
+kind: KCLRun
+metadata:
+  name: my-kcl-fn
+spec:
+  source: |
+    [item | {metadata.namespace = "baz"} for item in option("resource_list")]
+  enforcementAction: audit
+`,
+			expectErrMsg: "spec.enforcementAction in body should be one of [deny warn dryrun]",
+		},
+		{
+			name: "KCLRun with invalid type",
+			config: `apiVersion: krm.kcl.dev/v1alpha1
+kind: KCLRun
+metadata:
+  name: my-kcl-fn
+  annotations:
+    krm.kcl.dev/type: generation
+spec:
+  source: |
+    [item | {metadata.namespace = "baz"} for item in option("resource_list")]
+`,
+			expectErrMsg: "invalid annotation `krm.kcl.dev/type` \"generation\"",
+		},
+		{
+			name: "valid KCLRun with steps",
+			config: `apiVersion: krm.kcl.dev/v1alpha1
+kind: KCLRun
+metadata:
+  name: my-kcl-fn
+spec:
+  steps:
+  - name: set-namespace
+    source: |
+      [item | {metadata.namespace = "baz"} for item in option("resource_list")]
+  - source: |
+      [item | {metadata.labels.app = option("params").app} for item in option("resource_list")]
+    params:
+      app: nginx
+    matchConstraints:
+      resourceRules:
+      - kinds: ["Deployment"]
+`,
+		},
+		{
+			name: "KCLRun with steps and source",
+			config: `apiVersion: krm.kcl.dev/v1alpha1
+kind: KCLRun
+metadata:
+  name: my-kcl-fn
+spec:
+  source: |
+    [item | {metadata.namespace = "baz"} for item in option("resource_list")]
+  steps:
+  - source: |
+      [item | {metadata.namespace = "baz"} for item in option("resource_list")]
+`,
+			expectErrMsg: "`source` must not be set with `steps`",
+		},
+		{
+			name: "KCLRun step missing source",
+			config: `apiVersion: krm.kcl.dev/v1alpha1
+kind: KCLRun
+metadata:
+  name: my-kcl-fn
+spec:
+  steps:
+  - source: |
+      [item | {metadata.namespace = "baz"} for item in option("resource_list")]
+  - name: set-labels
+`,
+			expectErrMsg: "spec.steps[1].source in body is required",
+		},
+		{
+			name: "KCLRun step with invalid matchConstraints",
+			config: `apiVersion: krm.kcl.dev/v1alpha1
+kind: KCLRun
+metadata:
+  name: my-kcl-fn
+spec:
+  steps:
+  - source: |
+      [item | {metadata.namespace = "baz"} for item in option("resource_list")]
+    matchConstraints:
+      resourceRules:
+      - resourceNames: ["[nginx"]
+`,
+			expectErrMsg: "steps[0]: invalid `matchConstraints`: resourceRules[0]: invalid glob pattern",
+		},
+		{
+			name: "KCLRun with invalid hostCredentials",
+			config: `apiVersion: krm.kcl.dev/v1alpha1
+kind: KCLRun
+metadata:
+  name: my-kcl-fn
+spec:
+  source: oci://ghcr.io/kcl-lang/set-annotation:0.1.1
+  hostCredentials:
+  - username: user
+    password: password
+  - url: "[ghcr.io"
+    username: user
+    usernameFrom:
+      env: REGISTRY_USERNAME
+`,
+			expectErrMsg: "[`hostCredentials[0].url` must not be empty, invalid `hostCredentials[1].url` \"[ghcr.io\": syntax error in pattern, `hostCredentials[1].username` and `hostCredentials[1].usernameFrom` must not be set at the same time]",
+		},
+		{
+			name: "KCLRun with invalid paramsFrom",
+			config: `apiVersion: krm.kcl.dev/v1alpha1
+kind: KCLRun
+metadata:
+  name: my-kcl-fn
+spec:
+  source: |
+    [item | {metadata.labels = option("params").labels} for item in option("items")]
+  paramsFrom:
+  - kind: Deployment
+    name: values
+`,
+			expectErrMsg: "spec.paramsFrom[0].kind in body should be one of [ConfigMap Secret]",
+		},
+		{
+			name: "KCLRun with invalid paramsMerge",
+			config: `apiVersion: krm.kcl.dev/v1alpha1
+kind: KCLRun
+metadata:
+  name: my-kcl-fn
+spec:
+  source: |
+    [item | {metadata.labels = option("params").labels} for item in option("items")]
+  paramsMerge:
+    lists: prepend
+`,
+			expectErrMsg: "spec.paramsMerge.lists in body should be one of [replace append mergeByKey]",
+		},
+		{
+			name: "KCLRun with invalid env",
+			config: `apiVersion: krm.kcl.dev/v1alpha1
+kind: KCLRun
+metadata:
+  name: my-kcl-fn
+spec:
+  source: |
+    [item | {metadata.labels.env = option("env").APP_ENV} for item in option("items")]
+  env:
+  - name: APP_ENV
+    prefix: APP_
+  - prefix: APP_
+    value: prod
+  - value: prod
+`,
+			expectErrMsg: "[`env[0].name` and `env[0].prefix` must not be set at the same time, `env[1].value` must not be set with `env[1].prefix`, one of `env[2].name` and `env[2].prefix` must be set]",
+		},
+		{
+			name: "KCLRun with unknown fields",
+			config: `apiVersion: krm.kcl.dev/v1alpha1
+kind: KCLRun
+metadata:
+  name: my-kcl-fn
+  uid: 0d4fa2a6-1c1a-4d5a-9c2a-3f0b8e0c5d6e
+spec:
+  source: |
+    [item | {metadata.namespace = "baz"} for item in option("resource_list")]
+  matchConstraint:
+    resourceRules:
+    - kinds: ["Deployment"]
+`,
+			expectErrMsg: "unknown field \"spec.matchConstraint\"",
+		},
+		{
+			name: "KCLRun with multiple spec errors",
+			config: `apiVersion: krm.kcl.dev/v1alpha1
+kind: KCLRun
+metadata:
+  name: my-kcl-fn
+spec:
+  source: |
+    [item | {metadata.namespace = "baz"} for item in option("resource_list")]
+  config:
+    arguments:
+    - env
+    sortkeys: true
+  matchConstraints:
+    resourceRules:
+    - {}
+`,
+			expectErrMsg: "[spec.config.arguments[0] in body should match '^[^=\\s]+=', spec.matchConstraints.resourceRules[0] in body should have at least 1 properties, unknown field \"spec.config.sortkeys\"]",
+		},
+		{
+			name: "valid ConfigMap",
+			config: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: my-kcl-fn
+data:
+  source: |
+    [item | {metadata.namespace = option("params").namespace} for item in option("items")]
+  namespace: baz
+`,
+		},
+		{
+			name: "ConfigMap missing Source",
+			config: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: my-kcl-fn
+data:
+  namespace: baz
+`,
+			expectErrMsg: "`source` must not be empty",
+		},
+		{
+			name: "ConfigMap with invalid config",
+			config: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: my-kcl-fn
+data:
+  source: oci://ghcr.io/kcl-lang/set-annotation
+  config: "[sortKeys]"
+`,
+			expectErrMsg: "failed to parse the ConfigMap data `config`",
+		},
+		{
+			name: "ConfigMap with unknown config fields",
+			config: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: my-kcl-fn
+data:
+  source: |
+    [item | {metadata.namespace = "baz"} for item in option("resource_list")]
+  config: |
+    sortkeys: true
+`,
+			expectErrMsg: "unknown field \"sortkeys\"",
+		},
+		{
+			name: "unknown function config",
+			config: `apiVersion: v1
+kind: Secret
+metadata:
+  name: my-kcl-fn
+`,
+			expectErrMsg: "resource must be krm.kcl.dev/v1alpha1, Kind=KCLRun",
+		},
 	}
 	for _, tc := range testcases {
 		tc := tc
@@ -68,6 +334,37 @@ spec:
 	}
 }
 
+func TestKCLConfigFromConfigMap(t *testing.T) {
+	config := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: my-kcl-fn
+  namespace: foo
+data:
+  source: oci://ghcr.io/kcl-lang/set-annotation
+  dependencies: |
+    k8s = "1.31"
+  config: |
+    sortKeys: true
+    arguments:
+    - env=prod
+  annotation: managed-by
+`
+	r := &KCLRun{}
+	ko, err := kube.ParseKubeObject([]byte(config))
+	assert.NoError(t, err)
+	assert.NoError(t, r.Config(ko))
+	assert.Equal(t, "krm.kcl.dev/v1alpha1", r.APIVersion)
+	assert.Equal(t, "KCLRun", r.Kind)
+	assert.Equal(t, "my-kcl-fn", r.Name)
+	assert.Equal(t, "foo", r.Namespace)
+	assert.Equal(t, "oci://ghcr.io/kcl-lang/set-annotation", r.Spec.Source)
+	assert.Equal(t, "k8s = \"1.31\"\n", r.Spec.Dependencies)
+	assert.True(t, r.Spec.Config.SortKeys)
+	assert.Equal(t, []string{"env=prod"}, r.Spec.Config.Arguments)
+	assert.Equal(t, map[string]interface{}{"annotation": "managed-by"}, r.Spec.Params)
+}
+
 func TestKCLRun(t *testing.T) {
 	testcases := []struct {
 		name         string
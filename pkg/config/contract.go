@@ -0,0 +1,117 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"kcl-lang.io/krm-kcl/pkg/kube"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// checkTypeContract checks the function output against the behavior contract declared by
+// the function type, and returns the output nodes or an error naming the offending resource.
+//
+// - validation: the output resources must be identical to the input resources, and the input
+// nodes are returned to keep the resources byte-for-byte identical. An empty output denotes
+// the resources are not changed.
+// - mutation: the function must not add or remove resources or change their identity.
+// - abstraction or undeclared: the function may generate any resources.
+func checkTypeContract(funcType string, in, out []*yaml.RNode) ([]*yaml.RNode, error) {
+	switch funcType {
+	case ValidationType:
+		if len(out) == 0 {
+			return in, nil
+		}
+		if err := checkSameIdentities(funcType, in, out); err != nil {
+			return nil, err
+		}
+		inNodes := make(map[string][]*yaml.RNode)
+		for _, n := range in {
+			inNodes[nodeID(n)] = append(inNodes[nodeID(n)], n)
+		}
+		for _, n := range out {
+			id := nodeID(n)
+			equal, err := equalNodes(inNodes[id][0], n)
+			if err != nil {
+				return nil, err
+			}
+			if !equal {
+				return nil, fmt.Errorf("%s function must not modify resources, but %s is modified", funcType, id)
+			}
+			inNodes[id] = inNodes[id][1:]
+		}
+		return in, nil
+	case MutationType:
+		if err := checkSameIdentities(funcType, in, out); err != nil {
+			return nil, err
+		}
+		return out, nil
+	default:
+		return out, nil
+	}
+}
+
+// checkSameIdentities checks the input and output resources have the same identities.
+func checkSameIdentities(funcType string, in, out []*yaml.RNode) error {
+	inIDs := make(map[string]int)
+	for _, n := range in {
+		inIDs[nodeID(n)]++
+	}
+	outIDs := make(map[string]int)
+	for _, n := range out {
+		id := nodeID(n)
+		outIDs[id]++
+		if outIDs[id] > inIDs[id] {
+			return fmt.Errorf("%s function must not add resources or change their identity, but %s is added", funcType, id)
+		}
+	}
+	for _, n := range in {
+		id := nodeID(n)
+		if outIDs[id] < inIDs[id] {
+			return fmt.Errorf("%s function must not remove resources or change their identity, but %s is removed", funcType, id)
+		}
+	}
+	return nil
+}
+
+// nodeID returns the resource identity in the format [<group>/]<kind>/[<namespace>/]<name>.
+func nodeID(n *yaml.RNode) string {
+	gv, _ := schema.ParseGroupVersion(n.GetApiVersion())
+	m := kube.ObjMetadata{
+		Namespace: n.GetNamespace(),
+		Name:      n.GetName(),
+		GroupKind: schema.GroupKind{Group: gv.Group, Kind: n.GetKind()},
+	}
+	if gv.Group == "" {
+		return m.ID()
+	}
+	return gv.Group + "/" + m.ID()
+}
+
+// equalNodes checks if the two nodes are semantically equal.
+func equalNodes(a, b *yaml.RNode) (bool, error) {
+	aValue, err := jsonValue(a)
+	if err != nil {
+		return false, err
+	}
+	bValue, err := jsonValue(b)
+	if err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(aValue, bValue), nil
+}
+
+// jsonValue returns the JSON value of the node.
+func jsonValue(n *yaml.RNode) (interface{}, error) {
+	data, err := n.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+func TestCheckTypeContract(t *testing.T) {
+	deployment := func(name string, replicas string) *yaml.RNode {
+		return yaml.MustParse(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: ` + name + `
+  namespace: default
+spec:
+  replicas: ` + replicas + "\n")
+	}
+	configMap := yaml.MustParse("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: generated\n")
+	testcases := []struct {
+		name         string
+		funcType     string
+		in           []*yaml.RNode
+		out          []*yaml.RNode
+		expectOut    []*yaml.RNode
+		expectErrMsg string
+	}{
+		{
+			name:      "validation keeps the input nodes",
+			funcType:  ValidationType,
+			in:        []*yaml.RNode{deployment("a", "1"), deployment("b", "2")},
+			out:       []*yaml.RNode{deployment("b", "2"), deployment("a", "1")},
+			expectOut: []*yaml.RNode{deployment("a", "1"), deployment("b", "2")},
+		},
+		{
+			name:      "validation with empty output",
+			funcType:  ValidationType,
+			in:        []*yaml.RNode{deployment("a", "1")},
+			expectOut: []*yaml.RNode{deployment("a", "1")},
+		},
+		{
+			name:         "validation modifies resources",
+			funcType:     ValidationType,
+			in:           []*yaml.RNode{deployment("a", "1")},
+			out:          []*yaml.RNode{deployment("a", "2")},
+			expectErrMsg: "validation function must not modify resources, but apps/Deployment/default/a is modified",
+		},
+		{
+			name:      "mutation modifies resources",
+			funcType:  MutationType,
+			in:        []*yaml.RNode{deployment("a", "1")},
+			out:       []*yaml.RNode{deployment("a", "2")},
+			expectOut: []*yaml.RNode{deployment("a", "2")},
+		},
+		{
+			name:         "mutation adds resources",
+			funcType:     MutationType,
+			in:           []*yaml.RNode{deployment("a", "1")},
+			out:          []*yaml.RNode{deployment("a", "1"), configMap},
+			expectErrMsg: "mutation function must not add resources or change their identity, but ConfigMap/generated is added",
+		},
+		{
+			name:         "mutation removes resources",
+			funcType:     MutationType,
+			in:           []*yaml.RNode{deployment("a", "1"), deployment("b", "1")},
+			out:          []*yaml.RNode{deployment("a", "1")},
+			expectErrMsg: "mutation function must not remove resources or change their identity, but apps/Deployment/default/b is removed",
+		},
+		{
+			name:         "mutation renames resources",
+			funcType:     MutationType,
+			in:           []*yaml.RNode{deployment("a", "1")},
+			out:          []*yaml.RNode{deployment("c", "1")},
+			expectErrMsg: "but apps/Deployment/default/c is added",
+		},
+		{
+			name:      "abstraction generates resources",
+			funcType:  AbstractionType,
+			in:        []*yaml.RNode{},
+			out:       []*yaml.RNode{configMap},
+			expectOut: []*yaml.RNode{configMap},
+		},
+	}
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := checkTypeContract(tc.funcType, tc.in, tc.out)
+			if tc.expectErrMsg == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, len(tc.expectOut), len(out))
+				for i := range out {
+					assert.Equal(t, tc.expectOut[i].MustString(), out[i].MustString())
+				}
+			} else {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectErrMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package config
+
+import (
+	"fmt"
+
+	"kcl-lang.io/krm-kcl/pkg/api"
+	"kcl-lang.io/krm-kcl/pkg/api/v1alpha1"
+	"kcl-lang.io/krm-kcl/pkg/api/v1beta1"
+)
+
+// ConvertToV1Beta1 converts the v1alpha1 KCLRun to the v1beta1 version. The inline `username` and
+// `password` credentials are converted to the literal `value` of `usernameFrom` and `passwordFrom`,
+// which are converted back to the inline credentials. The literal values are only the conversion
+// artifacts, and they are rejected in the v1beta1 configs.
+func (r *KCLRun) ConvertToV1Beta1() (*v1beta1.KCLRun, error) {
+	out := &v1beta1.KCLRun{ResourceMeta: r.ResourceMeta}
+	out.APIVersion = v1beta1.KCLRunAPIVersion
+	out.Kind = api.KCLRunKind
+	if r.Spec.Source != "" {
+		source := sourceToV1Beta1(r.Spec.Source)
+		out.Spec.Source = &source
+	}
+	params, err := paramsToV1Beta1(r.Spec.Params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert `params`: %v", err)
+	}
+	out.Spec.Params = params
+	out.Spec.ParamsFrom = r.Spec.ParamsFrom
+	for name, profile := range r.Spec.Profiles {
+		params, err := paramsToV1Beta1(profile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert `%s.%s`: %v", api.ProfilesKey, name, err)
+		}
+		if out.Spec.Profiles == nil {
+			out.Spec.Profiles = map[string]v1beta1.Params{}
+		}
+		out.Spec.Profiles[name] = params
+	}
+	out.Spec.ParamsMerge = r.Spec.ParamsMerge
+	out.Spec.Config = r.Spec.Config
+	if r.Spec.Credentials != (api.CredSpec{}) {
+		cred, err := credentialsToV1Beta1("credentials", r.Spec.Credentials)
+		if err != nil {
+			return nil, err
+		}
+		out.Spec.Credentials = &cred
+	}
+	for i, c := range r.Spec.HostCredentials {
+		cred, err := credentialsToV1Beta1(fmt.Sprintf("hostCredentials[%d]", i), c)
+		if err != nil {
+			return nil, err
+		}
+		out.Spec.HostCredentials = append(out.Spec.HostCredentials, cred)
+	}
+	out.Spec.MatchConstraints = r.Spec.MatchConstraints
+	out.Spec.Dependencies = r.Spec.Dependencies
+	out.Spec.EnforcementAction = r.Spec.EnforcementAction
+	out.Spec.Env = r.Spec.Env
+	out.Spec.Sandbox = r.Spec.Sandbox
+	out.Spec.Timeout = r.Spec.Timeout
+	for i, step := range r.Spec.Steps {
+		params, err := paramsToV1Beta1(step.Params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert `%s[%d].params`: %v", api.StepsKey, i, err)
+		}
+		out.Spec.Steps = append(out.Spec.Steps, v1beta1.StepSpec{
+			Name:             step.Name,
+			Source:           sourceToV1Beta1(step.Source),
+			Params:           params,
+			Config:           step.Config,
+			MatchConstraints: step.MatchConstraints,
+			Dependencies:     step.Dependencies,
+		})
+	}
+	return out, nil
+}
+
+// ConvertFromV1Beta1 converts the v1beta1 KCLRun to the v1alpha1 version.
+func (r *KCLRun) ConvertFromV1Beta1(in *v1beta1.KCLRun) error {
+	r.ResourceMeta = in.ResourceMeta
+	r.APIVersion = v1alpha1.KCLRunAPIVersion
+	r.Kind = api.KCLRunKind
+	if in.Spec.Source != nil {
+		source, err := sourceFromV1Beta1(api.SourceKey, in.Spec.Source)
+		if err != nil {
+			return err
+		}
+		r.Spec.Source = source
+	}
+	params, err := paramsFromV1Beta1(in.Spec.Params)
+	if err != nil {
+		return fmt.Errorf("failed to convert `params`: %v", err)
+	}
+	r.Spec.Params = params
+	r.Spec.ParamsFrom = in.Spec.ParamsFrom
+	r.Spec.Profiles = nil
+	for name, profile := range in.Spec.Profiles {
+		params, err := paramsFromV1Beta1(profile)
+		if err != nil {
+			return fmt.Errorf("failed to convert `%s.%s`: %v", api.ProfilesKey, name, err)
+		}
+		if r.Spec.Profiles == nil {
+			r.Spec.Profiles = map[string]map[string]interface{}{}
+		}
+		r.Spec.Profiles[name] = params
+	}
+	r.Spec.ParamsMerge = in.Spec.ParamsMerge
+	r.Spec.Config = in.Spec.Config
+	if in.Spec.Credentials != nil {
+		r.Spec.Credentials = credentialsFromV1Beta1(*in.Spec.Credentials)
+	}
+	r.Spec.HostCredentials = nil
+	for _, cred := range in.Spec.HostCredentials {
+		r.Spec.HostCredentials = append(r.Spec.HostCredentials, credentialsFromV1Beta1(cred))
+	}
+	r.Spec.MatchConstraints = in.Spec.MatchConstraints
+	r.Spec.Dependencies = in.Spec.Dependencies
+	r.Spec.EnforcementAction = in.Spec.EnforcementAction
+	r.Spec.Env = in.Spec.Env
+	r.Spec.Sandbox = in.Spec.Sandbox
+	r.Spec.Timeout = in.Spec.Timeout
+	r.Spec.Steps = nil
+	for i, step := range in.Spec.Steps {
+		source, err := sourceFromV1Beta1(fmt.Sprintf("%s[%d].%s", api.StepsKey, i, api.SourceKey), &step.Source)
+		if err != nil {
+			return err
+		}
+		params, err := paramsFromV1Beta1(step.Params)
+		if err != nil {
+			return fmt.Errorf("failed to convert `%s[%d].params`: %v", api.StepsKey, i, err)
+		}
+		r.Spec.Steps = append(r.Spec.Steps, api.StepSpec{
+			Name:             step.Name,
+			Source:           source,
+			Params:           params,
+			Config:           step.Config,
+			MatchConstraints: step.MatchConstraints,
+			Dependencies:     step.Dependencies,
+		})
+	}
+	return nil
+}
+
+// credentialsToV1Beta1 converts the credentials to the v1beta1 credential references, and the inline
+// `username` and `password` are converted to the literal value references.
+func credentialsToV1Beta1(field string, in api.CredSpec) (v1beta1.CredentialsSpec, error) {
+	out := v1beta1.CredentialsSpec{
+		Url:          in.Url,
+		UsernameFrom: in.UsernameFrom,
+		PasswordFrom: in.PasswordFrom,
+	}
+	if in.Username != "" {
+		if in.UsernameFrom != nil {
+			return out, fmt.Errorf("`%s.username` and `%s.usernameFrom` can not be set at the same time", field, field)
+		}
+		out.UsernameFrom = &api.ValueSource{Value: in.Username}
+	}
+	if in.Password != "" {
+		if in.PasswordFrom != nil {
+			return out, fmt.Errorf("`%s.password` and `%s.passwordFrom` can not be set at the same time", field, field)
+		}
+		out.PasswordFrom = &api.ValueSource{Value: in.Password}
+	}
+	return out, nil
+}
+
+// credentialsFromV1Beta1 converts the v1beta1 credential references to the credentials, and the literal
+// value references are converted to the inline `username` and `password`.
+func credentialsFromV1Beta1(in v1beta1.CredentialsSpec) api.CredSpec {
+	out := api.CredSpec{
+		Url:          in.Url,
+		UsernameFrom: in.UsernameFrom,
+		PasswordFrom: in.PasswordFrom,
+	}
+	if isLiteralValue(in.UsernameFrom) {
+		out.Username, out.UsernameFrom = in.UsernameFrom.Value, nil
+	}
+	if isLiteralValue(in.PasswordFrom) {
+		out.Password, out.PasswordFrom = in.PasswordFrom.Value, nil
+	}
+	return out
+}
+
+// validateV1Beta1Credentials rejects the literal values of the credential references in the v1beta1
+// KCLRun config, which are only the conversion artifacts of the v1alpha1 inline credentials, so that
+// the v1beta1 configs do not carry the inline secrets.
+func validateV1Beta1Credentials(in *v1beta1.KCLRun) error {
+	var errs []error
+	validate := func(field string, ref *api.ValueSource) {
+		if ref != nil && ref.Value != "" {
+			errs = append(errs, fmt.Errorf("`%s.value` is not allowed in %s, use `env`, `file`, `secretKeyRef` or `dockerConfig` instead",
+				field, v1beta1.KCLRunAPIVersion))
+		}
+	}
+	if in.Spec.Credentials != nil {
+		validate("credentials.usernameFrom", in.Spec.Credentials.UsernameFrom)
+		validate("credentials.passwordFrom", in.Spec.Credentials.PasswordFrom)
+	}
+	for i, cred := range in.Spec.HostCredentials {
+		validate(fmt.Sprintf("hostCredentials[%d].usernameFrom", i), cred.UsernameFrom)
+		validate(fmt.Sprintf("hostCredentials[%d].passwordFrom", i), cred.PasswordFrom)
+	}
+	return aggregate(errs)
+}
+
+// isLiteralValue returns true if the value reference only has the literal value.
+func isLiteralValue(ref *api.ValueSource) bool {
+	return ref != nil && ref.Value != "" && *ref == api.ValueSource{Value: ref.Value}
+}
+
+// paramsToV1Beta1 converts the untyped params to the typed params.
+func paramsToV1Beta1(in map[string]interface{}) (v1beta1.Params, error) {
+	if in == nil {
+		return nil, nil
+	}
+	out := make(v1beta1.Params, len(in))
+	for k, v := range in {
+		value, err := v1beta1.NewParamValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("param %q: %v", k, err)
+		}
+		out[k] = value
+	}
+	return out, nil
+}
+
+// paramsFromV1Beta1 converts the typed params to the untyped params.
+func paramsFromV1Beta1(in v1beta1.Params) (map[string]interface{}, error) {
+	if in == nil {
+		return nil, nil
+	}
+	out := make(map[string]interface{}, len(in))
+	for k, v := range in {
+		value, err := v.Value()
+		if err != nil {
+			return nil, fmt.Errorf("param %q: %v", k, err)
+		}
+		out[k] = value
+	}
+	return out, nil
+}
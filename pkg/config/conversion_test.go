@@ -0,0 +1,354 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"kcl-lang.io/krm-kcl/pkg/api"
+	"kcl-lang.io/krm-kcl/pkg/api/v1beta1"
+	"kcl-lang.io/krm-kcl/pkg/kube"
+)
+
+func TestConvertV1Beta1(t *testing.T) {
+	testcases := []struct {
+		name   string
+		config string
+	}{
+		{
+			name: "inline source with params",
+			config: `apiVersion: krm.kcl.dev/v1alpha1
+kind: KCLRun
+metadata:
+  name: my-kcl-fn
+  annotations:
+    krm.kcl.dev/type: mutation
+spec:
+  source: |
+    [item | {metadata.labels = option("params").labels} for item in option("items")]
+  params:
+    labels:
+      app: nginx
+    replicas: 3
+    enabled: true
+  paramsFrom:
+  - kind: ConfigMap
+    name: prod-values
+    key: values.yaml
+  profiles:
+    prod:
+      replicas: 5
+      labels:
+        env: prod
+  paramsMerge:
+    lists: mergeByKey
+    key: name
+  env:
+  - name: HOME
+  - prefix: APP_
+  - name: REGION
+    value: us-east-1
+  sandbox:
+    enabled: true
+    maxOutputSize: 1048576
+  timeout: 30s
+  config:
+    arguments: ['env="prod"']
+  enforcementAction: warn
+  matchConstraints:
+    resourceRules:
+    - kinds: ["Deployment"]
+`,
+		},
+		{
+			name: "oci source with credential references",
+			config: `apiVersion: krm.kcl.dev/v1alpha1
+kind: KCLRun
+metadata:
+  name: my-kcl-fn
+spec:
+  source: oci://ghcr.io/kcl-lang/set-annotation:0.1.1
+  credentials:
+    url: ghcr.io
+    usernameFrom:
+      env: REGISTRY_USERNAME
+    passwordFrom:
+      file: /var/run/secrets/registry/password
+`,
+		},
+		{
+			name: "host credentials",
+			config: `apiVersion: krm.kcl.dev/v1alpha1
+kind: KCLRun
+metadata:
+  name: my-kcl-fn
+spec:
+  source: oci://ghcr.io/kcl-lang/set-annotation:0.1.1
+  dependencies: |
+    konfig = { git = "https://gitlab.example.com/platform/konfig", tag = "v0.1.0" }
+  hostCredentials:
+  - url: "*.example.com"
+    usernameFrom:
+      env: GITLAB_USERNAME
+    passwordFrom:
+      secretKeyRef:
+        name: gitlab
+        key: token
+  - url: harbor.internal
+    usernameFrom:
+      dockerConfig:
+        registry: harbor.internal
+    passwordFrom:
+      dockerConfig:
+        registry: harbor.internal
+`,
+		},
+		{
+			name: "steps",
+			config: `apiVersion: krm.kcl.dev/v1alpha1
+kind: KCLRun
+metadata:
+  name: my-kcl-fn
+spec:
+  steps:
+  - name: local
+    source: ./testdata/main.k
+  - source: github.com/kcl-lang/krm-kcl/examples/mutation/set-labels
+  - source: https://raw.githubusercontent.com/kcl-lang/krm-kcl/main/examples/main.k
+    params:
+      labels:
+        app: nginx
+`,
+		},
+	}
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			o, err := kube.ParseKubeObject([]byte(tc.config))
+			assert.NoError(t, err)
+			alpha := New()
+			assert.NoError(t, alpha.Config(o))
+			beta, err := alpha.ConvertToV1Beta1()
+			assert.NoError(t, err)
+			assert.Equal(t, v1beta1.KCLRunAPIVersion, beta.APIVersion)
+			// The v1beta1 version is accepted by Config and converted back losslessly.
+			betaObj, err := objectValue(beta)
+			assert.NoError(t, err)
+			assert.Empty(t, ValidateSchema(betaObj))
+			got := &KCLRun{}
+			assert.NoError(t, got.ConvertFromV1Beta1(beta))
+			assert.Equal(t, alpha.ResourceMeta, got.ResourceMeta)
+			assert.Equal(t, alpha.Spec, got.Spec)
+			// Round trip from the v1beta1 version.
+			again, err := got.ConvertToV1Beta1()
+			assert.NoError(t, err)
+			assert.Equal(t, beta, again)
+		})
+	}
+}
+
+func TestKCLConfigV1Beta1(t *testing.T) {
+	testcases := []struct {
+		name         string
+		config       string
+		expectSource string
+		expectErrMsg string
+	}{
+		{
+			name: "valid KCLRun",
+			config: `apiVersion: krm.kcl.dev/v1beta1
+kind: KCLRun
+metadata:
+  name: my-kcl-fn
+spec:
+  source:
+    oci:
+      ref: ghcr.io/kcl-lang/set-annotation
+      tag: 0.1.1
+  params:
+    annotations:
+      managed-by: krm-kcl
+`,
+			expectSource: "oci://ghcr.io/kcl-lang/set-annotation:0.1.1",
+		},
+		{
+			name: "string shorthand",
+			config: `apiVersion: krm.kcl.dev/v1beta1
+kind: KCLRun
+metadata:
+  name: my-kcl-fn
+spec:
+  source: oci://ghcr.io/kcl-lang/set-annotation:0.1.1
+`,
+			expectSource: "oci://ghcr.io/kcl-lang/set-annotation:0.1.1",
+		},
+		{
+			name: "git source",
+			config: `apiVersion: krm.kcl.dev/v1beta1
+kind: KCLRun
+metadata:
+  name: my-kcl-fn
+spec:
+  source:
+    git:
+      url: https://github.com/kcl-lang/krm-kcl
+      ref: main
+      path: examples/mutation/set-labels
+`,
+			expectSource: "git::https://github.com/kcl-lang/krm-kcl//examples/mutation/set-labels?ref=main",
+		},
+		{
+			name: "unknown source field",
+			config: `apiVersion: krm.kcl.dev/v1beta1
+kind: KCLRun
+metadata:
+  name: my-kcl-fn
+spec:
+  source:
+    git:
+      url: https://github.com/kcl-lang/krm-kcl
+      branch: main
+`,
+			expectErrMsg: "spec.source.git.branch in body is a forbidden property",
+		},
+		{
+			name: "unknown source kind",
+			config: `apiVersion: krm.kcl.dev/v1beta1
+kind: KCLRun
+metadata:
+  name: my-kcl-fn
+spec:
+  source:
+    gti:
+      url: https://github.com/kcl-lang/krm-kcl
+`,
+			expectErrMsg: "spec.source.gti in body is a forbidden property",
+		},
+		{
+			name: "invalid step source",
+			config: `apiVersion: krm.kcl.dev/v1beta1
+kind: KCLRun
+metadata:
+  name: my-kcl-fn
+spec:
+  steps:
+  - source:
+      oci:
+        ref: ghcr.io/kcl-lang/set-annotation:0.1.1
+`,
+			expectErrMsg: "invalid `steps[0].source.oci.ref` \"ghcr.io/kcl-lang/set-annotation:0.1.1\", it must not have the tag or the digest, set `steps[0].source.oci.tag` and `steps[0].source.oci.digest` instead",
+		},
+		{
+			name: "multiple sources",
+			config: `apiVersion: krm.kcl.dev/v1beta1
+kind: KCLRun
+metadata:
+  name: my-kcl-fn
+spec:
+  source:
+    oci:
+      ref: ghcr.io/kcl-lang/set-annotation
+    local:
+      path: ./main.k
+`,
+			expectErrMsg: "spec.source in body should have at most 1 properties",
+		},
+		{
+			name: "mismatched source kind",
+			config: `apiVersion: krm.kcl.dev/v1beta1
+kind: KCLRun
+metadata:
+  name: my-kcl-fn
+spec:
+  source:
+    local:
+      path: oci://ghcr.io/kcl-lang/set-annotation:0.1.1
+`,
+			expectErrMsg: "invalid `source.local.path` \"oci://ghcr.io/kcl-lang/set-annotation:0.1.1\", expect a file or directory path instead of a URL",
+		},
+		{
+			name: "inline credentials",
+			config: `apiVersion: krm.kcl.dev/v1beta1
+kind: KCLRun
+metadata:
+  name: my-kcl-fn
+spec:
+  source:
+    oci:
+      ref: ghcr.io/kcl-lang/set-annotation
+  credentials:
+    url: ghcr.io
+    password: secret
+`,
+			expectErrMsg: "unknown field \"spec.credentials.password\"",
+		},
+		{
+			name: "literal credentials",
+			config: `apiVersion: krm.kcl.dev/v1beta1
+kind: KCLRun
+metadata:
+  name: my-kcl-fn
+spec:
+  source:
+    oci:
+      ref: ghcr.io/kcl-lang/set-annotation
+  credentials:
+    url: ghcr.io
+    usernameFrom:
+      value: user
+    passwordFrom:
+      env: GHCR_TOKEN
+  hostCredentials:
+  - url: "*.example.com"
+    passwordFrom:
+      value: secret
+`,
+			expectErrMsg: "[`credentials.usernameFrom.value` is not allowed in krm.kcl.dev/v1beta1, use `env`, `file`, `secretKeyRef` or `dockerConfig` instead, `hostCredentials[0].passwordFrom.value` is not allowed in krm.kcl.dev/v1beta1, use `env`, `file`, `secretKeyRef` or `dockerConfig` instead]",
+		},
+	}
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			o, err := kube.ParseKubeObject([]byte(tc.config))
+			assert.NoError(t, err)
+			r := New()
+			err = r.Config(o)
+			if tc.expectErrMsg == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectSource, r.Spec.Source)
+			} else {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectErrMsg)
+			}
+		})
+	}
+}
+
+func TestConvertInlineCredentialsRoundTrip(t *testing.T) {
+	r := New()
+	r.Spec.Source = "oci://ghcr.io/kcl-lang/set-annotation:0.1.1"
+	r.Spec.Credentials = api.CredSpec{Url: "ghcr.io", Username: "user", Password: "secret"}
+	r.Spec.HostCredentials = []api.CredSpec{
+		{Url: "*.example.com", Username: "gitlab", PasswordFrom: &api.ValueSource{Env: "GITLAB_TOKEN"}},
+	}
+	out, err := r.ConvertToV1Beta1()
+	assert.NoError(t, err)
+	assert.Equal(t, &v1beta1.CredentialsSpec{
+		Url:          "ghcr.io",
+		UsernameFrom: &api.ValueSource{Value: "user"},
+		PasswordFrom: &api.ValueSource{Value: "secret"},
+	}, out.Spec.Credentials)
+	assert.Equal(t, []v1beta1.CredentialsSpec{
+		{Url: "*.example.com", UsernameFrom: &api.ValueSource{Value: "gitlab"}, PasswordFrom: &api.ValueSource{Env: "GITLAB_TOKEN"}},
+	}, out.Spec.HostCredentials)
+
+	// v1alpha1 -> v1beta1 -> v1alpha1
+	back := New()
+	assert.NoError(t, back.ConvertFromV1Beta1(out))
+	assert.Equal(t, r.Spec.Credentials, back.Spec.Credentials)
+	assert.Equal(t, r.Spec.HostCredentials, back.Spec.HostCredentials)
+
+	// The inline credentials and the references can not be set at the same time.
+	r.Spec.Credentials.UsernameFrom = &api.ValueSource{Env: "USERNAME"}
+	_, err = r.ConvertToV1Beta1()
+	assert.EqualError(t, err, "`credentials.username` and `credentials.usernameFrom` can not be set at the same time")
+}
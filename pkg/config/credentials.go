@@ -0,0 +1,338 @@
+package config
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"kcl-lang.io/krm-kcl/pkg/api"
+	src "kcl-lang.io/krm-kcl/pkg/source"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const (
+	// coreAPIVersion is the API version of the core resources, e.g., Secret and ConfigMap.
+	coreAPIVersion = "v1"
+	// secretKind is the kind of the Secret resource.
+	secretKind = "Secret"
+	// dockerConfigEnvVar is the environment variable of the Docker config directory.
+	dockerConfigEnvVar = "DOCKER_CONFIG"
+	// dockerCredentialHelperPrefix is the executable name prefix of the Docker credential helpers.
+	dockerCredentialHelperPrefix = "docker-credential-"
+	// dockerCredentialsNotFound is the error message of the Docker credential helpers when the credentials are not found.
+	dockerCredentialsNotFound = "credentials not found"
+)
+
+// dockerConfig is the subset of a Docker config.json file.
+type dockerConfig struct {
+	Auths map[string]dockerAuth `json:"auths"`
+	// CredsStore is the default credential helper for all the registries, e.g., "desktop" for docker-credential-desktop
+	CredsStore string `json:"credsStore,omitempty"`
+	// CredHelpers are the credential helpers keyed by the registry hosts.
+	CredHelpers map[string]string `json:"credHelpers,omitempty"`
+}
+
+// dockerHelperCredentials is the output of the Docker credential helper `get` command.
+type dockerHelperCredentials struct {
+	Username string `json:"Username"`
+	Secret   string `json:"Secret"`
+}
+
+// dockerAuth is an auth entry of a Docker config.json file.
+type dockerAuth struct {
+	// Auth is the base64 encoding of "username:password".
+	Auth     string `json:"auth,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// credentialStore looks up the credentials of the hosts in the credentials of the KCLRun, and falls back to
+// the Docker credential helpers and the Docker config file.
+type credentialStore struct {
+	// creds are the resolved credentials whose `url` is the host pattern.
+	creds []api.CredSpec
+	// redactor masks the credentials found by the store.
+	redactor *src.Redactor
+}
+
+// newCredentialStore resolves the host credentials and returns the credential store. The legacy credentials
+// with the `url` take precedence over the host credentials.
+func newCredentialStore(cred api.CredSpec, hostCreds []api.CredSpec, nodes []*yaml.RNode, redactor *src.Redactor) (*credentialStore, error) {
+	s := &credentialStore{redactor: redactor}
+	if cred.Url != "" && (cred.Username != "" || cred.Password != "") {
+		s.creds = append(s.creds, cred)
+	}
+	for i, c := range hostCreds {
+		resolved, err := resolveCredentials(fmt.Sprintf("hostCredentials[%d]", i), c, nodes)
+		if err != nil {
+			return nil, err
+		}
+		redactor.Add(resolved.Password)
+		s.creds = append(s.creds, resolved)
+	}
+	return s, nil
+}
+
+// Lookup returns the credentials of the host, or nil if there are no credentials for the host.
+// The first credentials whose `url` matches the host are used. It implements edit.CredentialsFunc.
+func (s *credentialStore) Lookup(host string) (*api.CredSpec, error) {
+	if host == "" {
+		return nil, nil
+	}
+	for _, c := range s.creds {
+		if matchHost(c.Url, host) {
+			return &api.CredSpec{Url: host, Username: c.Username, Password: c.Password}, nil
+		}
+	}
+	// The Docker credentials are the best-effort fallback, and the source may be public even though
+	// the Docker config is missing or broken.
+	path, err := dockerConfigPath()
+	if err != nil {
+		return nil, nil
+	}
+	config, err := loadDockerConfig(path)
+	if err != nil {
+		return nil, nil
+	}
+	username, password, ok, err := config.credentials(host)
+	if err != nil || !ok {
+		return nil, nil
+	}
+	s.redactor.Add(password)
+	return &api.CredSpec{Url: host, Username: username, Password: password}, nil
+}
+
+// matchHost returns true if the host matches the host glob pattern of the URL, e.g., https://*.example.com
+func matchHost(pattern, host string) bool {
+	ok, _ := path.Match(registryHost(pattern), host)
+	return ok
+}
+
+// resolveCredentials returns the credentials with the username and password resolved from the references.
+// The Secrets referred by the credentials are found in the input nodes, and the field is the path of the
+// credentials used in the error messages.
+func resolveCredentials(field string, cred api.CredSpec, nodes []*yaml.RNode) (api.CredSpec, error) {
+	if cred.UsernameFrom != nil {
+		username, err := resolveValue(cred.UsernameFrom, nodes, false)
+		if err != nil {
+			return cred, fmt.Errorf("failed to resolve `%s.usernameFrom`: %v", field, err)
+		}
+		cred.Username = username
+	}
+	if cred.PasswordFrom != nil {
+		password, err := resolveValue(cred.PasswordFrom, nodes, true)
+		if err != nil {
+			return cred, fmt.Errorf("failed to resolve `%s.passwordFrom`: %v", field, err)
+		}
+		cred.Password = password
+	}
+	return cred, nil
+}
+
+// resolveValue returns the value which the reference refers to. The password of a Docker config
+// auth entry is used if password is true, otherwise the username is used.
+func resolveValue(ref *api.ValueSource, nodes []*yaml.RNode, password bool) (string, error) {
+	set := 0
+	for _, ok := range []bool{ref.Value != "", ref.Env != "", ref.File != "", ref.SecretKeyRef != nil, ref.DockerConfig != nil} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return "", fmt.Errorf("exactly one of `value`, `env`, `file`, `secretKeyRef` and `dockerConfig` must be set")
+	}
+	switch {
+	case ref.Value != "":
+		return ref.Value, nil
+	case ref.Env != "":
+		value, ok := os.LookupEnv(ref.Env)
+		if !ok {
+			return "", fmt.Errorf("environment variable %q is not set", ref.Env)
+		}
+		return value, nil
+	case ref.File != "":
+		data, err := os.ReadFile(ref.File)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case ref.SecretKeyRef != nil:
+		return resolveSecretKey(ref.SecretKeyRef, nodes)
+	default:
+		username, pass, err := resolveDockerAuth(ref.DockerConfig)
+		if password {
+			return pass, err
+		}
+		return username, err
+	}
+}
+
+// resolveSecretKey returns the value of the key of the Secret in the input nodes.
+func resolveSecretKey(ref *api.SecretKeySelector, nodes []*yaml.RNode) (string, error) {
+	idx := findDataResource(nodes, secretKind, ref.Name, ref.Namespace)
+	if idx < 0 {
+		return "", fmt.Errorf("Secret %q is not found in the input resources", ref.Name)
+	}
+	data, err := resourceData(nodes[idx])
+	if err != nil {
+		return "", err
+	}
+	value, ok := data[ref.Key]
+	if !ok {
+		return "", fmt.Errorf("key %q is not found in the Secret %q", ref.Key, ref.Name)
+	}
+	return value, nil
+}
+
+// resolveDockerAuth returns the username and password of the registry in the Docker config file.
+func resolveDockerAuth(ref *api.DockerConfigSelector) (string, string, error) {
+	path := ref.Path
+	if path == "" {
+		var err error
+		if path, err = dockerConfigPath(); err != nil {
+			return "", "", err
+		}
+	}
+	config, err := loadDockerConfig(path)
+	if err != nil {
+		return "", "", err
+	}
+	username, password, ok, err := config.credentials(registryHost(ref.Registry))
+	if err != nil {
+		return "", "", err
+	}
+	if !ok {
+		return "", "", fmt.Errorf("auth of the registry %q is not found in the Docker config %s", ref.Registry, path)
+	}
+	return username, password, nil
+}
+
+// dockerConfigPath returns the default Docker config file path, which is `$DOCKER_CONFIG/config.json`
+// or `~/.docker/config.json`.
+func dockerConfigPath() (string, error) {
+	dir := os.Getenv(dockerConfigEnvVar)
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+	return filepath.Join(dir, "config.json"), nil
+}
+
+// loadDockerConfig reads and parses the Docker config file.
+func loadDockerConfig(path string) (*dockerConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config dockerConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse the Docker config %s: %v", path, err)
+	}
+	return &config, nil
+}
+
+// credentials returns the username and password of the registry host in the same order as the Docker CLI,
+// which are the credential helper of the host, the default credential helper and the auth entries.
+// The ok is false if the credentials of the host are not found.
+func (c *dockerConfig) credentials(host string) (username, password string, ok bool, err error) {
+	for registry, helper := range c.CredHelpers {
+		if registryHost(registry) == host {
+			return dockerHelperGet(helper, host)
+		}
+	}
+	if c.CredsStore != "" {
+		if username, password, ok, err = dockerHelperGet(c.CredsStore, host); err != nil || ok {
+			return username, password, ok, err
+		}
+	}
+	for registry, auth := range c.Auths {
+		if registryHost(registry) != host {
+			continue
+		}
+		if auth.Auth == "" {
+			if auth.Username == "" && auth.Password == "" {
+				// The credentials are stored in the credential helper.
+				continue
+			}
+			return auth.Username, auth.Password, true, nil
+		}
+		decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+		if err != nil {
+			return "", "", false, fmt.Errorf("failed to decode the auth of the registry %q: %v", host, err)
+		}
+		username, password, ok := strings.Cut(string(decoded), ":")
+		if !ok {
+			return "", "", false, fmt.Errorf("invalid auth of the registry %q, must be in the form of username:password", host)
+		}
+		return username, password, true, nil
+	}
+	return "", "", false, nil
+}
+
+// dockerHelperGet gets the username and password of the registry host from the Docker credential helper,
+// see https://github.com/docker/docker-credential-helpers
+func dockerHelperGet(helper, host string) (username, password string, ok bool, err error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(dockerCredentialHelperPrefix+helper, "get")
+	cmd.Stdin = strings.NewReader(host)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if strings.Contains(stdout.String()+stderr.String(), dockerCredentialsNotFound) {
+			return "", "", false, nil
+		}
+		return "", "", false, fmt.Errorf("failed to get the credentials of the registry %q from the Docker credential helper %q: %v %s",
+			host, helper, err, strings.TrimSpace(stderr.String()))
+	}
+	var creds dockerHelperCredentials
+	if err := json.Unmarshal(stdout.Bytes(), &creds); err != nil {
+		return "", "", false, fmt.Errorf("failed to parse the output of the Docker credential helper %q: %v", helper, err)
+	}
+	return creds.Username, creds.Secret, true, nil
+}
+
+// registryHost returns the host of the registry address, e.g., https://index.docker.io/v1/ => index.docker.io
+func registryHost(registry string) string {
+	if i := strings.Index(registry, "://"); i >= 0 {
+		registry = registry[i+3:]
+	}
+	host, _, _ := strings.Cut(registry, "/")
+	return host
+}
+
+// validateCredentials checks that the inline credentials and the credential references are not set at the same time,
+// and the field is the path of the credentials used in the error messages.
+func validateCredentials(field string, cred *api.CredSpec) []error {
+	var errs []error
+	if cred.Username != "" && cred.UsernameFrom != nil {
+		errs = append(errs, fmt.Errorf("`%s.username` and `%s.usernameFrom` must not be set at the same time", field, field))
+	}
+	if cred.Password != "" && cred.PasswordFrom != nil {
+		errs = append(errs, fmt.Errorf("`%s.password` and `%s.passwordFrom` must not be set at the same time", field, field))
+	}
+	return errs
+}
+
+// validateHostCredentials checks that every host credentials have a valid host pattern.
+func validateHostCredentials(hostCreds []api.CredSpec) []error {
+	var errs []error
+	for i := range hostCreds {
+		field := fmt.Sprintf("hostCredentials[%d]", i)
+		if hostCreds[i].Url == "" {
+			errs = append(errs, fmt.Errorf("`%s.url` must not be empty", field))
+		} else if _, err := path.Match(registryHost(hostCreds[i].Url), ""); err != nil {
+			errs = append(errs, fmt.Errorf("invalid `%s.url` %q: %v", field, hostCreds[i].Url, err))
+		}
+		errs = append(errs, validateCredentials(field, &hostCreds[i])...)
+	}
+	return errs
+}
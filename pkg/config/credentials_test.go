@@ -0,0 +1,180 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"kcl-lang.io/krm-kcl/pkg/api"
+	src "kcl-lang.io/krm-kcl/pkg/source"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+func TestResolveCredentials(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	assert.NoError(t, os.WriteFile(passwordFile, []byte("secret\n"), 0600))
+	t.Setenv("KRM_KCL_TEST_USERNAME", "user")
+
+	cred, err := resolveCredentials("credentials", api.CredSpec{
+		Url:          "ghcr.io",
+		UsernameFrom: &api.ValueSource{Env: "KRM_KCL_TEST_USERNAME"},
+		PasswordFrom: &api.ValueSource{File: passwordFile},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "user", cred.Username)
+	assert.Equal(t, "secret", cred.Password)
+
+	_, err = resolveCredentials("credentials", api.CredSpec{
+		UsernameFrom: &api.ValueSource{Env: "KRM_KCL_TEST_NOT_FOUND"},
+	}, nil)
+	assert.EqualError(t, err, "failed to resolve `credentials.usernameFrom`: environment variable \"KRM_KCL_TEST_NOT_FOUND\" is not set")
+}
+
+func TestResolveCredentialsFromSecret(t *testing.T) {
+	secret := yaml.MustParse(`apiVersion: v1
+kind: Secret
+metadata:
+  name: registry
+  namespace: default
+  annotations:
+    config.kubernetes.io/local-config: "true"
+data:
+  password: c2VjcmV0
+stringData:
+  username: user
+`)
+	nodes := []*yaml.RNode{secret}
+
+	cred, err := resolveCredentials("credentials", api.CredSpec{
+		UsernameFrom: &api.ValueSource{SecretKeyRef: &api.SecretKeySelector{Name: "registry", Key: "username"}},
+		PasswordFrom: &api.ValueSource{SecretKeyRef: &api.SecretKeySelector{Name: "registry", Namespace: "default", Key: "password"}},
+	}, nodes)
+	assert.NoError(t, err)
+	assert.Equal(t, "user", cred.Username)
+	assert.Equal(t, "secret", cred.Password)
+
+	_, err = resolveCredentials("credentials", api.CredSpec{
+		PasswordFrom: &api.ValueSource{SecretKeyRef: &api.SecretKeySelector{Name: "registry", Namespace: "other", Key: "password"}},
+	}, nodes)
+	assert.EqualError(t, err, "failed to resolve `credentials.passwordFrom`: Secret \"registry\" is not found in the input resources")
+
+	_, err = resolveCredentials("credentials", api.CredSpec{
+		PasswordFrom: &api.ValueSource{SecretKeyRef: &api.SecretKeySelector{Name: "registry", Key: "token"}},
+	}, nodes)
+	assert.EqualError(t, err, "failed to resolve `credentials.passwordFrom`: key \"token\" is not found in the Secret \"registry\"")
+}
+
+func TestResolveCredentialsFromDockerConfig(t *testing.T) {
+	dir := t.TempDir()
+	// base64("user:secret")
+	config := `{"auths": {"https://ghcr.io/v1/": {"auth": "dXNlcjpzZWNyZXQ="}, "docker.io": {"username": "foo", "password": "bar"}}}`
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0600))
+	t.Setenv(dockerConfigEnvVar, dir)
+
+	cred, err := resolveCredentials("credentials", api.CredSpec{
+		UsernameFrom: &api.ValueSource{DockerConfig: &api.DockerConfigSelector{Registry: "ghcr.io"}},
+		PasswordFrom: &api.ValueSource{DockerConfig: &api.DockerConfigSelector{Registry: "ghcr.io"}},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "user", cred.Username)
+	assert.Equal(t, "secret", cred.Password)
+
+	cred, err = resolveCredentials("credentials", api.CredSpec{
+		PasswordFrom: &api.ValueSource{DockerConfig: &api.DockerConfigSelector{Registry: "https://docker.io", Path: filepath.Join(dir, "config.json")}},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "bar", cred.Password)
+
+	_, err = resolveCredentials("credentials", api.CredSpec{
+		UsernameFrom: &api.ValueSource{Env: "KRM_KCL_TEST_USERNAME", DockerConfig: &api.DockerConfigSelector{Registry: "ghcr.io"}},
+	}, nil)
+	assert.EqualError(t, err, "failed to resolve `credentials.usernameFrom`: exactly one of `value`, `env`, `file`, `secretKeyRef` and `dockerConfig` must be set")
+}
+
+func TestCredentialStoreLookup(t *testing.T) {
+	dir := t.TempDir()
+	config := `{
+  "auths": {"https://index.docker.io/v1/": {"auth": "ZG9ja2VyOmh1Yg=="}, "helper.example.com": {}},
+  "credHelpers": {"helper.example.com": "fake"}
+}`
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0600))
+	t.Setenv(dockerConfigEnvVar, dir)
+	if runtime.GOOS != "windows" {
+		helper := "#!/bin/sh\nread host\necho '{\"ServerURL\":\"'$host'\",\"Username\":\"helper\",\"Secret\":\"helper-secret\"}'\n"
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, dockerCredentialHelperPrefix+"fake"), []byte(helper), 0700))
+		t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	}
+	t.Setenv("KRM_KCL_TEST_TOKEN", "gitlab-token")
+
+	redactor := src.NewRedactor()
+	store, err := newCredentialStore(api.CredSpec{Url: "https://ghcr.io", Username: "user", Password: "password"}, []api.CredSpec{
+		{Url: "ghcr.io", Username: "other", Password: "other"},
+		{Url: "*.example.com", Username: "gitlab", PasswordFrom: &api.ValueSource{Env: "KRM_KCL_TEST_TOKEN"}},
+	}, nil, redactor)
+	assert.NoError(t, err)
+
+	testcases := []struct {
+		host   string
+		expect *api.CredSpec
+	}{
+		{"ghcr.io", &api.CredSpec{Url: "ghcr.io", Username: "user", Password: "password"}},
+		{"gitlab.example.com", &api.CredSpec{Url: "gitlab.example.com", Username: "gitlab", Password: "gitlab-token"}},
+		{"index.docker.io", &api.CredSpec{Url: "index.docker.io", Username: "docker", Password: "hub"}},
+		{"quay.io", nil},
+		{"", nil},
+	}
+	if runtime.GOOS != "windows" {
+		testcases = append(testcases, struct {
+			host   string
+			expect *api.CredSpec
+		}{"helper.example.com", &api.CredSpec{Url: "helper.example.com", Username: "gitlab", Password: "gitlab-token"}})
+	}
+	for _, tc := range testcases {
+		cred, err := store.Lookup(tc.host)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expect, cred, tc.host)
+	}
+	assert.Equal(t, "token xxxxx", redactor.Redact("token gitlab-token"))
+
+	// The credential helper is used when there are no matched host credentials.
+	if runtime.GOOS != "windows" {
+		store, err = newCredentialStore(api.CredSpec{}, nil, nil, redactor)
+		assert.NoError(t, err)
+		cred, err := store.Lookup("helper.example.com")
+		assert.NoError(t, err)
+		assert.Equal(t, &api.CredSpec{Url: "helper.example.com", Username: "helper", Password: "helper-secret"}, cred)
+		assert.Equal(t, "xxxxx", redactor.Redact("helper-secret"))
+	}
+}
+
+func TestKCLRunCredentials(t *testing.T) {
+	t.Setenv(dockerConfigEnvVar, t.TempDir())
+	secret := yaml.MustParse(`apiVersion: v1
+kind: Secret
+metadata:
+  name: git-token
+data:
+  token: dG9rZW4=
+`)
+	r := &KCLRun{}
+	r.Spec.Source = "github.com/kcl-lang/private//main.k"
+	r.Spec.Credentials = api.CredSpec{Username: "user", Password: "password"}
+	r.Spec.HostCredentials = []api.CredSpec{
+		{Url: "gitlab.com", Username: "gitlab", PasswordFrom: &api.ValueSource{SecretKeyRef: &api.SecretKeySelector{Name: "git-token", Key: "token"}}},
+	}
+	creds, err := r.Credentials([]*yaml.RNode{secret})
+	assert.NoError(t, err)
+
+	// The credentials without the `url` are the credentials of the source host.
+	cred, err := creds("github.com")
+	assert.NoError(t, err)
+	assert.Equal(t, &api.CredSpec{Url: "github.com", Username: "user", Password: "password"}, cred)
+	cred, err = creds("gitlab.com")
+	assert.NoError(t, err)
+	assert.Equal(t, &api.CredSpec{Url: "gitlab.com", Username: "gitlab", Password: "token"}, cred)
+	cred, err = creds("ghcr.io")
+	assert.NoError(t, err)
+	assert.Nil(t, cred)
+}
@@ -1,7 +1,45 @@
 package config
 
+import (
+	"fmt"
+	"time"
+
+	"kcl-lang.io/krm-kcl/pkg/api"
+)
+
 const (
 	SrcUrlEnvVar         = "KCL_SRC_URL"
 	SrcUrlUsernameEnvVar = "KCL_SRC_USERNAME"
 	SrcUrlPasswordEnvVar = "KCL_SRC_PASSWORD"
+	ProfileEnvVar        = "KCL_PROFILE"
+	TimeoutEnvVar        = "KCL_TIMEOUT"
 )
+
+// validateEnv validates the environment variables exposed to the KCL program and returns all the violations.
+func validateEnv(env []api.EnvVar) []error {
+	var errs []error
+	for i, e := range env {
+		field := fmt.Sprintf("%s[%d]", api.EnvKey, i)
+		switch {
+		case e.Name == "" && e.Prefix == "":
+			errs = append(errs, fmt.Errorf("one of `%s.name` and `%s.prefix` must be set", field, field))
+		case e.Name != "" && e.Prefix != "":
+			errs = append(errs, fmt.Errorf("`%s.name` and `%s.prefix` must not be set at the same time", field, field))
+		case e.Prefix != "" && e.Value != nil:
+			errs = append(errs, fmt.Errorf("`%s.value` must not be set with `%s.prefix`", field, field))
+		}
+	}
+	return errs
+}
+
+// parseTimeout parses the timeout of the field, e.g., "30s", which must be positive.
+func parseTimeout(field, value string) (time.Duration, error) {
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid `%s` %q: %v", field, value, err)
+	}
+	if timeout <= 0 {
+		return 0, fmt.Errorf("invalid `%s` %q: must be positive", field, value)
+	}
+	return timeout, nil
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeout(t *testing.T) {
+	testcases := []struct {
+		name          string
+		spec          string
+		option        time.Duration
+		env           string
+		expectTimeout time.Duration
+		expectErrMsg  string
+	}{
+		{
+			name: "no timeout",
+		},
+		{
+			name:          "env",
+			env:           "1m",
+			expectTimeout: time.Minute,
+		},
+		{
+			name:          "option overrides env",
+			option:        30 * time.Second,
+			env:           "1m",
+			expectTimeout: 30 * time.Second,
+		},
+		{
+			name:          "spec overrides option",
+			spec:          "10s",
+			option:        30 * time.Second,
+			env:           "1m",
+			expectTimeout: 10 * time.Second,
+		},
+		{
+			name:         "invalid spec",
+			spec:         "abc",
+			expectErrMsg: "invalid `timeout` \"abc\": time: invalid duration \"abc\"",
+		},
+		{
+			name:         "non-positive env",
+			env:          "0s",
+			expectErrMsg: "invalid `KCL_TIMEOUT` \"0s\": must be positive",
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(TimeoutEnvVar, tc.env)
+			r := New()
+			r.Spec.Timeout = tc.spec
+			timeout, err := r.WithOptions(Options{Timeout: tc.option}).Timeout()
+			if tc.expectErrMsg != "" {
+				assert.EqualError(t, err, tc.expectErrMsg)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectTimeout, timeout)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"kcl-lang.io/krm-kcl/pkg/api"
+	"kcl-lang.io/krm-kcl/pkg/edit"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const (
+	// AnnotationLocalConfig is the annotation key of the local config resources which are not applied to the cluster.
+	AnnotationLocalConfig = "config.kubernetes.io/local-config"
+	// paramsFromAnnotation marks the input resources referenced by the `paramsFrom` during the function run.
+	paramsFromAnnotation = "internal.krm.kcl.dev/params-from"
+)
+
+// dataResource is the data of a ConfigMap or a Secret resource.
+type dataResource struct {
+	Data       map[string]string `yaml:"data,omitempty"`
+	StringData map[string]string `yaml:"stringData,omitempty"`
+}
+
+// findDataResource returns the index of the ConfigMap or Secret with the name in the nodes, and the resource
+// in any namespace is matched if the namespace is empty. It returns -1 if the resource is not found.
+func findDataResource(nodes []*yaml.RNode, kind, name, namespace string) int {
+	for i, n := range nodes {
+		if n.GetApiVersion() == coreAPIVersion && n.GetKind() == kind && n.GetName() == name &&
+			(namespace == "" || n.GetNamespace() == namespace) {
+			return i
+		}
+	}
+	return -1
+}
+
+// resourceData returns the decoded data of the ConfigMap or Secret. The Secret `data` values are base64-decoded
+// and the `stringData` values take precedence over them.
+func resourceData(n *yaml.RNode) (map[string]string, error) {
+	var r dataResource
+	if err := yaml.Unmarshal([]byte(n.MustString()), &r); err != nil {
+		return nil, err
+	}
+	if n.GetKind() != secretKind {
+		return r.Data, nil
+	}
+	data := make(map[string]string, len(r.Data)+len(r.StringData))
+	for k, v := range r.Data {
+		decoded, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode the key %q of the Secret %q: %v", k, n.GetName(), err)
+		}
+		data[k] = string(decoded)
+	}
+	for k, v := range r.StringData {
+		data[k] = v
+	}
+	return data, nil
+}
+
+// resolveParams returns the params deep-merged from the `paramsFrom` resources in order, the inline `params`
+// and the overlay of the active profile, and the latter layers take precedence. The referenced resources in
+// the nodes are marked.
+func (r *KCLRun) resolveParams(nodes []*yaml.RNode, profile string) (map[string]interface{}, error) {
+	params := map[string]interface{}{}
+	for i, ref := range r.Spec.ParamsFrom {
+		idx := findDataResource(nodes, ref.Kind, ref.Name, ref.Namespace)
+		if idx < 0 {
+			return nil, fmt.Errorf("failed to resolve `paramsFrom[%d]`: %s %q is not found in the input resources", i, ref.Kind, ref.Name)
+		}
+		data, err := resourceData(nodes[idx])
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve `paramsFrom[%d]`: %v", i, err)
+		}
+		values := map[string]interface{}{}
+		if ref.Key == "" {
+			for k, v := range data {
+				values[k] = v
+			}
+		} else {
+			v, ok := data[ref.Key]
+			if !ok {
+				return nil, fmt.Errorf("failed to resolve `paramsFrom[%d]`: key %q is not found in the %s %q", i, ref.Key, ref.Kind, ref.Name)
+			}
+			if err := yaml.Unmarshal([]byte(v), &values); err != nil {
+				return nil, fmt.Errorf("failed to resolve `paramsFrom[%d]`: the key %q of the %s %q must be a YAML object: %v", i, ref.Key, ref.Kind, ref.Name, err)
+			}
+		}
+		params = edit.MergeParams(params, values, &r.Spec.ParamsMerge)
+		// Mark a copy of the referenced resource to keep the input nodes unchanged.
+		nodes[idx] = nodes[idx].Copy()
+		if err := nodes[idx].PipeE(yaml.SetAnnotation(paramsFromAnnotation, "true")); err != nil {
+			return nil, err
+		}
+	}
+	params = edit.MergeParams(params, r.Spec.Params, &r.Spec.ParamsMerge)
+	if profile != "" {
+		params = edit.MergeParams(params, r.Spec.Profiles[profile], &r.Spec.ParamsMerge)
+	}
+	return params, nil
+}
+
+// withParams returns a copy of the function config with the `spec.params` replaced by the params.
+func withParams(fnCfg *yaml.RNode, params map[string]interface{}) (*yaml.RNode, error) {
+	v, err := yaml.FromMap(params)
+	if err != nil {
+		return nil, err
+	}
+	fnCfg = fnCfg.Copy()
+	if _, err := fnCfg.Pipe(yaml.LookupCreate(yaml.MappingNode, "spec"), yaml.SetField(api.ParamsKey, v)); err != nil {
+		return nil, err
+	}
+	return fnCfg, nil
+}
+
+// dropParamsFromNodes removes the marks of the `paramsFrom` resources in the output nodes, and drops the
+// marked resources which are local config.
+func dropParamsFromNodes(nodes []*yaml.RNode) ([]*yaml.RNode, error) {
+	var out []*yaml.RNode
+	for _, n := range nodes {
+		annotations := n.GetAnnotations()
+		if _, ok := annotations[paramsFromAnnotation]; !ok {
+			out = append(out, n)
+			continue
+		}
+		if isOk(annotations[AnnotationLocalConfig]) {
+			continue
+		}
+		if _, err := n.Pipe(yaml.ClearAnnotation(paramsFromAnnotation)); err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
@@ -0,0 +1,267 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"kcl-lang.io/krm-kcl/pkg/api"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+func TestResolveParams(t *testing.T) {
+	configMap := yaml.MustParse(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: values
+  namespace: prod
+  annotations:
+    config.kubernetes.io/local-config: "true"
+data:
+  values.yaml: |
+    replicas: 3
+    labels:
+      env: prod
+      team: platform
+`)
+	secret := yaml.MustParse(`apiVersion: v1
+kind: Secret
+metadata:
+  name: secret-values
+data:
+  token: c2VjcmV0
+stringData:
+  user: admin
+`)
+	nodes := []*yaml.RNode{configMap, secret}
+
+	r := New()
+	r.Spec.ParamsFrom = []api.ParamsFromSource{
+		{Kind: "ConfigMap", Name: "values", Namespace: "prod", Key: "values.yaml"},
+		{Kind: "Secret", Name: "secret-values"},
+	}
+	r.Spec.Params = map[string]interface{}{
+		"labels": map[string]interface{}{"team": "app"},
+	}
+	params, err := r.resolveParams(nodes, "")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"replicas": 3,
+		"labels":   map[string]interface{}{"env": "prod", "team": "app"},
+		"token":    "secret",
+		"user":     "admin",
+	}, params)
+	// The referenced resources are marked on the copies.
+	assert.Equal(t, "true", nodes[0].GetAnnotations()[paramsFromAnnotation])
+	assert.NotContains(t, configMap.GetAnnotations(), paramsFromAnnotation)
+
+	out, err := dropParamsFromNodes(nodes)
+	assert.NoError(t, err)
+	assert.Len(t, out, 1)
+	assert.Equal(t, "secret-values", out[0].GetName())
+	assert.NotContains(t, out[0].GetAnnotations(), paramsFromAnnotation)
+
+	testcases := []struct {
+		name         string
+		ref          api.ParamsFromSource
+		expectErrMsg string
+	}{
+		{
+			name:         "resource not found",
+			ref:          api.ParamsFromSource{Kind: "ConfigMap", Name: "values", Namespace: "dev"},
+			expectErrMsg: "failed to resolve `paramsFrom[0]`: ConfigMap \"values\" is not found in the input resources",
+		},
+		{
+			name:         "key not found",
+			ref:          api.ParamsFromSource{Kind: "Secret", Name: "secret-values", Key: "password"},
+			expectErrMsg: "failed to resolve `paramsFrom[0]`: key \"password\" is not found in the Secret \"secret-values\"",
+		},
+		{
+			name:         "value is not an object",
+			ref:          api.ParamsFromSource{Kind: "Secret", Name: "secret-values", Key: "token"},
+			expectErrMsg: "failed to resolve `paramsFrom[0]`: the key \"token\" of the Secret \"secret-values\" must be a YAML object",
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := New()
+			r.Spec.ParamsFrom = []api.ParamsFromSource{tc.ref}
+			_, err := r.resolveParams([]*yaml.RNode{configMap, secret}, "")
+			assert.ErrorContains(t, err, tc.expectErrMsg)
+		})
+	}
+}
+
+func TestWithParams(t *testing.T) {
+	fnCfg := yaml.MustParse(`apiVersion: krm.kcl.dev/v1alpha1
+kind: KCLRun
+metadata:
+  name: my-kcl-fn
+spec:
+  source: a = 1
+  params:
+    foo: bar
+`)
+	out, err := withParams(fnCfg, map[string]interface{}{"foo": "baz", "replicas": 3})
+	assert.NoError(t, err)
+	assert.Equal(t, `apiVersion: krm.kcl.dev/v1alpha1
+kind: KCLRun
+metadata:
+  name: my-kcl-fn
+spec:
+  source: a = 1
+  params:
+    foo: baz
+    replicas: 3
+`, out.MustString())
+	// The function config is unchanged.
+	assert.Contains(t, fnCfg.MustString(), "foo: bar")
+}
+
+func TestResolveParamsWithProfile(t *testing.T) {
+	r := New()
+	r.Spec.Params = map[string]interface{}{
+		"replicas": 1,
+		"containers": []interface{}{
+			map[string]interface{}{"name": "app", "image": "app:v1"},
+			map[string]interface{}{"name": "sidecar", "image": "sidecar:v1"},
+		},
+	}
+	r.Spec.Profiles = map[string]map[string]interface{}{
+		"prod": {
+			"replicas": 3,
+			"containers": []interface{}{
+				map[string]interface{}{"name": "app", "image": "app:v2"},
+				map[string]interface{}{"name": "proxy", "image": "proxy:v1"},
+			},
+		},
+	}
+	testcases := []struct {
+		name         string
+		paramsMerge  api.ParamsMergeSpec
+		profile      string
+		expectParams map[string]interface{}
+	}{
+		{
+			name:         "no profile",
+			expectParams: r.Spec.Params,
+		},
+		{
+			name:    "replace lists",
+			profile: "prod",
+			expectParams: map[string]interface{}{
+				"replicas":   3,
+				"containers": r.Spec.Profiles["prod"]["containers"],
+			},
+		},
+		{
+			name:        "append lists",
+			paramsMerge: api.ParamsMergeSpec{Lists: api.AppendListMerge},
+			profile:     "prod",
+			expectParams: map[string]interface{}{
+				"replicas": 3,
+				"containers": []interface{}{
+					map[string]interface{}{"name": "app", "image": "app:v1"},
+					map[string]interface{}{"name": "sidecar", "image": "sidecar:v1"},
+					map[string]interface{}{"name": "app", "image": "app:v2"},
+					map[string]interface{}{"name": "proxy", "image": "proxy:v1"},
+				},
+			},
+		},
+		{
+			name:        "merge lists by key",
+			paramsMerge: api.ParamsMergeSpec{Lists: api.MergeByKeyListMerge},
+			profile:     "prod",
+			expectParams: map[string]interface{}{
+				"replicas": 3,
+				"containers": []interface{}{
+					map[string]interface{}{"name": "app", "image": "app:v2"},
+					map[string]interface{}{"name": "sidecar", "image": "sidecar:v1"},
+					map[string]interface{}{"name": "proxy", "image": "proxy:v1"},
+				},
+			},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			r.Spec.ParamsMerge = tc.paramsMerge
+			params, err := r.resolveParams(nil, tc.profile)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectParams, params)
+		})
+	}
+	// The layers are unchanged.
+	assert.Equal(t, "app:v1", r.Spec.Params["containers"].([]interface{})[0].(map[string]interface{})["image"])
+}
+
+func TestActiveProfile(t *testing.T) {
+	testcases := []struct {
+		name          string
+		annotation    string
+		env           string
+		option        string
+		profiles      []string
+		expectProfile string
+		expectErrMsg  string
+	}{
+		{
+			name: "no profile",
+		},
+		{
+			name:          "annotation",
+			annotation:    "dev",
+			profiles:      []string{"dev", "prod"},
+			expectProfile: "dev",
+		},
+		{
+			name:          "env overrides annotation",
+			annotation:    "dev",
+			env:           "prod",
+			profiles:      []string{"dev", "prod"},
+			expectProfile: "prod",
+		},
+		{
+			name:          "option overrides env",
+			env:           "dev",
+			option:        "prod",
+			profiles:      []string{"dev", "prod"},
+			expectProfile: "prod",
+		},
+		{
+			name:   "option without profiles",
+			option: "prod",
+		},
+		{
+			name:         "profile not found",
+			option:       "staging",
+			profiles:     []string{"dev", "prod"},
+			expectErrMsg: "profile \"staging\" is not found in `profiles`",
+		},
+		{
+			name:         "annotation without profiles",
+			annotation:   "prod",
+			expectErrMsg: "profile \"prod\" is not found in `profiles`",
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(ProfileEnvVar, tc.env)
+			r := New()
+			if tc.annotation != "" {
+				r.ObjectMeta.Annotations = map[string]string{AnnotationProfile: tc.annotation}
+			}
+			for _, p := range tc.profiles {
+				if r.Spec.Profiles == nil {
+					r.Spec.Profiles = map[string]map[string]interface{}{}
+				}
+				r.Spec.Profiles[p] = map[string]interface{}{}
+			}
+			profile, err := r.WithOptions(Options{Profile: tc.option}).ActiveProfile()
+			if tc.expectErrMsg != "" {
+				assert.EqualError(t, err, tc.expectErrMsg)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectProfile, profile)
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	openapierrors "k8s.io/kube-openapi/pkg/validation/errors"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+	"k8s.io/kube-openapi/pkg/validation/strfmt"
+	"k8s.io/kube-openapi/pkg/validation/validate"
+	"kcl-lang.io/krm-kcl/pkg/api"
+	"kcl-lang.io/krm-kcl/pkg/api/v1alpha1"
+	"kcl-lang.io/krm-kcl/pkg/api/v1beta1"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+	k8syaml "sigs.k8s.io/yaml"
+)
+
+//go:generate go run ../../scripts/gen-schema ../../config
+
+const (
+	// KCLRunPlural is the plural name of the KCLRun resource used in the CRD.
+	KCLRunPlural = "kclruns"
+	// CRDFile is the generated CRD manifest file path of the KCLRun resource.
+	CRDFile = "crd/krm.kcl.dev_kclruns.yaml"
+	// preserveUnknownFieldsExtension is the OpenAPI extension for the free-form objects.
+	preserveUnknownFieldsExtension = "x-kubernetes-preserve-unknown-fields"
+)
+
+// KCLRunAPIVersions are the supported API versions of the KCLRun resource.
+var KCLRunAPIVersions = []string{v1alpha1.KCLRunAPIVersion, v1beta1.KCLRunAPIVersion}
+
+var (
+	openAPISchemas     map[string]*spec.Schema
+	openAPISchemasOnce sync.Once
+)
+
+// fieldSchemas are the additional constraints of the KCLRun fields keyed by the json field name,
+// which can not be inferred from the Go types.
+var fieldSchemas = map[string]func(s *spec.Schema){
+	"enforcementAction": func(s *spec.Schema) {
+		s.WithEnum(api.DenyAction, api.WarnAction, api.DryRunAction)
+	},
+	"scope": func(s *spec.Schema) {
+		s.WithEnum(api.ClusterScope, api.NamespacedScope, api.AllScopes)
+	},
+	"operator": func(s *spec.Schema) {
+		s.WithEnum("In", "NotIn", "Exists", "DoesNotExist")
+	},
+	"arguments": func(s *spec.Schema) {
+		// The top level arguments must be in the form of key=value, e.g., env="prod"
+		s.Items.Schema.WithPattern(`^[^=\s]+=`)
+	},
+	"resourceRules": func(s *spec.Schema) {
+		// An empty rule is most likely a typo, use `kinds: ["*"]` to match all the resources.
+		s.Items.Schema.WithMinProperties(1)
+	},
+	"excludeResourceRules": func(s *spec.Schema) {
+		s.Items.Schema.WithMinProperties(1)
+	},
+	"paramsFrom": func(s *spec.Schema) {
+		// The `kind` field name is shared with the resource kind, so the enum is set on the items.
+		kind := s.Items.Schema.Properties["kind"]
+		kind.WithEnum(ConfigMapKind, secretKind)
+		s.Items.Schema.Properties["kind"] = kind
+	},
+	"lists": func(s *spec.Schema) {
+		s.WithEnum(api.ReplaceListMerge, api.AppendListMerge, api.MergeByKeyListMerge)
+	},
+	"maxOutputSize": func(s *spec.Schema) {
+		s.WithMinimum(0, false)
+	},
+	"steps": func(s *spec.Schema) {
+		s.WithMinItems(1)
+	},
+	"usernameFrom": func(s *spec.Schema) {
+		// Exactly one of the value references must be set.
+		s.WithMinProperties(1).WithMaxProperties(1)
+	},
+	"passwordFrom": func(s *spec.Schema) {
+		s.WithMinProperties(1).WithMaxProperties(1)
+	},
+}
+
+// OpenAPISchema returns the OpenAPI v3 schema of the v1alpha1 KCLRun resource generated from the KCLRun Go type.
+func OpenAPISchema() *spec.Schema {
+	return OpenAPISchemaFor(v1alpha1.KCLRunAPIVersion)
+}
+
+// OpenAPISchemaFor returns the OpenAPI v3 schema of the KCLRun resource with the API version,
+// or nil if the API version is not supported.
+func OpenAPISchemaFor(apiVersion string) *spec.Schema {
+	openAPISchemasOnce.Do(func() {
+		openAPISchemas = map[string]*spec.Schema{
+			v1alpha1.KCLRunAPIVersion: typeSchema(reflect.TypeOf(KCLRun{})),
+			v1beta1.KCLRunAPIVersion:  typeSchema(reflect.TypeOf(v1beta1.KCLRun{})),
+		}
+		for _, s := range openAPISchemas {
+			s.WithDescription("KCLRun is used to run the KCL source with the params and config on the KRM resources.")
+		}
+	})
+	return openAPISchemas[apiVersion]
+}
+
+// OpenAPISchemaFile returns the generated OpenAPI v3 schema file path of the KCLRun resource with the API version.
+func OpenAPISchemaFile(apiVersion string) string {
+	return fmt.Sprintf("openapi/%s_kclrun.json", strings.ReplaceAll(apiVersion, "/", "_"))
+}
+
+// CustomResourceDefinition returns the CRD manifest of the KCLRun resource. Only the v1alpha1 version
+// is served because the API server can not convert between the versions without a conversion webhook.
+func CustomResourceDefinition() ([]byte, error) {
+	crd := map[string]interface{}{
+		"apiVersion": "apiextensions.k8s.io/v1",
+		"kind":       "CustomResourceDefinition",
+		"metadata": map[string]interface{}{
+			"name": KCLRunPlural + "." + v1alpha1.KCLRunGroup,
+		},
+		"spec": map[string]interface{}{
+			"group": v1alpha1.KCLRunGroup,
+			"names": map[string]interface{}{
+				"kind":     api.KCLRunKind,
+				"listKind": api.KCLRunKind + "List",
+				"plural":   KCLRunPlural,
+				"singular": strings.ToLower(api.KCLRunKind),
+			},
+			"scope": "Namespaced",
+			"versions": []interface{}{
+				map[string]interface{}{
+					"name":    v1alpha1.KCLRunVersion,
+					"served":  true,
+					"storage": true,
+					"schema": map[string]interface{}{
+						"openAPIV3Schema": OpenAPISchema(),
+					},
+				},
+			},
+		},
+	}
+	data, err := json.Marshal(crd)
+	if err != nil {
+		return nil, err
+	}
+	return k8syaml.JSONToYAML(data)
+}
+
+// ValidateSchema validates the KCLRun resource in the JSON object form against the KCLRun OpenAPI schema
+// of its API version and returns all the violations with the field paths.
+func ValidateSchema(obj map[string]interface{}) []error {
+	apiVersion, _ := obj["apiVersion"].(string)
+	schema := OpenAPISchemaFor(apiVersion)
+	if schema == nil {
+		return []error{fmt.Errorf("unsupported KCLRun API version %q", apiVersion)}
+	}
+	var errs []error
+	for _, err := range validate.NewSchemaValidator(schema, nil, "", strfmt.Default).Validate(obj).Errors {
+		// The anyOf failures, e.g., the invalid structured source, are reported by the errors of the
+		// best matching schema, which have the field paths.
+		if e, ok := err.(interface{ Code() int32 }); ok && e.Code() == openapierrors.CompositeErrorCode {
+			continue
+		}
+		errs = append(errs, err)
+	}
+	// Sort the errors by the messages to get a stable output.
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errs
+}
+
+// typeSchema returns the OpenAPI schema of the Go type using the json field names.
+func typeSchema(t reflect.Type) *spec.Schema {
+	switch t {
+	case reflect.TypeOf(yaml.ObjectMeta{}):
+		// The object metadata is validated by the API server.
+		return &spec.Schema{SchemaProps: spec.SchemaProps{Type: spec.StringOrArray{"object"}}}
+	case reflect.TypeOf(v1beta1.SourceSpec{}):
+		// The source is the string shorthand or the structured source with exactly one of the source fields.
+		// The structured source is not decoded strictly, so the unknown fields are forbidden by the schema.
+		s := &spec.Schema{SchemaProps: spec.SchemaProps{
+			Type:       spec.StringOrArray{"object"},
+			Properties: map[string]spec.Schema{},
+		}}
+		addStructProperties(s, t)
+		forbidUnknownFields(s)
+		s.WithMinProperties(1).WithMaxProperties(1)
+		return &spec.Schema{SchemaProps: spec.SchemaProps{AnyOf: []spec.Schema{*spec.StringProperty(), *s}}}
+	case reflect.TypeOf(v1beta1.ParamValue{}):
+		// The param values can be any JSON values.
+		s := &spec.Schema{}
+		s.AddExtension(preserveUnknownFieldsExtension, true)
+		return s
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(t.Elem())
+	case reflect.String:
+		return spec.StringProperty()
+	case reflect.Bool:
+		return spec.BoolProperty()
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return spec.Int64Property()
+	case reflect.Slice:
+		return spec.ArrayProperty(typeSchema(t.Elem()))
+	case reflect.Map:
+		if t.Elem().Kind() == reflect.Interface {
+			s := &spec.Schema{SchemaProps: spec.SchemaProps{Type: spec.StringOrArray{"object"}}}
+			s.AddExtension(preserveUnknownFieldsExtension, true)
+			return s
+		}
+		return spec.MapProperty(typeSchema(t.Elem()))
+	case reflect.Struct:
+		s := &spec.Schema{SchemaProps: spec.SchemaProps{
+			Type:       spec.StringOrArray{"object"},
+			Properties: map[string]spec.Schema{},
+		}}
+		addStructProperties(s, t)
+		return s
+	default:
+		// Free-form values, e.g., interface{}
+		s := &spec.Schema{}
+		s.AddExtension(preserveUnknownFieldsExtension, true)
+		return s
+	}
+}
+
+// addStructProperties adds the exported fields of the struct type into the object schema,
+// and the fields without the `omitempty` json option are required.
+func addStructProperties(s *spec.Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		tag := strings.Split(f.Tag.Get("json"), ",")
+		name := tag[0]
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			addStructProperties(s, f.Type)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		property := typeSchema(f.Type)
+		if fn, ok := fieldSchemas[name]; ok {
+			fn(property)
+		}
+		if !sets.New(tag[1:]...).Has("omitempty") {
+			s.AddRequired(name)
+		} else if property.Type.Contains("array") || (property.Type.Contains("object") && name != "metadata") {
+			// The optional lists and objects can be null in YAML, e.g., `resourceRules:`
+			property.AsNullable()
+		}
+		s.SetProperty(name, *property)
+	}
+}
+
+// forbidUnknownFields forbids the unknown fields of the object schema and its object properties.
+func forbidUnknownFields(s *spec.Schema) {
+	s.AdditionalProperties = &spec.SchemaOrBool{Allows: false}
+	for name, property := range s.Properties {
+		if property.Type.Contains("object") {
+			forbidUnknownFields(&property)
+			s.Properties[name] = property
+		}
+	}
+}
+
+// objectValue returns the JSON object form of the value.
+func objectValue(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, fmt.Errorf("failed to convert to a JSON object: %v", err)
+	}
+	return obj, nil
+}
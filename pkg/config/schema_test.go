@@ -0,0 +1,106 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+func TestGeneratedSchema(t *testing.T) {
+	crd, err := CustomResourceDefinition()
+	assert.NoError(t, err)
+	files := map[string][]byte{CRDFile: crd}
+	for _, apiVersion := range KCLRunAPIVersions {
+		schema, err := json.MarshalIndent(OpenAPISchemaFor(apiVersion), "", "  ")
+		assert.NoError(t, err)
+		files[OpenAPISchemaFile(apiVersion)] = append(schema, '\n')
+	}
+	for path, want := range files {
+		got, err := os.ReadFile(filepath.Join("..", "..", "config", path))
+		assert.NoError(t, err)
+		assert.Equal(t, string(want), string(got), "%s is out of date, run `make gen` to regenerate it", path)
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	testcases := []struct {
+		name       string
+		config     string
+		expectErrs []string
+	}{
+		{
+			name: "valid KCLRun",
+			config: `apiVersion: krm.kcl.dev/v1alpha1
+kind: KCLRun
+metadata:
+  name: my-kcl-fn
+spec:
+  source: oci://ghcr.io/kcl-lang/set-annotation
+  params:
+    annotations:
+      managed-by: krm-kcl
+  config:
+    arguments: ['env="prod"']
+  matchConstraints:
+    resourceRules:
+    - kinds: ["Deployment"]
+      scope: Namespaced
+    objectSelector:
+      matchExpressions:
+      - key: app
+        operator: Exists
+`,
+		},
+		{
+			name: "invalid field values",
+			config: `apiVersion: krm.kcl.dev/v1alpha1
+kind: KCLRun
+metadata:
+  name: my-kcl-fn
+spec:
+  source: 1
+  enforcementAction: audit
+  config:
+    vendor: "true"
+  matchConstraints:
+    matchConditions:
+    - name: has-replicas
+`,
+			expectErrs: []string{
+				`spec.source in body must be of type string: "integer"`,
+				`spec.enforcementAction in body should be one of [deny warn dryrun]`,
+				`spec.config.vendor in body must be of type boolean: "string"`,
+				`spec.matchConstraints.matchConditions[0].expression in body is required`,
+			},
+		},
+		{
+			name: "empty steps",
+			config: `apiVersion: krm.kcl.dev/v1alpha1
+kind: KCLRun
+metadata:
+  name: my-kcl-fn
+spec:
+  steps: []
+`,
+			expectErrs: []string{
+				`spec.steps in body should have at least 1 items`,
+			},
+		},
+	}
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var obj map[string]interface{}
+			assert.NoError(t, yaml.Unmarshal([]byte(tc.config), &obj))
+			var errs []string
+			for _, err := range ValidateSchema(obj) {
+				errs = append(errs, err.Error())
+			}
+			assert.ElementsMatch(t, tc.expectErrs, errs)
+		})
+	}
+}
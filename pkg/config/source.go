@@ -0,0 +1,335 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"kcl-lang.io/krm-kcl/pkg/api"
+	"kcl-lang.io/krm-kcl/pkg/api/v1beta1"
+	src "kcl-lang.io/krm-kcl/pkg/source"
+)
+
+const (
+	inlineSource = "inline"
+	localSource  = src.LocalSourceName
+	ociSource    = src.OCISourceName
+	gitSource    = src.GitSourceName
+	httpSource   = src.HttpSourceName
+)
+
+var (
+	// ociRegistryRegexp matches the OCI registry hosts with the optional ports, e.g., ghcr.io or localhost:5001
+	ociRegistryRegexp = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)*(:[0-9]+)?$`)
+	// ociRepositoryRegexp matches the OCI repository names of the distribution spec, e.g., kcl-lang/set-annotation
+	ociRepositoryRegexp = regexp.MustCompile(`^[a-z0-9]+((\.|_|__|-+)[a-z0-9]+)*(/[a-z0-9]+((\.|_|__|-+)[a-z0-9]+)*)*$`)
+	// ociTagRegexp matches the OCI tags of the distribution spec, e.g., 0.1.1
+	ociTagRegexp = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9._-]{0,127}$`)
+	// ociDigestRegexp matches the SHA-256 manifest digests, e.g., sha256:...
+	ociDigestRegexp = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+	// scpLikeRegexp matches the SCP-like Git URLs, e.g., git@github.com:kcl-lang/krm-kcl.git
+	scpLikeRegexp = regexp.MustCompile(`^[\w.-]+@[\w.-]+:[^/]`)
+	// gitRefRegexp matches the Git branches, tags and commits, which follow the rules of `git check-ref-format`.
+	gitRefRegexp = regexp.MustCompile(`^[^\s~^:?*\[\\/.-][^\s~^:?*\[\\]*$`)
+	// checksumRegexp matches the go-getter checksums, e.g., sha256:...
+	checksumRegexp = regexp.MustCompile(`^(md5|sha1|sha256|sha512):([0-9a-fA-F]+)$`)
+	// checksumLengths are the hex lengths of the checksum types.
+	checksumLengths = map[string]int{"md5": 32, "sha1": 40, "sha256": 64, "sha512": 128}
+	// referenceRegexp matches the single tokens which look like the source references rather than the
+	// inline KCL code, e.g., oci:/ghcr.io/kcl-lang/set-annotation or ghcr.io/kcl-lang/set-annotation:0.1.1
+	referenceRegexp = regexp.MustCompile(`^(?:[a-zA-Z][\w+.-]*(?:::|:/)|[\w-]+(?:\.[\w-]+)+(?::[0-9]+)?/)\S*$`)
+)
+
+// sourceKind returns the name of the registered source which detects the source string in the same way
+// as the source is resolved at run time, or inline if no source detects it.
+func sourceKind(source string) string {
+	if name, _, ok := src.Detect(source); ok {
+		return name
+	}
+	return inlineSource
+}
+
+// validateSource validates the source string in the same way as the structured source, so a mistyped
+// reference is reported instead of being run as the inline KCL code. The local sources, the Git
+// shorthands of the VCS domains and the custom sources are resolved at run time as they are.
+func validateSource(field, source string) []error {
+	var errs []error
+	switch kind := sourceKind(source); kind {
+	case ociSource:
+		ref, err := src.ParseOCIRef(source)
+		if err != nil {
+			return []error{fmt.Errorf("invalid `%s` %q, %v", field, src.Redact(source), err)}
+		}
+		_, errs = ociSourceFromV1Beta1(kind, &v1beta1.OCISource{Ref: ref.Registry + "/" + ref.Repository, Tag: ref.Tag, Digest: ref.Digest})
+	case gitSource:
+		if in := gitSourceToV1Beta1(source); in != nil {
+			_, errs = gitSourceFromV1Beta1(kind, in)
+		}
+	case httpSource:
+		// The go-getter checksum parameter is left to go-getter, which also accepts the checksum files.
+		if in := httpSourceToV1Beta1(source); in != nil {
+			_, errs = httpSourceFromV1Beta1(kind, &v1beta1.HTTPSource{Url: in.Url})
+		}
+	case inlineSource:
+		if referenceRegexp.MatchString(source) {
+			return []error{fmt.Errorf("invalid `%s` %q, it looks like a source reference but is not a valid local, OCI, Git or HTTP source, e.g., oci://ghcr.io/kcl-lang/set-annotation:0.1.1", field, src.Redact(source))}
+		}
+	}
+	for i := range errs {
+		errs[i] = src.RedactError(fmt.Errorf("invalid `%s` %q: %v", field, source, errs[i]))
+	}
+	return errs
+}
+
+// sourceToV1Beta1 converts the source string to the structured source. The string shorthand is kept
+// if the structured source would not be converted back to the same string, which keeps the conversion
+// lossless, e.g., github.com/kcl-lang/krm-kcl/examples/mutation/set-labels
+func sourceToV1Beta1(source string) v1beta1.SourceSpec {
+	var out v1beta1.SourceSpec
+	switch sourceKind(source) {
+	case ociSource:
+		if ref, err := src.ParseOCIRef(source); err == nil {
+			out.OCI = &v1beta1.OCISource{Ref: ref.Registry + "/" + ref.Repository, Tag: ref.Tag, Digest: ref.Digest}
+		}
+	case localSource:
+		out.Local = &v1beta1.LocalSource{Path: source}
+	case gitSource:
+		out.Git = gitSourceToV1Beta1(source)
+	case httpSource:
+		out.HTTP = httpSourceToV1Beta1(source)
+	default:
+		out.Inline = source
+	}
+	if s, err := sourceFromV1Beta1(api.SourceKey, &out); err != nil || s != source {
+		return v1beta1.SourceSpec{Shorthand: source}
+	}
+	return out
+}
+
+// gitSourceToV1Beta1 splits the Git source string, e.g., git::https://github.com/kcl-lang/krm-kcl//examples?ref=main
+// into the URL, the ref and the path.
+func gitSourceToV1Beta1(source string) *v1beta1.GitSource {
+	if !src.IsGit(source) {
+		return nil
+	}
+	rest, query, _ := strings.Cut(strings.TrimPrefix(source, gitSource+"::"), "?")
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return nil
+	}
+	out := &v1beta1.GitSource{Url: rest, Ref: values.Get("ref")}
+	// The double slash after the scheme separator separates the path in the repository.
+	if i := strings.Index(rest, "://"); i >= 0 {
+		if j := strings.Index(rest[i+3:], "//"); j >= 0 {
+			out.Url, out.Path = rest[:i+3+j], rest[i+3+j+2:]
+		}
+	}
+	return out
+}
+
+// httpSourceToV1Beta1 splits the HTTP source string into the URL and the checksum.
+func httpSourceToV1Beta1(source string) *v1beta1.HTTPSource {
+	base, query, _ := strings.Cut(source, "?")
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return nil
+	}
+	checksum := values.Get("checksum")
+	values.Del("checksum")
+	if len(values) > 0 {
+		base += "?" + values.Encode()
+	}
+	return &v1beta1.HTTPSource{Url: base, Checksum: checksum}
+}
+
+// sourceFromV1Beta1 validates the structured source and converts it to the source string, which is
+// resolved as the same kind of source at run time. All the violations are reported at once.
+func sourceFromV1Beta1(field string, in *v1beta1.SourceSpec) (string, error) {
+	if in.Shorthand != "" {
+		return in.Shorthand, nil
+	}
+	var kinds []string
+	for _, s := range []struct {
+		kind string
+		set  bool
+	}{
+		{inlineSource, in.Inline != ""},
+		{localSource, in.Local != nil},
+		{ociSource, in.OCI != nil},
+		{gitSource, in.Git != nil},
+		{httpSource, in.HTTP != nil},
+	} {
+		if s.set {
+			kinds = append(kinds, s.kind)
+		}
+	}
+	switch {
+	case len(kinds) == 0:
+		return "", fmt.Errorf("`%s` must not be empty", field)
+	case len(kinds) > 1:
+		return "", fmt.Errorf("`%s.%s` and `%s.%s` must not be set at the same time", field, kinds[0], field, kinds[1])
+	}
+	kind := kinds[0]
+	field = field + "." + kind
+	var source string
+	var errs []error
+	switch kind {
+	case inlineSource:
+		source = in.Inline
+	case localSource:
+		source, errs = localSourceFromV1Beta1(field, in.Local)
+	case ociSource:
+		source, errs = ociSourceFromV1Beta1(field, in.OCI)
+	case gitSource:
+		source, errs = gitSourceFromV1Beta1(field, in.Git)
+	case httpSource:
+		source, errs = httpSourceFromV1Beta1(field, in.HTTP)
+	}
+	if len(errs) > 0 {
+		return "", aggregate(errs)
+	}
+	if sourceKind(source) != kind {
+		return "", fmt.Errorf("invalid `%s` %q, it is not a valid %s source", field, source, kind)
+	}
+	return source, nil
+}
+
+// localSourceFromV1Beta1 returns the local path, and the relative path is prefixed with ./ to be resolved
+// as a local source, e.g., main.k returns ./main.k
+func localSourceFromV1Beta1(field string, in *v1beta1.LocalSource) (string, []error) {
+	switch {
+	case in.Path == "":
+		return "", []error{fmt.Errorf("`%s.path` must not be empty", field)}
+	case strings.Contains(in.Path, "://") || strings.Contains(in.Path, "::"):
+		return "", []error{fmt.Errorf("invalid `%s.path` %q, expect a file or directory path instead of a URL", field, in.Path)}
+	case src.IsLocal(in.Path):
+		return in.Path, nil
+	default:
+		return "./" + in.Path, nil
+	}
+}
+
+// ociSourceFromV1Beta1 returns the OCI source, e.g., oci://ghcr.io/kcl-lang/set-annotation:0.1.1@sha256:...
+func ociSourceFromV1Beta1(field string, in *v1beta1.OCISource) (string, []error) {
+	var errs []error
+	ref := &src.OCIRef{Tag: in.Tag, Digest: in.Digest}
+	if in.Ref == "" {
+		errs = append(errs, fmt.Errorf("`%s.ref` must not be empty", field))
+	} else if parsed, err := src.ParseOCIRef(src.OCIPrefix(src.TrimOCIPrefix(in.Ref))); err != nil {
+		errs = append(errs, fmt.Errorf("invalid `%s.ref` %q, expect <registry>/<repository>, e.g., ghcr.io/kcl-lang/set-annotation", field, in.Ref))
+	} else if parsed.Tag != "" || parsed.Digest != "" {
+		errs = append(errs, fmt.Errorf("invalid `%s.ref` %q, it must not have the tag or the digest, set `%s.tag` and `%s.digest` instead", field, in.Ref, field, field))
+	} else {
+		ref.Registry, ref.Repository = parsed.Registry, parsed.Repository
+		if !ociRegistryRegexp.MatchString(ref.Registry) {
+			errs = append(errs, fmt.Errorf("invalid `%s.ref` %q, the registry %q is not a valid host", field, in.Ref, ref.Registry))
+		}
+		if !ociRepositoryRegexp.MatchString(ref.Repository) {
+			errs = append(errs, fmt.Errorf("invalid `%s.ref` %q, the repository %q must be the lowercase path components separated by slashes", field, in.Ref, ref.Repository))
+		}
+	}
+	if in.Tag != "" && !ociTagRegexp.MatchString(in.Tag) {
+		errs = append(errs, fmt.Errorf("invalid `%s.tag` %q, it must match %s", field, in.Tag, ociTagRegexp))
+	}
+	if in.Digest != "" && !ociDigestRegexp.MatchString(in.Digest) {
+		errs = append(errs, fmt.Errorf("invalid `%s.digest` %q, expect sha256:<64 hex characters>", field, in.Digest))
+	}
+	if len(errs) > 0 {
+		return "", errs
+	}
+	return ref.String(), nil
+}
+
+// gitSourceFromV1Beta1 returns the Git source, e.g., git::https://github.com/kcl-lang/krm-kcl//examples?ref=main
+func gitSourceFromV1Beta1(field string, in *v1beta1.GitSource) (string, []error) {
+	var errs []error
+	repo := strings.TrimPrefix(in.Url, gitSource+"::")
+	switch {
+	case repo == "":
+		errs = append(errs, fmt.Errorf("`%s.url` must not be empty", field))
+	case scpLikeRegexp.MatchString(repo):
+		if strings.ContainsAny(repo, "?#") {
+			errs = append(errs, fmt.Errorf("invalid `%s.url` %q, set `%s.ref` and `%s.path` instead of the query", field, in.Url, field, field))
+		}
+	default:
+		if err := validateGitURL(repo); err != nil {
+			errs = append(errs, fmt.Errorf("invalid `%s.url` %q, %v", field, in.Url, err))
+		} else if u, _ := url.Parse(repo); u.RawQuery != "" || u.Fragment != "" || strings.Contains(u.Path, "//") {
+			errs = append(errs, fmt.Errorf("invalid `%s.url` %q, set `%s.ref` and `%s.path` instead of the query and the subdirectory", field, in.Url, field, field))
+		}
+	}
+	if in.Ref != "" && (!gitRefRegexp.MatchString(in.Ref) || strings.Contains(in.Ref, "..") || strings.HasSuffix(in.Ref, ".lock")) {
+		errs = append(errs, fmt.Errorf("invalid `%s.ref` %q, it is not a valid Git branch, tag or commit", field, in.Ref))
+	}
+	dir := path.Clean(filepath.ToSlash(in.Path))
+	if in.Path != "" && (path.IsAbs(dir) || dir == ".." || strings.HasPrefix(dir, "../")) {
+		errs = append(errs, fmt.Errorf("invalid `%s.path` %q, expect a relative path in the repository", field, in.Path))
+	}
+	if len(errs) > 0 {
+		return "", errs
+	}
+	source := gitSource + "::" + repo
+	if in.Path != "" && dir != "." {
+		source += "//" + dir
+	}
+	if in.Ref != "" {
+		source += "?ref=" + url.QueryEscape(in.Ref)
+	}
+	return source, nil
+}
+
+// validateGitURL validates the Git repository URL with the scheme.
+func validateGitURL(repo string) error {
+	u, err := url.Parse(repo)
+	if err != nil {
+		return fmt.Errorf("it is not a valid URL")
+	}
+	switch u.Scheme {
+	case src.HttpsScheme, src.HttpScheme, "ssh", src.GitScheme:
+		if u.Host == "" {
+			return fmt.Errorf("the host must not be empty")
+		}
+	case "file":
+	case "":
+		return fmt.Errorf("expect a URL with the scheme, e.g., https://github.com/kcl-lang/krm-kcl")
+	default:
+		return fmt.Errorf("unsupported scheme %q, expect one of \"https\", \"http\", \"ssh\", \"git\" and \"file\"", u.Scheme)
+	}
+	return nil
+}
+
+// httpSourceFromV1Beta1 returns the HTTP source with the go-getter checksum parameter, e.g.,
+// https://example.com/main.k?checksum=sha256:...
+func httpSourceFromV1Beta1(field string, in *v1beta1.HTTPSource) (string, []error) {
+	var errs []error
+	if in.Url == "" {
+		errs = append(errs, fmt.Errorf("`%s.url` must not be empty", field))
+	} else if u, err := url.Parse(in.Url); err != nil {
+		errs = append(errs, fmt.Errorf("invalid `%s.url` %q, it is not a valid URL", field, in.Url))
+	} else if u.Scheme != src.HttpScheme && u.Scheme != src.HttpsScheme {
+		errs = append(errs, fmt.Errorf("invalid `%s.url` %q, expect the %q or %q scheme", field, in.Url, src.HttpScheme, src.HttpsScheme))
+	} else if u.Host == "" {
+		errs = append(errs, fmt.Errorf("invalid `%s.url` %q, the host must not be empty", field, in.Url))
+	} else if u.Query().Has("checksum") {
+		errs = append(errs, fmt.Errorf("invalid `%s.url` %q, set `%s.checksum` instead of the checksum parameter", field, in.Url, field))
+	}
+	if in.Checksum != "" {
+		if m := checksumRegexp.FindStringSubmatch(in.Checksum); m == nil || len(m[2]) != checksumLengths[m[1]] {
+			errs = append(errs, fmt.Errorf("invalid `%s.checksum` %q, expect <type>:<hex>, and the type is one of \"md5\", \"sha1\", \"sha256\" and \"sha512\"", field, in.Checksum))
+		}
+	}
+	if len(errs) > 0 {
+		return "", errs
+	}
+	if in.Checksum == "" {
+		return in.Url, nil
+	}
+	sep := "?"
+	if strings.Contains(in.Url, "?") {
+		sep = "&"
+	}
+	return in.Url + sep + "checksum=" + in.Checksum, nil
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"kcl-lang.io/krm-kcl/pkg/api"
+	"kcl-lang.io/krm-kcl/pkg/kube"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// validateSteps validates the KCL pipeline steps and returns all the violations.
+func (r *KCLRun) validateSteps() []error {
+	var errs []error
+	for _, f := range []struct {
+		key   string
+		value interface{}
+	}{
+		{api.SourceKey, r.Spec.Source},
+		{api.ParamsKey, r.Spec.Params},
+		{api.ParamsFromKey, r.Spec.ParamsFrom},
+		{api.ProfilesKey, r.Spec.Profiles},
+		{api.ParamsMergeKey, r.Spec.ParamsMerge},
+		{api.ConfigKey, r.Spec.Config},
+		{api.MatchConstraintsKey, r.Spec.MatchConstraints},
+		{api.DependenciesKey, r.Spec.Dependencies},
+	} {
+		if !reflect.ValueOf(f.value).IsZero() {
+			errs = append(errs, fmt.Errorf("`%s` must not be set with `%s`, set it in each step instead", f.key, api.StepsKey))
+		}
+	}
+	for i, step := range r.stepRuns() {
+		for _, err := range step.validateRunSpec() {
+			errs = append(errs, fmt.Errorf("%s: %v", stepName(i, &r.Spec.Steps[i]), err))
+		}
+	}
+	return errs
+}
+
+// stepRuns returns the KCLRun instances of the pipeline steps, which share the metadata,
+// credentials, host credentials, enforcement action, env and sandbox of the KCLRun.
+func (r *KCLRun) stepRuns() []*KCLRun {
+	if r.steps != nil {
+		return r.steps
+	}
+	for _, step := range r.Spec.Steps {
+		s := &KCLRun{ResourceMeta: r.ResourceMeta, options: r.options}
+		s.Spec.Source = step.Source
+		s.Spec.Params = step.Params
+		s.Spec.Config = step.Config
+		s.Spec.MatchConstraints = step.MatchConstraints
+		s.Spec.Dependencies = step.Dependencies
+		s.Spec.Credentials = r.Spec.Credentials
+		s.Spec.HostCredentials = r.Spec.HostCredentials
+		s.Spec.EnforcementAction = r.Spec.EnforcementAction
+		s.Spec.Env = r.Spec.Env
+		s.Spec.Sandbox = r.Spec.Sandbox
+		r.steps = append(r.steps, s)
+	}
+	return r.steps
+}
+
+// transformSteps runs the KCL pipeline steps in order, and the output of a step is the input of the
+// next step. The pipeline stops at the step which produces error results, and the timeout of the
+// KCLRun covers all the steps.
+func (r *KCLRun) transformSteps(ctx context.Context, in []*yaml.RNode) ([]*yaml.RNode, kube.Results, error) {
+	var allResults kube.Results
+	for i, step := range r.stepRuns() {
+		name := stepName(i, &r.Spec.Steps[i])
+		// Use the step KCLRun as the function config to provide the step params.
+		out, results, err := step.TransformWithContext(ctx, in, nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", name, err)
+		}
+		for _, result := range results {
+			result.Message = fmt.Sprintf("%s: %s", name, result.Message)
+		}
+		allResults = append(allResults, results...)
+		if results.HasErrors() {
+			return out, allResults, nil
+		}
+		in = out
+	}
+	return in, allResults, nil
+}
+
+// stepName returns the step name used in the error messages, e.g., steps[0] "set-labels".
+func stepName(i int, step *api.StepSpec) string {
+	if step.Name == "" {
+		return fmt.Sprintf("%s[%d]", api.StepsKey, i)
+	}
+	return fmt.Sprintf("%s[%d] %q", api.StepsKey, i, step.Name)
+}
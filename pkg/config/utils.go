@@ -1,29 +1,329 @@
 package config
 
 import (
+	"fmt"
+	"path"
 	"strings"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"kcl-lang.io/krm-kcl/pkg/api"
+	"kcl-lang.io/krm-kcl/pkg/api/v1alpha1"
+	"kcl-lang.io/krm-kcl/pkg/api/v1beta1"
 	"kcl-lang.io/krm-kcl/pkg/kube"
+	"sigs.k8s.io/kustomize/kyaml/openapi"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
 )
 
+// namespaceKind is the kind of the Namespace resource.
+const namespaceKind = "Namespace"
+
+// MatchOption is used to provide the extra context for matching resources.
+type MatchOption func(*matchOptions)
+
+type matchOptions struct {
+	// namespaceLabels is the map from the namespace name to the namespace labels.
+	namespaceLabels map[string]map[string]string
+	// matchConditions is the compiled CEL match conditions.
+	matchConditions *MatchConditions
+}
+
+// WithNamespaceLabels sets the namespace labels used by the namespace selector,
+// which is a map from the namespace name to the namespace labels.
+func WithNamespaceLabels(namespaceLabels map[string]map[string]string) MatchOption {
+	return func(o *matchOptions) {
+		o.namespaceLabels = namespaceLabels
+	}
+}
+
+// WithMatchConditions sets the compiled CEL match conditions. The `matchConditions` in the
+// match constraints are compiled on each call when it is not set.
+func WithMatchConditions(matchConditions *MatchConditions) MatchOption {
+	return func(o *matchOptions) {
+		o.matchConditions = matchConditions
+	}
+}
+
 // MatchResourceRules checks if the given Kubernetes object matches the resource rules specified in KCLRun.
-func MatchResourceRules(obj *kube.KubeObject, MatchConstraints *api.MatchConstraintsSpec) bool {
-	// if MatchConstraints.ResourceRules is not set (nil or empty), return true by default
-	if len(MatchConstraints.ResourceRules) == 0 {
+func MatchResourceRules(obj *kube.KubeObject, MatchConstraints *api.MatchConstraintsSpec, opts ...MatchOption) bool {
+	o := &matchOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	// if MatchConstraints.ResourceRules is not set (nil or empty), match all resources by default
+	if len(MatchConstraints.ResourceRules) > 0 && !matchAnyRule(obj, MatchConstraints.ResourceRules) {
+		return false
+	}
+	if matchAnyRule(obj, MatchConstraints.ExcludeResourceRules) {
+		return false
+	}
+	if !matchSelector(MatchConstraints.ObjectSelector, obj.GetLabels()) {
+		return false
+	}
+	if !matchConditions(obj, MatchConstraints.MatchConditions, o.matchConditions) {
+		return false
+	}
+	if MatchConstraints.NamespaceSelector != nil {
+		switch {
+		case isNamespace(obj):
+			return matchSelector(MatchConstraints.NamespaceSelector, obj.GetLabels())
+		case isClusterScoped(obj):
+			return true
+		default:
+			return matchSelector(MatchConstraints.NamespaceSelector, o.namespaceLabels[obj.GetNamespace()])
+		}
+	}
+	return true
+}
+
+// ValidateMatchConstraints validates the label selectors, scopes and glob patterns in the match constraints.
+func ValidateMatchConstraints(MatchConstraints *api.MatchConstraintsSpec) error {
+	var errs []error
+	for _, f := range []struct {
+		name  string
+		rules []api.ResourceRule
+	}{
+		{"resourceRules", MatchConstraints.ResourceRules},
+		{"excludeResourceRules", MatchConstraints.ExcludeResourceRules},
+	} {
+		for i, rule := range f.rules {
+			switch rule.Scope {
+			case "", api.AllScopes, api.ClusterScope, api.NamespacedScope:
+			default:
+				errs = append(errs, fmt.Errorf("%s[%d]: invalid scope %q, must be one of %q, %q and %q",
+					f.name, i, rule.Scope, api.ClusterScope, api.NamespacedScope, api.AllScopes))
+			}
+			for _, pattern := range append(append([]string{}, rule.ResourceNames...), rule.Namespaces...) {
+				if _, err := path.Match(pattern, ""); err != nil {
+					errs = append(errs, fmt.Errorf("%s[%d]: invalid glob pattern %q: %v", f.name, i, pattern, err))
+				}
+			}
+		}
+	}
+	if _, err := toSelector(MatchConstraints.ObjectSelector); err != nil {
+		errs = append(errs, fmt.Errorf("invalid objectSelector: %v", err))
+	}
+	if _, err := toSelector(MatchConstraints.NamespaceSelector); err != nil {
+		errs = append(errs, fmt.Errorf("invalid namespaceSelector: %v", err))
+	}
+	return aggregate(errs)
+}
+
+// matchConditions checks if the given Kubernetes object satisfies all of the CEL match conditions.
+func matchConditions(obj *kube.KubeObject, conditions []api.MatchCondition, compiled *MatchConditions) bool {
+	if len(conditions) == 0 {
+		return true
+	}
+	if compiled == nil {
+		var err error
+		if compiled, err = CompileMatchConditions(conditions); err != nil {
+			return false
+		}
+	}
+	return compiled.Match(obj)
+}
+
+// matchAnyRule checks if the given Kubernetes object matches any of the resource rules.
+func matchAnyRule(obj *kube.KubeObject, rules []api.ResourceRule) bool {
+	for _, rule := range rules {
+		if matchRule(obj, &rule) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchRule checks if the given Kubernetes object matches the resource rule.
+func matchRule(obj *kube.KubeObject, rule *api.ResourceRule) bool {
+	apiVersion := obj.GetAPIVersion()
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return false
+	}
+	if !containsString(rule.APIGroups, gv.Group) ||
+		!matchAPIVersion(rule, apiVersion, gv.Version) ||
+		!containsString(rule.Kinds, obj.GetKind()) ||
+		!matchGlob(rule.ResourceNames, obj.GetName()) {
+		return false
+	}
+	clusterScoped := isClusterScoped(obj)
+	switch rule.Scope {
+	case api.ClusterScope:
+		if !clusterScoped {
+			return false
+		}
+	case api.NamespacedScope:
+		if clusterScoped {
+			return false
+		}
+	}
+	if len(rule.Namespaces) > 0 {
+		switch {
+		case isNamespace(obj):
+			return matchGlob(rule.Namespaces, obj.GetName())
+		case clusterScoped:
+			return false
+		default:
+			return matchGlob(rule.Namespaces, obj.GetNamespace())
+		}
+	}
+	return true
+}
+
+// matchAPIVersion checks if the API version matches the API versions of the resource rule. The full API
+// versions, e.g., "apps/v1", are matched against the API version. The versions without a group, e.g., "v1",
+// are matched against the version in the API groups of the rule as the admission rules do, or against the
+// core API version if the rule has no API groups.
+func matchAPIVersion(rule *api.ResourceRule, apiVersion, version string) bool {
+	if len(rule.APIVersions) == 0 {
+		return true
+	}
+	for _, v := range rule.APIVersions {
+		if v == "*" || v == apiVersion || (len(rule.APIGroups) > 0 && !strings.Contains(v, "/") && v == version) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSelector checks if the labels match the label selector, a nil selector matches all labels.
+func matchSelector(selector *api.LabelSelector, objLabels map[string]string) bool {
+	s, err := toSelector(selector)
+	if err != nil {
+		return false
+	}
+	return s.Matches(labels.Set(objLabels))
+}
+
+// toSelector converts the label selector to the Kubernetes label selector.
+func toSelector(selector *api.LabelSelector) (labels.Selector, error) {
+	if selector == nil {
+		return labels.Everything(), nil
+	}
+	s := &metav1.LabelSelector{
+		MatchLabels: selector.MatchLabels,
+	}
+	for _, e := range selector.MatchExpressions {
+		s.MatchExpressions = append(s.MatchExpressions, metav1.LabelSelectorRequirement{
+			Key:      e.Key,
+			Operator: metav1.LabelSelectorOperator(e.Operator),
+			Values:   e.Values,
+		})
+	}
+	return metav1.LabelSelectorAsSelector(s)
+}
+
+// namespaceLabels returns the map from the namespace name to the namespace labels in the nodes.
+func namespaceLabels(nodes []*yaml.RNode) map[string]map[string]string {
+	result := make(map[string]map[string]string)
+	for _, n := range nodes {
+		if n.GetApiVersion() == "v1" && n.GetKind() == namespaceKind {
+			result[n.GetName()] = n.GetLabels()
+		}
+	}
+	return result
+}
+
+// isNamespace checks if the given Kubernetes object is a Namespace resource.
+func isNamespace(obj *kube.KubeObject) bool {
+	return obj.GetAPIVersion() == "v1" && obj.GetKind() == namespaceKind
+}
+
+// isClusterScoped checks if the given Kubernetes object is a known cluster-scoped resource.
+func isClusterScoped(obj *kube.KubeObject) bool {
+	return openapi.IsCertainlyClusterScoped(yaml.TypeMeta{
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+	})
+}
+
+// matchGlob checks if a string matches any of the glob patterns, an empty pattern list matches all strings.
+func matchGlob(patterns []string, str string) bool {
+	if len(patterns) == 0 {
 		return true
 	}
-	// iterate through each resource rule
-	for _, rule := range MatchConstraints.ResourceRules {
-		if containsString(rule.APIVersions, obj.GetAPIVersion()) &&
-			containsString(rule.Kinds, obj.GetKind()) {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, str); ok {
 			return true
 		}
 	}
-	// if no match is found, return false
 	return false
 }
 
+// mergeUnmatchedNodes merges the transformed nodes with the input nodes which are not matched,
+// and the unmatched nodes keep their original positions. When the transformed nodes have the
+// same length as the matched nodes, they replace the matched nodes one by one, otherwise they
+// are placed at the position of the first matched node.
+func mergeUnmatchedNodes(in []*yaml.RNode, matched []bool, transformed []*yaml.RNode) []*yaml.RNode {
+	matchedCount := 0
+	for _, m := range matched {
+		if m {
+			matchedCount++
+		}
+	}
+	result := make([]*yaml.RNode, 0, len(in)-matchedCount+len(transformed))
+	inserted := false
+	for i, n := range in {
+		switch {
+		case !matched[i]:
+			result = append(result, n)
+		case matchedCount == len(transformed):
+			result = append(result, transformed[0])
+			transformed = transformed[1:]
+		case !inserted:
+			result = append(result, transformed...)
+			inserted = true
+		}
+	}
+	// No input nodes are matched, e.g., a generator function.
+	if !inserted && matchedCount != len(transformed) {
+		result = append(result, transformed...)
+	}
+	return result
+}
+
+// EnforcementActionTag is the result tag key which denotes the enforcement action applied to the result.
+const EnforcementActionTag = "krm.kcl.dev/enforcement-action"
+
+// enforceResults applies the enforcement action to the error results, which are the assertion failures
+// and the `results` violations of the KCL program, and the other failures of the run are returned as the
+// errors instead. For the "warn" action, the error results are converted to warning results, and for the
+// "dryrun" action, they are converted to info results, so that the function run succeeds.
+func enforceResults(results kube.Results, action string) kube.Results {
+	var severity kube.Severity
+	switch action {
+	case api.WarnAction:
+		severity = kube.Warning
+	case api.DryRunAction:
+		severity = kube.Info
+	default:
+		return results
+	}
+	for _, r := range results {
+		if r.Severity != kube.Error {
+			continue
+		}
+		r.Severity = severity
+		if r.Tags == nil {
+			r.Tags = make(map[string]string)
+		}
+		r.Tags[EnforcementActionTag] = action
+	}
+	return results
+}
+
+// isKCLRun checks if the given node is a KCLRun resource of any supported API version.
+func isKCLRun(n *yaml.RNode) bool {
+	return IsKCLRun(n.GetApiVersion(), n.GetKind())
+}
+
+// IsKCLRun checks if the API version and kind are of a KCLRun resource of any supported API version.
+func IsKCLRun(apiVersion, kind string) bool {
+	return (apiVersion == v1alpha1.KCLRunAPIVersion || apiVersion == v1beta1.KCLRunAPIVersion) && kind == api.KCLRunKind
+}
+
 // isOk checks if a given string is in the list of "OK" values.
 func isOk(value string) bool {
 	okValues := []string{"ok", "yes", "true", "1", "on"}
@@ -47,3 +347,24 @@ func containsString(slice []string, str string) bool {
 	}
 	return false
 }
+
+// aggregate returns the flattened aggregate error of the errors, or nil if there is no error.
+func aggregate(errs []error) error {
+	agg := utilerrors.NewAggregate(errs)
+	if agg == nil {
+		return nil
+	}
+	return utilerrors.Flatten(agg)
+}
+
+// prefixErrors flattens the error and adds the prefix to each error message.
+func prefixErrors(prefix string, err error) []error {
+	var errs []error
+	if agg, ok := err.(utilerrors.Aggregate); ok {
+		for _, e := range utilerrors.Flatten(agg).Errors() {
+			errs = append(errs, fmt.Errorf("%s: %v", prefix, e))
+		}
+		return errs
+	}
+	return []error{fmt.Errorf("%s: %v", prefix, err)}
+}
@@ -0,0 +1,421 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"kcl-lang.io/krm-kcl/pkg/api"
+	"kcl-lang.io/krm-kcl/pkg/kube"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+func TestMergeUnmatchedNodes(t *testing.T) {
+	node := func(kind, name string) *yaml.RNode {
+		return yaml.MustParse("apiVersion: v1\nkind: " + kind + "\nmetadata:\n  name: " + name + "\n")
+	}
+	names := func(nodes []*yaml.RNode) []string {
+		var result []string
+		for _, n := range nodes {
+			result = append(result, n.GetKind()+"/"+n.GetName())
+		}
+		return result
+	}
+	testcases := []struct {
+		name        string
+		in          []*yaml.RNode
+		matched     []bool
+		transformed []*yaml.RNode
+		expect      []string
+	}{
+		{
+			name:        "replace matched nodes one by one",
+			in:          []*yaml.RNode{node("Deployment", "a"), node("Service", "b"), node("Deployment", "c")},
+			matched:     []bool{true, false, true},
+			transformed: []*yaml.RNode{node("Deployment", "a1"), node("Deployment", "c1")},
+			expect:      []string{"Deployment/a1", "Service/b", "Deployment/c1"},
+		},
+		{
+			name:        "insert transformed nodes at the first matched position",
+			in:          []*yaml.RNode{node("Service", "a"), node("Deployment", "b"), node("Service", "c")},
+			matched:     []bool{false, true, false},
+			transformed: []*yaml.RNode{node("Deployment", "b"), node("ConfigMap", "d")},
+			expect:      []string{"Service/a", "Deployment/b", "ConfigMap/d", "Service/c"},
+		},
+		{
+			name:        "matched nodes are removed",
+			in:          []*yaml.RNode{node("Service", "a"), node("Deployment", "b")},
+			matched:     []bool{false, true},
+			transformed: []*yaml.RNode{},
+			expect:      []string{"Service/a"},
+		},
+		{
+			name:        "append generated nodes when nothing is matched",
+			in:          []*yaml.RNode{node("Service", "a")},
+			matched:     []bool{false},
+			transformed: []*yaml.RNode{node("ConfigMap", "b")},
+			expect:      []string{"Service/a", "ConfigMap/b"},
+		},
+		{
+			name:        "all nodes are matched",
+			in:          []*yaml.RNode{node("Service", "a"), node("Service", "b")},
+			matched:     []bool{true, true},
+			transformed: []*yaml.RNode{node("Service", "c")},
+			expect:      []string{"Service/c"},
+		},
+	}
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			result := mergeUnmatchedNodes(tc.in, tc.matched, tc.transformed)
+			assert.Equal(t, tc.expect, names(result))
+		})
+	}
+}
+
+func TestMatchResourceRules(t *testing.T) {
+	const (
+		deployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx-deployment
+  namespace: prod
+  labels:
+    app: nginx
+`
+		service = `apiVersion: v1
+kind: Service
+metadata:
+  name: nginx-service
+  namespace: dev
+`
+		clusterRole = `apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: nginx-reader
+  labels:
+    app: nginx
+`
+		namespace = `apiVersion: v1
+kind: Namespace
+metadata:
+  name: prod
+  labels:
+    env: prod
+`
+	)
+	nsLabels := map[string]map[string]string{
+		"prod": {"env": "prod"},
+		"dev":  {"env": "dev"},
+	}
+	testcases := []struct {
+		name        string
+		object      string
+		constraints api.MatchConstraintsSpec
+		expect      bool
+	}{
+		{
+			name:   "empty constraints match all resources",
+			object: deployment,
+			expect: true,
+		},
+		{
+			name:   "match API group and kind",
+			object: deployment,
+			constraints: api.MatchConstraintsSpec{
+				ResourceRules: []api.ResourceRule{{APIGroups: []string{"apps"}, Kinds: []string{"Deployment"}}},
+			},
+			expect: true,
+		},
+		{
+			name:   "match core API group",
+			object: service,
+			constraints: api.MatchConstraintsSpec{
+				ResourceRules: []api.ResourceRule{{APIGroups: []string{""}}},
+			},
+			expect: true,
+		},
+		{
+			name:   "mismatch API group",
+			object: service,
+			constraints: api.MatchConstraintsSpec{
+				ResourceRules: []api.ResourceRule{{APIGroups: []string{"apps"}}},
+			},
+			expect: false,
+		},
+		{
+			name:   "match API version with group",
+			object: deployment,
+			constraints: api.MatchConstraintsSpec{
+				ResourceRules: []api.ResourceRule{{APIVersions: []string{"apps/v1"}}},
+			},
+			expect: true,
+		},
+		{
+			name:   "mismatch API version without group",
+			object: deployment,
+			constraints: api.MatchConstraintsSpec{
+				ResourceRules: []api.ResourceRule{{APIVersions: []string{"v1"}}},
+			},
+			expect: false,
+		},
+		{
+			name:   "match core API version",
+			object: service,
+			constraints: api.MatchConstraintsSpec{
+				ResourceRules: []api.ResourceRule{{APIVersions: []string{"v1"}}},
+			},
+			expect: true,
+		},
+		{
+			name:   "match version in API group",
+			object: deployment,
+			constraints: api.MatchConstraintsSpec{
+				ResourceRules: []api.ResourceRule{{APIGroups: []string{"apps"}, APIVersions: []string{"v1"}}},
+			},
+			expect: true,
+		},
+		{
+			name:   "mismatch version in API group",
+			object: deployment,
+			constraints: api.MatchConstraintsSpec{
+				ResourceRules: []api.ResourceRule{{APIGroups: []string{"apps"}, APIVersions: []string{"v1beta1"}}},
+			},
+			expect: false,
+		},
+		{
+			name:   "mismatch full API version of another API group",
+			object: deployment,
+			constraints: api.MatchConstraintsSpec{
+				ResourceRules: []api.ResourceRule{{APIGroups: []string{"apps"}, APIVersions: []string{"batch/v1"}}},
+			},
+			expect: false,
+		},
+		{
+			name:   "match API group with any API version",
+			object: clusterRole,
+			constraints: api.MatchConstraintsSpec{
+				ResourceRules: []api.ResourceRule{{APIGroups: []string{"rbac.authorization.k8s.io"}, APIVersions: []string{"*"}}},
+			},
+			expect: true,
+		},
+		{
+			name:   "match resource name glob",
+			object: deployment,
+			constraints: api.MatchConstraintsSpec{
+				ResourceRules: []api.ResourceRule{{ResourceNames: []string{"nginx-*"}}},
+			},
+			expect: true,
+		},
+		{
+			name:   "mismatch resource name glob",
+			object: deployment,
+			constraints: api.MatchConstraintsSpec{
+				ResourceRules: []api.ResourceRule{{ResourceNames: []string{"redis-*"}}},
+			},
+			expect: false,
+		},
+		{
+			name:   "match namespaced resource namespace",
+			object: deployment,
+			constraints: api.MatchConstraintsSpec{
+				ResourceRules: []api.ResourceRule{{Namespaces: []string{"prod"}}},
+			},
+			expect: true,
+		},
+		{
+			name:   "mismatch namespaced resource namespace",
+			object: service,
+			constraints: api.MatchConstraintsSpec{
+				ResourceRules: []api.ResourceRule{{Namespaces: []string{"prod"}}},
+			},
+			expect: false,
+		},
+		{
+			name:   "namespaces match the Namespace resource name",
+			object: namespace,
+			constraints: api.MatchConstraintsSpec{
+				ResourceRules: []api.ResourceRule{{Namespaces: []string{"p*"}}},
+			},
+			expect: true,
+		},
+		{
+			name:   "namespaces do not match cluster-scoped resources",
+			object: clusterRole,
+			constraints: api.MatchConstraintsSpec{
+				ResourceRules: []api.ResourceRule{{Namespaces: []string{"*"}}},
+			},
+			expect: false,
+		},
+		{
+			name:   "cluster scope matches cluster-scoped resources",
+			object: clusterRole,
+			constraints: api.MatchConstraintsSpec{
+				ResourceRules: []api.ResourceRule{{Scope: api.ClusterScope}},
+			},
+			expect: true,
+		},
+		{
+			name:   "cluster scope does not match namespaced resources",
+			object: deployment,
+			constraints: api.MatchConstraintsSpec{
+				ResourceRules: []api.ResourceRule{{Scope: api.ClusterScope}},
+			},
+			expect: false,
+		},
+		{
+			name:   "namespaced scope does not match cluster-scoped resources",
+			object: clusterRole,
+			constraints: api.MatchConstraintsSpec{
+				ResourceRules: []api.ResourceRule{{Scope: api.NamespacedScope}},
+			},
+			expect: false,
+		},
+		{
+			name:   "exclude resource rules",
+			object: deployment,
+			constraints: api.MatchConstraintsSpec{
+				ResourceRules:        []api.ResourceRule{{APIGroups: []string{"*"}}},
+				ExcludeResourceRules: []api.ResourceRule{{Kinds: []string{"Deployment"}}},
+			},
+			expect: false,
+		},
+		{
+			name:   "match object selector",
+			object: clusterRole,
+			constraints: api.MatchConstraintsSpec{
+				ObjectSelector: &api.LabelSelector{MatchLabels: map[string]string{"app": "nginx"}},
+			},
+			expect: true,
+		},
+		{
+			name:   "mismatch object selector expressions",
+			object: service,
+			constraints: api.MatchConstraintsSpec{
+				ObjectSelector: &api.LabelSelector{MatchExpressions: []api.LabelSelectorRequirement{
+					{Key: "app", Operator: "Exists"},
+				}},
+			},
+			expect: false,
+		},
+		{
+			name:   "match namespace selector",
+			object: deployment,
+			constraints: api.MatchConstraintsSpec{
+				NamespaceSelector: &api.LabelSelector{MatchLabels: map[string]string{"env": "prod"}},
+			},
+			expect: true,
+		},
+		{
+			name:   "mismatch namespace selector",
+			object: service,
+			constraints: api.MatchConstraintsSpec{
+				NamespaceSelector: &api.LabelSelector{MatchLabels: map[string]string{"env": "prod"}},
+			},
+			expect: false,
+		},
+		{
+			name:   "namespace selector matches the Namespace resource labels",
+			object: namespace,
+			constraints: api.MatchConstraintsSpec{
+				NamespaceSelector: &api.LabelSelector{MatchExpressions: []api.LabelSelectorRequirement{
+					{Key: "env", Operator: "In", Values: []string{"prod", "staging"}},
+				}},
+			},
+			expect: true,
+		},
+		{
+			name:   "namespace selector ignores cluster-scoped resources",
+			object: clusterRole,
+			constraints: api.MatchConstraintsSpec{
+				NamespaceSelector: &api.LabelSelector{MatchLabels: map[string]string{"env": "prod"}},
+			},
+			expect: true,
+		},
+	}
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			obj, err := kube.ParseKubeObject([]byte(tc.object))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expect, MatchResourceRules(obj, &tc.constraints, WithNamespaceLabels(nsLabels)))
+		})
+	}
+}
+
+func TestValidateMatchConstraints(t *testing.T) {
+	testcases := []struct {
+		name         string
+		constraints  api.MatchConstraintsSpec
+		expectErrMsg string
+	}{
+		{
+			name: "valid constraints",
+			constraints: api.MatchConstraintsSpec{
+				ResourceRules:  []api.ResourceRule{{ResourceNames: []string{"nginx-*"}, Scope: api.NamespacedScope}},
+				ObjectSelector: &api.LabelSelector{MatchLabels: map[string]string{"app": "nginx"}},
+			},
+		},
+		{
+			name: "invalid scope",
+			constraints: api.MatchConstraintsSpec{
+				ResourceRules: []api.ResourceRule{{Scope: "Global"}},
+			},
+			expectErrMsg: `invalid scope "Global"`,
+		},
+		{
+			name: "invalid glob pattern",
+			constraints: api.MatchConstraintsSpec{
+				ExcludeResourceRules: []api.ResourceRule{{Namespaces: []string{"[prod"}}},
+			},
+			expectErrMsg: `invalid glob pattern "[prod"`,
+		},
+		{
+			name: "invalid selector operator",
+			constraints: api.MatchConstraintsSpec{
+				NamespaceSelector: &api.LabelSelector{MatchExpressions: []api.LabelSelectorRequirement{
+					{Key: "env", Operator: "Equals", Values: []string{"prod"}},
+				}},
+			},
+			expectErrMsg: "invalid namespaceSelector",
+		},
+	}
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateMatchConstraints(&tc.constraints)
+			if tc.expectErrMsg == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectErrMsg)
+			}
+		})
+	}
+}
+
+func TestEnforceResults(t *testing.T) {
+	testcases := []struct {
+		action         string
+		expectSeverity kube.Severity
+		expectTag      string
+	}{
+		{action: "", expectSeverity: kube.Error},
+		{action: api.DenyAction, expectSeverity: kube.Error},
+		{action: api.WarnAction, expectSeverity: kube.Warning, expectTag: api.WarnAction},
+		{action: api.DryRunAction, expectSeverity: kube.Info, expectTag: api.DryRunAction},
+	}
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.action, func(t *testing.T) {
+			results := enforceResults(kube.Results{
+				{Message: "violation", Severity: kube.Error},
+				{Message: "checked", Severity: kube.Info},
+			}, tc.action)
+			assert.Equal(t, tc.expectSeverity, results[0].Severity)
+			assert.Equal(t, tc.expectTag, results[0].Tags[EnforcementActionTag])
+			assert.Equal(t, kube.Info, results[1].Severity)
+			assert.Empty(t, results[1].Tags)
+			assert.Equal(t, tc.expectSeverity == kube.Error, results.HasErrors())
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package edit
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// compileErrorRegexp matches the codes of the KCL syntax and compile errors, e.g., `error[E2G22]: TypeError`.
+	compileErrorRegexp = regexp.MustCompile(`error\[E[12]\w+\]`)
+	// errorLocationRegexp matches the source location of a KCL error, e.g., ` --> /tmp/prog.k:2:5`.
+	errorLocationRegexp = regexp.MustCompile(`(?m)^\s*-->\s*(.+?\.k):(\d+)`)
+	// assertStmtRegexp matches the KCL assert statements.
+	assertStmtRegexp = regexp.MustCompile(`^\s*assert\b`)
+	// assertionKindRegexp matches the kind of the KCL assertion errors, e.g., `error[E3M38]: AssertionError`.
+	assertionKindRegexp = regexp.MustCompile(`(?m)^(?:error\[\w+\]:\s*)?AssertionError\b`)
+	// checkFailureMessages are the messages of the failed KCL schema check blocks.
+	checkFailureMessages = []string{"Instance check failed", "Check failed on the condition"}
+)
+
+// AssertionError is returned when the KCL program fails an assertion, e.g., an `assert` statement or a
+// schema `check` block, which is a violation of the input resources rather than a failure of the run.
+type AssertionError struct {
+	// Err is the KCL evaluation error.
+	Err error
+}
+
+func (e *AssertionError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *AssertionError) Unwrap() error {
+	return e.Err
+}
+
+// asAssertionError returns an AssertionError when the KCL evaluation error is an assertion failure, and
+// returns the error unchanged otherwise, e.g., a compile error. The KCL runtime reports the assertion
+// failures as evaluation errors, so they are recognized by the message or the failed source line, which
+// must be read before the source is removed.
+func asAssertionError(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	if compileErrorRegexp.MatchString(msg) {
+		return err
+	}
+	if assertionKindRegexp.MatchString(msg) {
+		return &AssertionError{Err: err}
+	}
+	for _, m := range checkFailureMessages {
+		if strings.Contains(msg, m) {
+			return &AssertionError{Err: err}
+		}
+	}
+	if m := errorLocationRegexp.FindStringSubmatch(msg); m != nil {
+		if line, ok := sourceLine(m[1], m[2]); ok && assertStmtRegexp.MatchString(line) {
+			return &AssertionError{Err: err}
+		}
+	}
+	return err
+}
+
+// sourceLine returns the line of the KCL file at the 1-based line number.
+func sourceLine(file, line string) (string, bool) {
+	n, err := strconv.Atoi(line)
+	if err != nil || n < 1 {
+		return "", false
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for i := 1; scanner.Scan(); i++ {
+		if i == n {
+			return scanner.Text(), true
+		}
+	}
+	return "", false
+}
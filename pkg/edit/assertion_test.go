@@ -0,0 +1,61 @@
+package edit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAsAssertionError(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "prog.k")
+	code := "items = option(\"items\")\nassert len(items) < 2, \"too many items\"\n_a = items[5]\n"
+	assert.NoError(t, os.WriteFile(file, []byte(code), 0666))
+
+	testcases := []struct {
+		name      string
+		message   string
+		assertion bool
+	}{
+		{
+			name:      "assert statement",
+			message:   "EvaluationError\n --> " + file + ":2:1\n  |\n2 | assert len(items) < 2, \"too many items\"\n  |  too many items\n",
+			assertion: true,
+		},
+		{
+			name:      "assertion error kind",
+			message:   "error[E3M38]: AssertionError\n --> " + file + ":2:1\n",
+			assertion: true,
+		},
+		{
+			name:      "schema check block",
+			message:   "EvaluationError\n --> " + file + ":1\n  |\n  |  Instance check failed\n",
+			assertion: true,
+		},
+		{
+			name:    "runtime error",
+			message: "EvaluationError\n --> " + file + ":3:1\n  |\n3 | _a = items[5]\n  |  list index out of range: 5\n",
+		},
+		{
+			name:    "compile error",
+			message: "error[E2G22]: TypeError\n --> " + file + ":2:8\n  |\n2 | assert len(items) < 2, \"too many items\"\n  |  expected int\n",
+		},
+		{
+			name:    "fetch error",
+			message: "failed to download oci://ghcr.io/kcl-lang/set-annotation",
+		},
+	}
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := asAssertionError(errors.New(tc.message))
+			var assertionErr *AssertionError
+			assert.Equal(t, tc.assertion, errors.As(err, &assertionErr))
+			assert.EqualError(t, err, tc.message)
+		})
+	}
+	assert.NoError(t, asAssertionError(nil))
+}
@@ -2,11 +2,11 @@ package edit
 
 import (
 	"bytes"
+	"context"
 	_ "embed"
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"github.com/hashicorp/go-getter"
 	"kcl-lang.io/krm-kcl/pkg/api"
@@ -70,34 +70,133 @@ func RunKCL(name, source string, resourceList *yaml.RNode) ([]*yaml.RNode, error
 // Return:
 // A pointer to []*yaml.RNode objects that represent the output YAML objects of the KCL program.
 func RunKCLWithConfig(name, src string, dependencies []string, resourceList *yaml.RNode, config *api.ConfigSpec, getterOptions ...getter.ClientOption) ([]*yaml.RNode, error) {
+	return RunKCLWithOptions(name, src, resourceList, &RunOptions{
+		Dependencies:  dependencies,
+		Config:        config,
+		GetterOptions: getterOptions,
+	})
+}
+
+// RunOptions are the options to run a KCL program.
+type RunOptions struct {
+	// Dependencies are the external dependencies for the KCL code.
+	Dependencies []string
+	// Config is the compile config.
+	Config *api.ConfigSpec
+	// Env declares the environment variables exposed to the KCL program, and nothing is exposed if it is nil.
+	Env *EnvPolicy
+	// Sandbox limits what the KCL program can touch.
+	Sandbox *SandboxOptions
+	// GetterOptions are the options to fetch the remote source.
+	GetterOptions []getter.ClientOption
+	// Fetch are the retry and progress options to fetch the remote source.
+	Fetch *source.FetchOptions
+}
+
+// RunKCLWithOptions runs a KCL program specified by the given source code or url with the run options,
+// with the given resource list as input, and returns the resulting KRM resource list.
+func RunKCLWithOptions(name, src string, resourceList *yaml.RNode, o *RunOptions) ([]*yaml.RNode, error) {
+	return RunKCLWithContext(context.Background(), name, src, resourceList, o)
+}
+
+// RunKCLWithContext runs a KCL program in the same way as RunKCLWithOptions, and stops the run when the
+// context is done, e.g., the deadline is exceeded. A PhaseError which denotes the phase of the run is
+// returned in that case. The source fetch is canceled with the context, but the dependency resolution
+// and the KCL evaluation can not be interrupted, and the temp source directories are removed after
+// they finish.
+//
+// Note that every run which is stopped in these phases leaks a goroutine, which keeps running the
+// abandoned phase in the background and may hold a CPU until the KCL evaluation finishes, or for the
+// lifetime of the process if it never finishes. The long-running embedders should wait on the Done
+// channel of the PhaseError, e.g., to bound the number of the abandoned runs, before they run again.
+func RunKCLWithContext(ctx context.Context, name, src string, resourceList *yaml.RNode, o *RunOptions) (_ []*yaml.RNode, err error) {
+	// The errors may echo the source URL with the credentials.
+	defer func() { err = source.RedactError(err) }()
+	if o == nil {
+		o = &RunOptions{}
+	}
+	// The temp directories are removed after the abandoned phases of a timed out run return, and the
+	// PhaseError is done after that.
+	c := &cleanups{}
+	defer func() {
+		var phaseErr *PhaseError
+		if errors.As(err, &phaseErr) && phaseErr.done != nil {
+			c.wait(phaseErr.done)
+		}
+		done := c.run()
+		if phaseErr != nil {
+			phaseErr.done = done
+		}
+	}()
 	// 1. Construct KCL code from source.
-	entry, err := SourceToTempEntry(src, getterOptions...)
-	defer KCLEntryOriginTmpDirCleanup(entry)
+	entry, err := fetchSource(ctx, src, o.Fetch, o.GetterOptions...)
+	fetched := entry
+	c.add(func() { KCLEntryOriginTmpDirCleanup(fetched) })
 	if err != nil {
 		return nil, errors.Wrap(err)
 	}
+	// The OCI source is pulled before the run to be checked in the sandbox mode, to be cached, and to load
+	// the default params and the params schema in the package.
+	sandbox := sandboxOptions(o)
+	if source.IsOCI(entry.source) {
+		dir, tmpDir, err := fetchOCISource(ctx, entry.source, o.Fetch)
+		pulled := &KCLEntryOrigin{dir, tmpDir}
+		c.add(func() { KCLEntryOriginTmpDirCleanup(pulled) })
+		if err != nil {
+			return nil, err
+		}
+		entry = pulled
+	}
+	// The source and the dependencies, including the dependencies in the kcl.mod file of the source
+	// package, are linted against the sandbox policy before the run.
+	if sandbox != nil {
+		var deps []string
+		if err := runPhase(ctx, ResolvePhase, c, func() (err error) {
+			deps, err = packageDependencies(ctx, entry, fetchCredentials(o.Fetch))
+			return err
+		}); err != nil {
+			var phaseErr *PhaseError
+			if errors.As(err, &phaseErr) {
+				return nil, err
+			}
+			return nil, &SandboxError{Violations: []string{fmt.Sprintf("the dependencies of the source package can not be checked: %v", err)}}
+		}
+		if err := lintSource(entry, append(deps, o.Dependencies...)); err != nil {
+			return nil, err
+		}
+	}
+	// The params are merged onto the default params shipped in the source package.
+	defaults, err := loadParamsDefaults(entry)
+	if err != nil {
+		return nil, err
+	}
+	if resourceList, err = applyParamsDefaults(resourceList, defaults); err != nil {
+		return nil, err
+	}
 	// 2. Construct option list.
-	opts, err := constructOptions(resourceList, config)
+	opts, err := constructOptions(resourceList, o.Config, o.Env)
 	if err != nil {
 		return nil, errors.Wrap(err)
 	}
+	if len(o.Dependencies) > 0 {
+		opts.ExternalPackages = o.Dependencies
+	}
+	// The params are validated against the params schema of the source package before the run.
+	if err := runPhase(ctx, EvaluatePhase, c, func() error {
+		return validateParams(entry, resourceList, opts)
+	}); err != nil {
+		return nil, err
+	}
 	// 3. Run the KCL code.
 	result := bytes.NewBuffer([]byte{})
 
-	// Configure the source
-	if source.IsOCI(entry.source) {
-		parts := strings.SplitN(source.TrimOCIPrefix(entry.source), ":", 2)
-		opts.Oci = source.OCIPrefix(parts[0])
-		if len(parts) > 1 {
-			opts.Tag = parts[1]
-		}
-	} else {
-		// Everything else is treated as an entry.
-		opts.Entries = []string{entry.source}
-	}
+	// Configure the source, and the OCI source has been pulled into a local package.
+	opts.Entries = []string{entry.source}
 	opts.Writer = result
-	if len(dependencies) > 0 {
-		opts.ExternalPackages = dependencies
+	var output *limitWriter
+	if sandbox != nil {
+		output = &limitWriter{w: result, max: sandbox.MaxOutputSize}
+		opts.Writer = output
 	}
 	err = opts.Complete([]string{})
 	if err != nil {
@@ -107,9 +206,17 @@ func RunKCLWithConfig(name, src string, dependencies []string, resourceList *yam
 	if err != nil {
 		return nil, errors.Wrap(err)
 	}
-	err = opts.Run()
+	err = runPhase(ctx, EvaluatePhase, c, opts.Run)
+	var phaseErr *PhaseError
+	if errors.As(err, &phaseErr) {
+		return nil, err
+	}
+	if output != nil && output.exceeded {
+		return nil, &SandboxError{Violations: []string{fmt.Sprintf("the output exceeds the max size %d bytes", output.max)}}
+	}
 	if err != nil {
-		return nil, errors.Wrap(err)
+		// The assertion failures are told apart from the other evaluation errors before the source is removed.
+		return nil, errors.Wrap(asAssertionError(err))
 	}
 	// 4. Parse YAML objects.
 	reader := kio.ByteReader{
@@ -135,29 +242,52 @@ func ToKCLValueString(value *yaml.RNode, defaultValue string) (string, error) {
 	return string(jsonString), nil
 }
 
+// ociSourceRef returns the OCI reference and the tag of the OCI source, e.g., oci://ghcr.io/kcl-lang/set-annotation:0.1.0
+func ociSourceRef(src string) (string, string) {
+	ref, err := source.ParseOCIRef(src)
+	if err != nil {
+		return src, ""
+	}
+	return source.OCIPrefix(ref.Registry + "/" + ref.Repository), ref.Tag
+}
+
 // SourceToTempEntry convert source to a temp KCL file.
 func SourceToTempEntry(src string, opts ...getter.ClientOption) (*KCLEntryOrigin, error) {
-	if source.IsOCI(src) {
-		// Read code from a OCI source.
-		return &KCLEntryOrigin{src, ""}, nil
-	} else if source.IsLocal(src) {
-		return &KCLEntryOrigin{src, ""}, nil
-	} else if source.IsRemoteUrl(src) || source.IsGit(src) || source.IsVCSDomain(src) {
-		// Read code from local path or a remote url.
-		src, tmpDir, err := source.ReadThroughGetter(src, opts...)
-		return &KCLEntryOrigin{src, tmpDir}, err
-	} else {
-		// May be a inline code source.
-		tmpDir, err := os.MkdirTemp("", "kcl-sandbox")
+	return SourceToTempEntryWithContext(context.Background(), src, nil, opts...)
+}
+
+// SourceToTempEntryWithContext converts source to a temp KCL file in the same way as SourceToTempEntry,
+// and fetches the remote source with the context and the fetch options. When the fetch options have
+// a lock, or the lock file of the KCL_LOCK_FILE environment variable is set, the remote source is fetched
+// at the locked commit, e.g., the OCI source is pulled, and is verified against the lock.
+func SourceToTempEntryWithContext(ctx context.Context, src string, fetch *source.FetchOptions, opts ...getter.ClientOption) (*KCLEntryOrigin, error) {
+	if source.IsRemote(src) {
+		lock, err := fetch.GetLock()
 		if err != nil {
-			return &KCLEntryOrigin{"", ""}, fmt.Errorf("error creating temp directory: %v", err)
+			return &KCLEntryOrigin{}, err
 		}
-		// Write kcl code in the temp file.
-		file := filepath.Join(tmpDir, "prog.k")
-		err = os.WriteFile(file, []byte(src), 0666)
-		if err != nil {
-			return &KCLEntryOrigin{file, tmpDir}, errors.Wrap(err)
+		if lock != nil {
+			return lockedSourceToTempEntry(ctx, lock, src, fetch, opts...)
 		}
-		return &KCLEntryOrigin{file, tmpDir}, nil
+	} else if fetch != nil && fetch.RequireSignature {
+		return &KCLEntryOrigin{}, &source.SignatureError{Source: src, Err: fmt.Errorf("the source type does not support signatures")}
+	}
+	// The sources are fetched by the source registered for their kind, and the sources of no kind
+	// are the inline code.
+	if _, s, ok := fetch.Sources().Detect(src); ok {
+		dir, tmpDir, err := s.Fetch(ctx, src, fetch, opts...)
+		return &KCLEntryOrigin{dir, tmpDir}, err
+	}
+	// May be a inline code source.
+	tmpDir, err := os.MkdirTemp("", "kcl-sandbox")
+	if err != nil {
+		return &KCLEntryOrigin{"", ""}, fmt.Errorf("error creating temp directory: %v", err)
+	}
+	// Write kcl code in the temp file.
+	file := filepath.Join(tmpDir, "prog.k")
+	err = os.WriteFile(file, []byte(src), 0666)
+	if err != nil {
+		return &KCLEntryOrigin{file, tmpDir}, errors.Wrap(err)
 	}
+	return &KCLEntryOrigin{file, tmpDir}, nil
 }
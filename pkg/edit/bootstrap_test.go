@@ -0,0 +1,50 @@
+package edit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-getter"
+	"github.com/stretchr/testify/assert"
+	"kcl-lang.io/krm-kcl/pkg/source"
+)
+
+// fakeSource is the source of the fake:// scheme, which writes the source path as the KCL code.
+type fakeSource struct{}
+
+func (s *fakeSource) Detect(src string) bool {
+	return strings.HasPrefix(src, "fake://")
+}
+
+func (s *fakeSource) Fetch(ctx context.Context, src string, o *source.FetchOptions, opts ...getter.ClientOption) (string, string, error) {
+	tmpDir, err := os.MkdirTemp("", "kcl-sandbox")
+	if err != nil {
+		return src, "", err
+	}
+	file := filepath.Join(tmpDir, "main.k")
+	return file, tmpDir, os.WriteFile(file, []byte(strings.TrimPrefix(src, "fake://")), 0644)
+}
+
+func TestSourceToTempEntryWithRegistry(t *testing.T) {
+	registry := source.NewDefaultRegistry()
+	assert.NoError(t, registry.Register("fake", &fakeSource{}))
+	fetch := &source.FetchOptions{Registry: registry}
+
+	entry, err := SourceToTempEntryWithContext(context.Background(), "fake://a = 1", fetch)
+	defer KCLEntryOriginTmpDirCleanup(entry)
+	assert.NoError(t, err)
+	data, err := os.ReadFile(entry.source)
+	assert.NoError(t, err)
+	assert.Equal(t, "a = 1", string(data))
+
+	// The sources which are not detected by the default registry are the inline code.
+	entry, err = SourceToTempEntry("fake://a = 1")
+	defer KCLEntryOriginTmpDirCleanup(entry)
+	assert.NoError(t, err)
+	data, err = os.ReadFile(entry.source)
+	assert.NoError(t, err)
+	assert.Equal(t, "fake://a = 1", string(data))
+}
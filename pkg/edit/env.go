@@ -0,0 +1,54 @@
+package edit
+
+import (
+	"os"
+	"strings"
+
+	"kcl-lang.io/krm-kcl/pkg/api"
+)
+
+// pathEnvVar is the environment variable which is also exposed as `option("PATH")`.
+const pathEnvVar = "PATH"
+
+// EnvPolicy declares the environment variables exposed to the KCL program as `option("env")` and
+// `option("PATH")`, and nothing is exposed by default.
+type EnvPolicy struct {
+	// Vars are the allowed environment variable names, prefixes and explicit values.
+	Vars []api.EnvVar
+	// AllowAll exposes the whole process environment, which is the legacy behavior.
+	AllowAll bool
+}
+
+// Environ returns the environment variables exposed by the policy. The explicit values take precedence
+// over the process environment variables.
+func (p *EnvPolicy) Environ() map[string]string {
+	env := map[string]string{}
+	if p == nil {
+		return env
+	}
+	for _, e := range os.Environ() {
+		pair := strings.SplitN(e, "=", 2)
+		if len(pair) == 2 && p.allows(pair[0]) {
+			env[pair[0]] = pair[1]
+		}
+	}
+	for _, v := range p.Vars {
+		if v.Name != "" && v.Value != nil {
+			env[v.Name] = *v.Value
+		}
+	}
+	return env
+}
+
+// allows returns whether the process environment variable with the name is exposed.
+func (p *EnvPolicy) allows(name string) bool {
+	if p.AllowAll {
+		return true
+	}
+	for _, v := range p.Vars {
+		if (v.Name == name && v.Value == nil) || (v.Prefix != "" && strings.HasPrefix(name, v.Prefix)) {
+			return true
+		}
+	}
+	return false
+}
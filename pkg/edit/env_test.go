@@ -0,0 +1,59 @@
+package edit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"kcl-lang.io/krm-kcl/pkg/api"
+)
+
+func TestEnvPolicyEnviron(t *testing.T) {
+	t.Setenv("APP_NAME", "nginx")
+	t.Setenv("APP_PORT", "80")
+	t.Setenv("HOME", "/home/kcl")
+	t.Setenv("CI_TOKEN", "secret")
+	region := "us-east-1"
+	empty := ""
+
+	testcases := []struct {
+		name      string
+		policy    *EnvPolicy
+		expectEnv map[string]string
+	}{
+		{
+			name:      "nil policy",
+			expectEnv: map[string]string{},
+		},
+		{
+			name:      "empty policy",
+			policy:    &EnvPolicy{},
+			expectEnv: map[string]string{},
+		},
+		{
+			name: "names, prefixes and values",
+			policy: &EnvPolicy{Vars: []api.EnvVar{
+				{Name: "HOME"},
+				{Prefix: "APP_"},
+				{Name: "REGION", Value: &region},
+				{Name: "CI_TOKEN", Value: &empty},
+				{Name: "NOT_FOUND"},
+			}},
+			expectEnv: map[string]string{
+				"HOME":     "/home/kcl",
+				"APP_NAME": "nginx",
+				"APP_PORT": "80",
+				"REGION":   "us-east-1",
+				"CI_TOKEN": "",
+			},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectEnv, tc.policy.Environ())
+		})
+	}
+
+	env := (&EnvPolicy{AllowAll: true, Vars: []api.EnvVar{{Name: "REGION", Value: &region}}}).Environ()
+	assert.Equal(t, "secret", env["CI_TOKEN"])
+	assert.Equal(t, "us-east-1", env["REGION"])
+}
@@ -0,0 +1,533 @@
+package edit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"kcl-lang.io/kpm/pkg/client"
+	"sigs.k8s.io/kustomize/kyaml/errors"
+)
+
+var (
+	// fileReadFuncs are the functions of the KCL file module which read the path argument.
+	fileReadFuncs = map[string]bool{"read": true, "glob": true, "exists": true, "size": true}
+	// filePathFuncs are the functions of the KCL file module which only return the paths of the program.
+	filePathFuncs = map[string]bool{"modpath": true, "workdir": true, "current": true, "abs": true}
+	// dumpToFileFuncs are the functions of the KCL yaml and json modules which write files.
+	dumpToFileFuncs = map[string]bool{"dump_to_file": true, "dump_all_to_file": true}
+	// modDepEntryRegexp matches the entries of the dependencies in the kcl.mod file, e.g., `k8s = "1.28"`
+	modDepEntryRegexp = regexp.MustCompile(`(?m)^\s*([\w-]+)\s*=\s*(.+?)\s*$`)
+	// modDepPathRegexp matches the path of the local dependencies, e.g., `{ path = "../helper" }`
+	modDepPathRegexp = regexp.MustCompile(`\bpath\s*=\s*"([^"]+)"`)
+)
+
+// packageDependencies resolves the dependencies in the kcl.mod file of the source package, which are
+// otherwise downloaded by the KCL package manager in the evaluation phase, into the `name=path` list to
+// be linted. The local path dependencies are followed with their own kcl.mod files, and the others are
+// resolved with their dependencies by the KCL package manager. An error is returned if any of them can
+// not be resolved.
+func packageDependencies(ctx context.Context, entry *KCLEntryOrigin, creds CredentialsFunc) ([]string, error) {
+	modFile := findModFile(packageDir(entry))
+	if modFile == "" {
+		return nil, nil
+	}
+	deps := map[string]string{}
+	var remote []string
+	remoteNames := map[string]bool{}
+	visited := map[string]bool{}
+	var walk func(modFile string) error
+	walk = func(modFile string) error {
+		if visited[modFile] {
+			return nil
+		}
+		visited[modFile] = true
+		data, err := os.ReadFile(modFile)
+		if os.IsNotExist(err) {
+			// The local dependency may have no kcl.mod file.
+			return nil
+		} else if err != nil {
+			return err
+		}
+		for _, m := range modDepEntryRegexp.FindAllStringSubmatch(modDependencies(string(data)), -1) {
+			name, value := m[1], m[2]
+			if _, ok := deps[name]; ok || remoteNames[name] {
+				continue
+			}
+			p := modDepPathRegexp.FindStringSubmatch(value)
+			if p == nil {
+				remote = append(remote, fmt.Sprintf("%s = %s", name, value))
+				remoteNames[name] = true
+				continue
+			}
+			dir := p[1]
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(filepath.Dir(modFile), dir)
+			}
+			deps[name] = dir
+			if err := walk(filepath.Join(dir, "kcl.mod")); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(modFile); err != nil {
+		return nil, err
+	}
+	if len(remote) > 0 {
+		cli, err := client.NewKpmClient()
+		if err != nil {
+			return nil, err
+		}
+		resolved, err := resolveDeps(ctx, cli, strings.Join(remote, "\n"), creds)
+		if err != nil {
+			return nil, err
+		}
+		for name := range remoteNames {
+			if _, ok := resolved[name]; !ok {
+				return nil, fmt.Errorf("the dependency %q is not resolved", name)
+			}
+		}
+		for name, dir := range resolved {
+			if _, ok := deps[name]; !ok {
+				deps[name] = dir
+			}
+		}
+	}
+	list := make([]string, 0, len(deps))
+	for name, dir := range deps {
+		list = append(list, name+"="+dir)
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+// findModFile returns the kcl.mod file in the directory or its closest parent directory, or an empty
+// string if there is no kcl.mod file.
+func findModFile(dir string) string {
+	if dir == "" {
+		return ""
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		modFile := filepath.Join(dir, "kcl.mod")
+		if _, err := os.Stat(modFile); err == nil {
+			return modFile
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// modDependencies returns the lines of the `[dependencies]` table of the kcl.mod file.
+func modDependencies(mod string) string {
+	var deps strings.Builder
+	in := false
+	for _, line := range strings.Split(mod, "\n") {
+		if t := strings.TrimSpace(line); strings.HasPrefix(t, "[") {
+			in = t == "[dependencies]"
+			continue
+		}
+		if in {
+			deps.WriteString(line + "\n")
+		}
+	}
+	return deps.String()
+}
+
+// lintSource lints the KCL files of the source and the local dependencies against the sandbox policy
+// and returns all the violations. The KCL runtime can not disable the file and plugin modules, so the
+// policy is checked on the code before the run, which is a best-effort lint rather than an isolation.
+func lintSource(entry *KCLEntryOrigin, dependencies []string) error {
+	root, err := filepath.EvalSymlinks(packageDir(entry))
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	dirs := []string{entry.source}
+	for _, dep := range dependencies {
+		if parts := strings.SplitN(dep, "=", 2); len(parts) == 2 {
+			dirs = append(dirs, parts[1])
+		}
+	}
+	var violations []string
+	for _, d := range dirs {
+		err := filepath.WalkDir(d, func(p string, entry os.DirEntry, err error) error {
+			if err != nil || entry.IsDir() || filepath.Ext(p) != ".k" || strings.HasSuffix(p, "_test.k") {
+				return err
+			}
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(d, p)
+			if err != nil || rel == "." {
+				rel = filepath.Base(p)
+			}
+			for _, v := range lintFile(string(data), root) {
+				violations = append(violations, fmt.Sprintf("%s: %s", filepath.ToSlash(rel), v))
+			}
+			return nil
+		})
+		if err != nil {
+			return errors.Wrap(err)
+		}
+	}
+	if len(violations) > 0 {
+		return &SandboxError{Violations: violations}
+	}
+	return nil
+}
+
+// lintFile lints the KCL code against the sandbox policy. The file reads must be under `file.modpath()`
+// which is the source package root, e.g., `file.read(file.modpath() + "/data.yaml")`. The code is
+// tokenized, so the comments, the strings and the spaces around the member access do not hide the calls,
+// and the checked modules can only be referenced by their members, e.g., `f = file` is a violation.
+func lintFile(code, root string) []string {
+	tokens := tokenize(code)
+	var violations []string
+	modules := map[string]string{}
+	for i := 0; i < len(tokens); i++ {
+		if !tokens[i].is(identToken, "import") {
+			continue
+		}
+		module, alias, next := parseImport(tokens, i+1)
+		switch {
+		case module == "kcl_plugin" || strings.HasPrefix(module, "kcl_plugin."):
+			violations = append(violations, fmt.Sprintf("the plugin module %q is not allowed", module))
+		case module == "file" || module == "yaml" || module == "json":
+			modules[alias] = module
+		}
+		// The import statement is removed from the tokens to be linted.
+		tokens = append(tokens[:i], tokens[next:]...)
+		i--
+	}
+	if len(modules) == 0 {
+		return violations
+	}
+	l := &linter{modules: modules, root: root}
+	l.lint(tokens)
+	return append(violations, l.violations...)
+}
+
+// parseImport parses the module path and the alias of the import statement at the token after the
+// `import` keyword, e.g., `import kcl_plugin.hello as h`, and returns the index after the statement.
+func parseImport(tokens []token, i int) (string, string, int) {
+	var module strings.Builder
+	// The relative imports start with the dots, e.g., `import .pkg`
+	for ; i < len(tokens) && tokens[i].is(punctToken, "."); i++ {
+		module.WriteString(".")
+	}
+	for i < len(tokens) && tokens[i].kind == identToken {
+		module.WriteString(tokens[i].value)
+		i++
+		if i+1 >= len(tokens) || !tokens[i].is(punctToken, ".") || tokens[i+1].kind != identToken {
+			break
+		}
+		module.WriteString(".")
+		i++
+	}
+	name := module.String()
+	alias := name[strings.LastIndex(name, ".")+1:]
+	if i+1 < len(tokens) && tokens[i].is(identToken, "as") && tokens[i+1].kind == identToken {
+		alias = tokens[i+1].value
+		i += 2
+	}
+	return name, alias, i
+}
+
+// linter lints the tokens of a KCL file against the sandbox policy.
+type linter struct {
+	// modules is the map from the import alias to the checked module, e.g., "f" to "file".
+	modules map[string]string
+	// root is the source package root.
+	root       string
+	violations []string
+}
+
+// lint lints the module references in the tokens and the string interpolations.
+func (l *linter) lint(tokens []token) {
+	for i, t := range tokens {
+		if t.kind == stringToken {
+			for _, s := range t.segments {
+				if s.expr {
+					l.lint(tokenize(s.value))
+				}
+			}
+			continue
+		}
+		module, ok := l.modules[t.value]
+		if t.kind != identToken || !ok || (i > 0 && tokens[i-1].is(punctToken, ".")) {
+			continue
+		}
+		name, args, ok := memberAccess(tokens, i)
+		if !ok {
+			// A config key or a schema attribute of the same name, e.g., `{file = "a.yaml"}`
+			if i+1 < len(tokens) && (tokens[i+1].is(punctToken, "=") || tokens[i+1].is(punctToken, ":")) {
+				continue
+			}
+			l.report("the module %q must not be used as a value", module)
+			continue
+		}
+		switch {
+		case module != "file":
+			if dumpToFileFuncs[name] {
+				l.report("`%s.%s` is not allowed", module, name)
+			}
+		case filePathFuncs[name]:
+		case fileReadFuncs[name]:
+			l.lintReadPath(name, t.value, tokens[args:])
+		default:
+			l.report("`file.%s` is not allowed", name)
+		}
+	}
+}
+
+// lintReadPath lints the path argument of the file read function, which must be a constant path under
+// `file.modpath()`, e.g., `file.modpath() + "/data.yaml"` or `"${file.modpath()}/data.yaml"`.
+func (l *linter) lintReadPath(name, alias string, args []token) {
+	modpath := []token{{kind: identToken, value: alias}, {kind: punctToken, value: "."}, {kind: identToken, value: "modpath"}, {kind: punctToken, value: "("}, {kind: punctToken, value: ")"}}
+	var rel []segment
+	found := false
+	switch {
+	case len(args) >= 9 && args[0].is(punctToken, "(") && tokensEqual(args[1:6], modpath) &&
+		args[6].is(punctToken, "+") && args[7].kind == stringToken && args[8].is(punctToken, ")"):
+		rel, found = args[7].segments, true
+	case len(args) >= 3 && args[0].is(punctToken, "(") && args[1].kind == stringToken && args[2].is(punctToken, ")"):
+		segments := args[1].segments
+		if len(segments) > 0 && !segments[0].expr && segments[0].value == "" {
+			segments = segments[1:]
+		}
+		if len(segments) > 0 && segments[0].expr && tokensEqual(tokenize(segments[0].value), modpath) {
+			rel, found = segments[1:], true
+		}
+	}
+	if !found {
+		l.report("`file.%s` must read a path under `file.modpath()`", name)
+		return
+	}
+	var path strings.Builder
+	for _, s := range rel {
+		if s.expr {
+			l.report("`file.%s` must read a constant path", name)
+			return
+		}
+		path.WriteString(s.value)
+	}
+	if err := checkReadPath(l.root, path.String(), name == "glob"); err != nil {
+		l.report("`file.%s` %v", name, err)
+	}
+}
+
+func (l *linter) report(format string, args ...interface{}) {
+	l.violations = append(l.violations, fmt.Sprintf(format, args...))
+}
+
+// memberAccess returns the member name and the index after it when the token at i is followed by a
+// member access, e.g., `file.read`, `file .read` or `file?.read`.
+func memberAccess(tokens []token, i int) (string, int, bool) {
+	i++
+	if i < len(tokens) && tokens[i].is(punctToken, "?") {
+		i++
+	}
+	if i+1 < len(tokens) && tokens[i].is(punctToken, ".") && tokens[i+1].kind == identToken {
+		return tokens[i+1].value, i + 2, true
+	}
+	return "", 0, false
+}
+
+// tokensEqual checks if the tokens are the same identifiers and punctuations.
+func tokensEqual(a, b []token) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].kind != b[i].kind || a[i].value != b[i].value {
+			return false
+		}
+	}
+	return true
+}
+
+// checkReadPath checks the path relative to the source package root does not escape the root, and
+// the existing files are not the symbolic links to the files outside the root.
+func checkReadPath(root, rel string, glob bool) error {
+	p := filepath.Join(root, filepath.FromSlash(rel))
+	if !isUnder(root, p) {
+		return fmt.Errorf("path %q is outside the source directory", rel)
+	}
+	paths := []string{p}
+	if glob {
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return fmt.Errorf("pattern %q is invalid: %v", rel, err)
+		}
+		paths = matches
+	}
+	for _, p := range paths {
+		real, err := filepath.EvalSymlinks(p)
+		if err != nil {
+			// The file does not exist, which is reported by the KCL program.
+			continue
+		}
+		if !isUnder(root, real) {
+			return fmt.Errorf("path %q links to a file outside the source directory", rel)
+		}
+	}
+	return nil
+}
+
+// isUnder returns whether the path is the root or under the root.
+func isUnder(root, p string) bool {
+	rel, err := filepath.Rel(root, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+type tokenKind int
+
+const (
+	identToken tokenKind = iota
+	punctToken
+	stringToken
+	otherToken
+)
+
+// token is a KCL token which is relevant to the lint. The numbers are other tokens, and the comments,
+// the spaces and the line continuations are dropped.
+type token struct {
+	kind  tokenKind
+	value string
+	// segments are the literal parts and the interpolated expressions of a string token.
+	segments []segment
+}
+
+// segment is a literal part or an interpolated expression, e.g., `${name}`, of a KCL string.
+type segment struct {
+	value string
+	expr  bool
+}
+
+func (t token) is(kind tokenKind, value string) bool {
+	return t.kind == kind && t.value == value
+}
+
+// tokenize splits the KCL code into the tokens.
+func tokenize(code string) []token {
+	var tokens []token
+	for i := 0; i < len(code); {
+		c := code[i]
+		switch {
+		case c == '#':
+			for i < len(code) && code[i] != '\n' {
+				i++
+			}
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\\':
+			i++
+		case isQuote(c) || ((c == 'r' || c == 'R') && i+1 < len(code) && isQuote(code[i+1])):
+			if !isQuote(c) {
+				i++
+			}
+			var t token
+			t, i = scanString(code, i)
+			tokens = append(tokens, t)
+		case isIdentStart(c) || (c == '$' && i+1 < len(code) && isIdentStart(code[i+1])):
+			// The `$` prefix denotes a keyword used as an identifier, e.g., `$if`.
+			if c == '$' {
+				i++
+			}
+			start := i
+			for i < len(code) && isIdentChar(code[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: identToken, value: code[start:i]})
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(code) && isIdentChar(code[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: otherToken, value: code[start:i]})
+		default:
+			tokens = append(tokens, token{kind: punctToken, value: string(c)})
+			i++
+		}
+	}
+	return tokens
+}
+
+// scanString scans the string literal at the quote and returns the string token and the index after it.
+func scanString(code string, i int) (token, int) {
+	quote := code[i : i+1]
+	if strings.HasPrefix(code[i:], strings.Repeat(quote, 3)) {
+		quote = strings.Repeat(quote, 3)
+	}
+	i += len(quote)
+	var segments []segment
+	var lit strings.Builder
+	for i < len(code) && !strings.HasPrefix(code[i:], quote) {
+		switch {
+		case code[i] == '\\' && i+1 < len(code):
+			lit.WriteString(code[i : i+2])
+			i += 2
+		case code[i] == '\n' && len(quote) == 1:
+			// An unterminated string ends at the end of the line.
+			return token{kind: stringToken, segments: append(segments, segment{value: lit.String()})}, i
+		case strings.HasPrefix(code[i:], "$${"):
+			// The escaped interpolation is a literal `${`.
+			lit.WriteString("${")
+			i += 3
+		case strings.HasPrefix(code[i:], "${"):
+			end := interpolationEnd(code, i+2)
+			segments = append(segments, segment{value: lit.String()}, segment{value: code[i+2 : end], expr: true})
+			lit.Reset()
+			i = end + 1
+		default:
+			lit.WriteByte(code[i])
+			i++
+		}
+	}
+	segments = append(segments, segment{value: lit.String()})
+	return token{kind: stringToken, segments: segments}, i + len(quote)
+}
+
+// interpolationEnd returns the index of the brace which closes the interpolation started at i, or the
+// end of the code if the interpolation is not closed.
+func interpolationEnd(code string, i int) int {
+	depth := 0
+	for i < len(code) {
+		switch c := code[i]; {
+		case isQuote(c):
+			_, i = scanString(code, i)
+			continue
+		case c == '{':
+			depth++
+		case c == '}':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+		i++
+	}
+	return len(code)
+}
+
+func isQuote(c byte) bool {
+	return c == '"' || c == '\''
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || c >= '0' && c <= '9'
+}
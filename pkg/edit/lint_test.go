@@ -0,0 +1,139 @@
+package edit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLintFile(t *testing.T) {
+	root := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "data.yaml"), []byte("a: 1"), 0644))
+	assert.NoError(t, os.Symlink("/etc/hosts", filepath.Join(root, "hosts")))
+
+	testcases := []struct {
+		name             string
+		code             string
+		expectViolations []string
+	}{
+		{
+			name: "pure modules",
+			code: `import yaml
+import regex
+
+a = yaml.encode({a = 1})
+`,
+		},
+		{
+			name: "read under modpath",
+			code: `import file
+
+a = file.read(file.modpath() + "/data.yaml")
+b = file.exists("${file.modpath()}/data.yaml")
+c = file.glob(file.modpath() + "/*.yaml")
+# file.write("/tmp/a", "b")
+`,
+		},
+		{
+			name: "file writes and env",
+			code: `import file as f
+
+f.write("/tmp/out", "data")
+token = f.read_env("CI_TOKEN")
+`,
+			expectViolations: []string{"`file.write` is not allowed", "`file.read_env` is not allowed"},
+		},
+		{
+			name: "reads outside the source directory",
+			code: `import file
+
+a = file.read("/etc/passwd")
+b = file.read(file.modpath() + "/../secret")
+c = file.read(file.modpath() + "/hosts")
+d = file.read("${file.modpath()}/${option('name')}")
+read = file.read
+`,
+			expectViolations: []string{
+				"`file.read` must read a path under `file.modpath()`",
+				"`file.read` path \"/../secret\" is outside the source directory",
+				"`file.read` path \"/hosts\" links to a file outside the source directory",
+				"`file.read` must read a constant path",
+				"`file.read` must read a path under `file.modpath()`",
+			},
+		},
+		{
+			name: "plugins and dump to file",
+			code: `import kcl_plugin.hello
+import json
+
+json.dump_to_file({a = 1}, "/tmp/a.json")
+`,
+			expectViolations: []string{"the plugin module \"kcl_plugin.hello\" is not allowed", "`json.dump_to_file` is not allowed"},
+		},
+		{
+			name: "spaces, comments and strings do not hide the calls",
+			code: `import file as f  # import yaml as f
+import yaml \
+    as y
+
+a = f .read("/etc/passwd")
+b = f?.read("/etc/passwd")
+y. dump_to_file({a = 1}, "/tmp/a.yaml")
+c = "${f.read('/etc/passwd')}"
+d = "# file.read" + f.read_env("CI_TOKEN")
+`,
+			expectViolations: []string{
+				"`file.read` must read a path under `file.modpath()`",
+				"`file.read` must read a path under `file.modpath()`",
+				"`yaml.dump_to_file` is not allowed",
+				"`file.read` must read a path under `file.modpath()`",
+				"`file.read_env` is not allowed",
+			},
+		},
+		{
+			name: "modules used as values",
+			code: `import file
+import json
+
+read = file
+config = {file = "a.yaml", json: 1}
+dump = [json][0]
+`,
+			expectViolations: []string{"the module \"file\" must not be used as a value", "the module \"json\" must not be used as a value"},
+		},
+		{
+			name: "calls in strings and comments are not linted",
+			code: `import file
+
+a = "file.read('/etc/passwd')"
+b = '''
+file.write("/tmp/a", "b")
+'''
+c = "$${file.read('/etc/passwd')}"
+`,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectViolations, lintFile(tc.code, root))
+		})
+	}
+}
+
+func TestLintSource(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "main.k"), []byte("import file\n\na = file.read(\"/etc/passwd\")\n"), 0644))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "sub.k"), []byte("import kcl_plugin.hello\n"), 0644))
+	dep := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dep, "dep.k"), []byte("import yaml\n\nyaml.dump_to_file({}, \"a.yaml\")\n"), 0644))
+
+	err := lintSource(&KCLEntryOrigin{source: dir}, []string{"dep=" + dep})
+	assert.EqualError(t, err, "sandbox violation: [main.k: `file.read` must read a path under `file.modpath()`, "+
+		"sub/sub.k: the plugin module \"kcl_plugin.hello\" is not allowed, dep.k: `yaml.dump_to_file` is not allowed]")
+	// Only the source file is checked for the file source.
+	err = lintSource(&KCLEntryOrigin{source: filepath.Join(dir, "main.k")}, nil)
+	assert.EqualError(t, err, "sandbox violation: [main.k: `file.read` must read a path under `file.modpath()`]")
+}
@@ -0,0 +1,135 @@
+package edit
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/hashicorp/go-getter"
+	"kcl-lang.io/kpm/pkg/client"
+	"kcl-lang.io/krm-kcl/pkg/source"
+)
+
+// ResolveLock resolves the remote sources and the dependencies of the KCLRuns to the digests of their
+// content, and the Git sources to the commits, and returns the lock. The local and the inline sources
+// are not locked.
+func ResolveLock(ctx context.Context, sources []string, dependencies []string) (*source.Lock, error) {
+	return ResolveLockWithCredentials(ctx, sources, dependencies, nil)
+}
+
+// ResolveLockWithCredentials resolves the lock in the same way as ResolveLock, and authenticates the
+// OCI registries and the Git repositories of the sources and the dependencies with the credentials
+// of their hosts, which are the same credentials used to run the KCLRuns.
+func ResolveLockWithCredentials(ctx context.Context, sources []string, dependencies []string, creds CredentialsFunc) (*source.Lock, error) {
+	lock := source.NewLock()
+	for _, src := range sources {
+		if !source.IsRemote(src) {
+			continue
+		}
+		locked, err := lockSource(ctx, src, creds)
+		if err != nil {
+			return nil, source.RedactError(err)
+		}
+		lock.AddSource(*locked)
+	}
+	for _, d := range dependencies {
+		if d == "" {
+			continue
+		}
+		cli, err := client.NewKpmClient()
+		if err != nil {
+			return nil, err
+		}
+		var deps map[string]string
+		if err := runPhase(ctx, ResolvePhase, nil, func() (err error) {
+			deps, err = resolveDeps(ctx, cli, d, creds)
+			return err
+		}); err != nil {
+			return nil, source.RedactError(err)
+		}
+		for name, dir := range deps {
+			digest, err := source.DirDigest(dir)
+			if err != nil {
+				return nil, err
+			}
+			if err := lock.AddDependency(source.LockedDependency{Name: name, Digest: digest}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return lock, nil
+}
+
+// lockSource fetches the remote source with the credentials through the same paths as the run, and
+// locks it to the digest of its content and the commit.
+func lockSource(ctx context.Context, src string, creds CredentialsFunc) (*source.LockedSource, error) {
+	fetch := &source.FetchOptions{}
+	// The commit is recorded before the getter copies the subdirectory of the source out of the clone.
+	var commit string
+	opts := []getter.ClientOption{source.WithGitCommit(&commit)}
+	if creds != nil {
+		fetch.Credentials = func(host string) (string, string, error) {
+			cred, err := creds(host)
+			if err != nil || cred == nil {
+				return "", "", err
+			}
+			return cred.Username, cred.Password, nil
+		}
+		if source.IsGit(src) || source.IsVCSDomain(src) {
+			cred, err := creds(source.Host(src))
+			if err != nil {
+				return nil, err
+			}
+			if cred != nil {
+				opts = append(opts, source.WithBasicAuth(cred.Username, cred.Password))
+			}
+		}
+	}
+	var dir, tmpDir string
+	var err error
+	if source.IsOCI(src) {
+		dir, tmpDir, err = fetchOCISource(ctx, src, fetch)
+	} else {
+		dir, tmpDir, err = source.ReadThroughGetterWithContext(ctx, src, fetch, opts...)
+	}
+	if tmpDir != "" {
+		defer os.RemoveAll(tmpDir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	locked := &source.LockedSource{Source: src}
+	if source.IsGit(src) || source.IsVCSDomain(src) {
+		if commit == "" {
+			return nil, fmt.Errorf("failed to resolve the commit of %s", source.Redact(src))
+		}
+		locked.Commit = commit
+	}
+	if locked.Digest, err = source.DirDigest(dir); err != nil {
+		return nil, err
+	}
+	return locked, nil
+}
+
+// lockedSourceToTempEntry fetches the remote source pinned by the lock, and verifies the fetched
+// content against the lock.
+func lockedSourceToTempEntry(ctx context.Context, lock *source.Lock, src string, fetch *source.FetchOptions, opts ...getter.ClientOption) (*KCLEntryOrigin, error) {
+	pinned, err := lock.PinSource(src)
+	if err != nil {
+		return &KCLEntryOrigin{}, err
+	}
+	var dir, tmpDir string
+	if source.IsOCI(src) {
+		// The OCI sources are always pulled to be verified against the lock.
+		dir, tmpDir, err = fetchOCISource(ctx, pinned, fetch)
+	} else if _, s, ok := fetch.Sources().Detect(pinned); ok {
+		dir, tmpDir, err = s.Fetch(ctx, pinned, fetch, opts...)
+	} else {
+		err = fmt.Errorf("no source is registered for %s", source.Redact(pinned))
+	}
+	entry := &KCLEntryOrigin{dir, tmpDir}
+	if err != nil {
+		return entry, err
+	}
+	return entry, lock.VerifySource(src, dir)
+}
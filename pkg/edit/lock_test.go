@@ -0,0 +1,92 @@
+package edit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"kcl-lang.io/krm-kcl/pkg/source"
+	"sigs.k8s.io/kustomize/kyaml/errors"
+)
+
+func TestSourceToTempEntryWithLock(t *testing.T) {
+	code := "a = 1"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(code))
+	}))
+	defer server.Close()
+	src := server.URL + "/main.k"
+
+	lock, err := ResolveLock(context.Background(), []string{src, "a = 1", "./main.k"}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, lock.Sources, 1)
+	fetch := &source.FetchOptions{Lock: lock}
+
+	entry, err := SourceToTempEntryWithContext(context.Background(), src, fetch)
+	defer KCLEntryOriginTmpDirCleanup(entry)
+	assert.NoError(t, err)
+	data, err := os.ReadFile(filepath.Join(entry.source, "main.k"))
+	assert.NoError(t, err)
+	assert.Equal(t, code, string(data))
+
+	// The source drifts from the lock.
+	code = "a = 2"
+	entry, err = SourceToTempEntryWithContext(context.Background(), src, fetch)
+	defer KCLEntryOriginTmpDirCleanup(entry)
+	var drift *source.LockDriftError
+	assert.True(t, errors.As(err, &drift))
+
+	// The sources which are not locked are rejected.
+	_, err = SourceToTempEntryWithContext(context.Background(), server.URL+"/other.k", fetch)
+	assert.EqualError(t, err, "lock drift: [source "+server.URL+"/other.k is not locked]")
+
+	// The inline sources are not locked.
+	entry, err = SourceToTempEntryWithContext(context.Background(), "a = 1", fetch)
+	defer KCLEntryOriginTmpDirCleanup(entry)
+	assert.NoError(t, err)
+
+	// The lock file of the KCL_LOCK_FILE environment variable is used when the options have no lock.
+	lockFile := filepath.Join(t.TempDir(), source.LockFileName)
+	assert.NoError(t, lock.Write(lockFile))
+	t.Setenv(source.LockFileEnvVar, lockFile)
+	_, err = SourceToTempEntry(server.URL + "/other.k")
+	assert.EqualError(t, err, "lock drift: [source "+server.URL+"/other.k is not locked]")
+}
+
+func TestLockGitSubdirSource(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the file URL of the repository is a Unix path")
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+	repo := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(repo, "examples"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(repo, "examples", "main.k"), []byte("a = 1\n"), 0644))
+	git := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = repo
+		out, err := cmd.CombinedOutput()
+		assert.NoError(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "-q")
+	git("add", ".")
+	git("commit", "-q", "-m", "init")
+	commit := git("rev-parse", "HEAD")
+
+	// Only the subdirectory is copied out of the clone, and the commit is resolved before that.
+	locked, err := lockSource(context.Background(), "git::file://"+repo+"//examples", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, commit, locked.Commit)
+	digest, err := source.DirDigest(filepath.Join(repo, "examples"))
+	assert.NoError(t, err)
+	assert.Equal(t, digest, locked.Digest)
+}
@@ -0,0 +1,141 @@
+package edit
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"kcl-lang.io/krm-kcl/pkg/api"
+	"sigs.k8s.io/kustomize/kyaml/errors"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// ParamsDefaultsFile is the file name of the default params shipped in the KCL source package.
+const ParamsDefaultsFile = "params.yaml"
+
+// MergeParams deep-merges the upper params layer into the lower layer and returns the merged params without
+// changing the layers. The objects are merged recursively, the lists are merged with the list merge strategy
+// and the other values in the upper layer replace the values in the lower layer.
+func MergeParams(lower, upper map[string]interface{}, spec *api.ParamsMergeSpec) map[string]interface{} {
+	out := make(map[string]interface{}, len(lower)+len(upper))
+	for k, v := range lower {
+		out[k] = v
+	}
+	for k, v := range upper {
+		out[k] = mergeValue(out[k], v, spec)
+	}
+	return out
+}
+
+// mergeValue merges the upper value into the lower value.
+func mergeValue(lower, upper interface{}, spec *api.ParamsMergeSpec) interface{} {
+	switch u := upper.(type) {
+	case map[string]interface{}:
+		if l, ok := lower.(map[string]interface{}); ok {
+			return MergeParams(l, u, spec)
+		}
+	case []interface{}:
+		if l, ok := lower.([]interface{}); ok {
+			return mergeList(l, u, spec)
+		}
+	}
+	return upper
+}
+
+// mergeList merges the upper list into the lower list with the list merge strategy.
+func mergeList(lower, upper []interface{}, spec *api.ParamsMergeSpec) []interface{} {
+	strategy, key := api.ReplaceListMerge, api.DefaultListMergeKey
+	if spec != nil {
+		if spec.Lists != "" {
+			strategy = spec.Lists
+		}
+		if spec.Key != "" {
+			key = spec.Key
+		}
+	}
+	switch strategy {
+	case api.AppendListMerge:
+		return append(append([]interface{}{}, lower...), upper...)
+	case api.MergeByKeyListMerge:
+		out := append([]interface{}{}, lower...)
+		for _, u := range upper {
+			idx := -1
+			if um, ok := u.(map[string]interface{}); ok && um[key] != nil {
+				for i, l := range out {
+					if lm, ok := l.(map[string]interface{}); ok && reflect.DeepEqual(lm[key], um[key]) {
+						idx = i
+						break
+					}
+				}
+			}
+			if idx < 0 {
+				out = append(out, u)
+			} else {
+				out[idx] = mergeValue(out[idx], u, spec)
+			}
+		}
+		return out
+	default:
+		return upper
+	}
+}
+
+// packageDir returns the local directory of the KCL source package, or "" if the package is not local,
+// e.g., the OCI sources which are fetched by the KCL package manager.
+func packageDir(entry *KCLEntryOrigin) string {
+	info, err := os.Stat(entry.source)
+	if err != nil {
+		return ""
+	} else if !info.IsDir() {
+		return filepath.Dir(entry.source)
+	}
+	return entry.source
+}
+
+// loadParamsDefaults returns the default params in the params.yaml file of the KCL source package,
+// or nil if the file does not exist.
+func loadParamsDefaults(entry *KCLEntryOrigin) (map[string]interface{}, error) {
+	dir := packageDir(entry)
+	if dir == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filepath.Join(dir, ParamsDefaultsFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	var defaults map[string]interface{}
+	if err := yaml.Unmarshal(data, &defaults); err != nil {
+		return nil, errors.WrapPrefixf(err, "failed to parse the default params %s", ParamsDefaultsFile)
+	}
+	return defaults, nil
+}
+
+// applyParamsDefaults returns a copy of the resource list whose function config params are merged onto the
+// default params with the `paramsMerge` of the function config.
+func applyParamsDefaults(resourceList *yaml.RNode, defaults map[string]interface{}) (*yaml.RNode, error) {
+	if len(defaults) == 0 {
+		return resourceList, nil
+	}
+	resourceList = resourceList.Copy()
+	spec, err := resourceList.Pipe(yaml.LookupCreate(yaml.MappingNode, "functionConfig", "spec"))
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	var s struct {
+		Params      map[string]interface{} `yaml:"params,omitempty"`
+		ParamsMerge api.ParamsMergeSpec    `yaml:"paramsMerge,omitempty"`
+	}
+	if err := yaml.Unmarshal([]byte(spec.MustString()), &s); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	params, err := yaml.FromMap(MergeParams(defaults, s.Params, &s.ParamsMerge))
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	if err := spec.PipeE(yaml.SetField(api.ParamsKey, params)); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return resourceList, nil
+}
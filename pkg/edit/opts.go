@@ -1,26 +1,118 @@
 package edit
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
-	"strings"
+	"regexp"
+	"strconv"
 
 	"kcl-lang.io/cli/pkg/options"
 	"kcl-lang.io/kpm/pkg/client"
 	"kcl-lang.io/krm-kcl/pkg/api"
+	"kcl-lang.io/krm-kcl/pkg/source"
 	"sigs.k8s.io/kustomize/kyaml/errors"
 	"sigs.k8s.io/kustomize/kyaml/yaml"
 )
 
+// defaultRegistryEnvVar is the environment variable of the default OCI registry of the registry dependencies.
+const defaultRegistryEnvVar = "KPM_REG"
+
+// gitDependenciesDirName is the directory in the temp directory of the Git dependencies cloned with the credentials.
+const gitDependenciesDirName = "krm-kcl-git-deps"
+
+// defaultRegistry is the default OCI registry of the registry dependencies, e.g., `k8s = "1.28"`
+const defaultRegistry = "ghcr.io"
+
+var (
+	// depOCIRegexp matches the OCI URLs of the dependencies, e.g., `{ oci = "oci://ghcr.io/kcl-lang/k8s", tag = "1.28" }`
+	depOCIRegexp = regexp.MustCompile(`\boci\s*=\s*"([^"]+)"`)
+	// depGitRegexp matches the Git URLs of the dependencies, e.g., `{ git = "https://github.com/kcl-lang/konfig", tag = "v0.4.0" }`
+	depGitRegexp = regexp.MustCompile(`\bgit\s*=\s*"([^"]+)"`)
+	// depGitTableRegexp matches the inline tables of the Git dependencies, e.g., `{ git = "https://github.com/kcl-lang/konfig", tag = "v0.4.0" }`
+	depGitTableRegexp = regexp.MustCompile(`\{[^{}]*\bgit\s*=\s*"[^"]+"[^{}]*\}`)
+	// depRefRegexp matches the refs of the Git dependencies, e.g., `tag = "v0.4.0"`
+	depRefRegexp = regexp.MustCompile(`\b(tag|commit|branch)\s*=\s*"([^"]+)"`)
+	// depRegistryRegexp matches the registry dependencies, e.g., `k8s = "1.28"` or `k8s = { version = "1.28" }`
+	depRegistryRegexp = regexp.MustCompile(`(?m)^\s*[\w-]+\s*=\s*("|\{\s*version\s*=)`)
+)
+
+// CredentialsFunc returns the credentials of the host, or nil if there are no credentials for the host.
+type CredentialsFunc func(host string) (*api.CredSpec, error)
+
 // LoadDepsFrom parses the kcl external package option from a path.
 // It will find `kcl.mod` recursively from the path, resolve deps
 // in the `kcl.mod` and return the option. If not found, return the
 // empty option.
 func LoadDepListFromConfig(cli *client.KpmClient, dependencies string) ([]string, error) {
+	return LoadDepListFromConfigWithCredentials(cli, dependencies, nil)
+}
+
+// LoadDepListFromConfigWithCredentials resolves the dependencies in the same way as LoadDepListFromConfig,
+// and authenticates the OCI registries and the Git repositories of the dependencies with the credentials
+// of their hosts.
+func LoadDepListFromConfigWithCredentials(cli *client.KpmClient, dependencies string, creds CredentialsFunc) ([]string, error) {
+	return LoadDepListFromConfigWithContext(context.Background(), cli, dependencies, creds, nil)
+}
+
+// LoadDepListFromConfigWithContext resolves the dependencies in the same way as LoadDepListFromConfigWithCredentials,
+// and returns a PhaseError of the ResolvePhase when the context is done before the dependencies are resolved.
+// The dependencies are verified against the lock, which defaults to the lock file of the KCL_LOCK_FILE
+// environment variable.
+func LoadDepListFromConfigWithContext(ctx context.Context, cli *client.KpmClient, dependencies string, creds CredentialsFunc, lock *source.Lock) ([]string, error) {
+	var deps []string
+	if err := runPhase(ctx, ResolvePhase, nil, func() (err error) {
+		deps, err = loadDepList(ctx, cli, dependencies, creds, lock)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return deps, nil
+}
+
+// loadDepList resolves the dependencies into the list of the `name=path` external packages, which are
+// verified against the lock, or the lock file of the KCL_LOCK_FILE environment variable if any.
+func loadDepList(ctx context.Context, cli *client.KpmClient, dependencies string, creds CredentialsFunc, lock *source.Lock) (_ []string, err error) {
+	// The errors may echo the dependency URLs with the credentials.
+	defer func() { err = source.RedactError(err) }()
+	depsMap, err := resolveDeps(ctx, cli, dependencies, creds)
+	if err != nil {
+		return nil, err
+	}
+	lock, err = (&source.FetchOptions{Lock: lock}).GetLock()
+	if err != nil {
+		return nil, err
+	}
+	if lock != nil {
+		if err := lock.VerifyDependencies(depsMap); err != nil {
+			return nil, err
+		}
+	}
+	deps := []string{}
+	for depName, depPath := range depsMap {
+		deps = append(deps, fmt.Sprintf("%s=%s", depName, depPath))
+	}
+	return deps, nil
+}
+
+// resolveDeps resolves the dependencies into the package names and the local paths.
+func resolveDeps(ctx context.Context, cli *client.KpmClient, dependencies string, creds CredentialsFunc) (map[string]string, error) {
 	if cli == nil {
 		return nil, nil
 	}
+	if creds != nil {
+		if err := loginDependencies(cli, dependencies, creds); err != nil {
+			return nil, err
+		}
+		var err error
+		if dependencies, err = fetchGitDependencies(ctx, dependencies, creds); err != nil {
+			return nil, err
+		}
+	}
 	cli.SetLogWriter(nil)
 	modData := fmt.Sprintf("[package]\n\n[dependencies]\n%s", dependencies)
 	// May be a inline code source.
@@ -39,18 +131,114 @@ func LoadDepListFromConfig(cli *client.KpmClient, dependencies string) ([]string
 	if err != nil {
 		return nil, err
 	}
-	depsMap, err := cli.ResolveDepsIntoMap(pkg)
+	return cli.ResolveDepsIntoMap(pkg)
+}
+
+// loginDependencies logs in the OCI registries of the dependencies with the credentials of their hosts.
+func loginDependencies(cli *client.KpmClient, dependencies string, creds CredentialsFunc) error {
+	var ociHosts []string
+	for _, m := range depOCIRegexp.FindAllStringSubmatch(dependencies, -1) {
+		ociHosts = append(ociHosts, source.Host(m[1]))
+	}
+	if depRegistryRegexp.MatchString(dependencies) {
+		registry := os.Getenv(defaultRegistryEnvVar)
+		if registry == "" {
+			registry = defaultRegistry
+		}
+		ociHosts = append(ociHosts, registry)
+	}
+	logged := map[string]bool{}
+	for _, host := range ociHosts {
+		if host == "" || logged[host] {
+			continue
+		}
+		logged[host] = true
+		cred, err := creds(host)
+		if err != nil {
+			return err
+		}
+		if cred == nil {
+			continue
+		}
+		if err := cli.LoginOci(host, cred.Username, cred.Password); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchGitDependencies clones the Git dependencies over HTTP(S) which have the credentials of their hosts
+// with the basic auth passed to the git commands only, and replaces them with the local path dependencies,
+// so kpm never needs the credentials. The clones are kept in the temp directory keyed by the repository
+// and the ref, and are refreshed on every fetch.
+func fetchGitDependencies(ctx context.Context, dependencies string, creds CredentialsFunc) (string, error) {
+	var errs []error
+	dependencies = depGitTableRegexp.ReplaceAllStringFunc(dependencies, func(table string) string {
+		repo := depGitRegexp.FindStringSubmatch(table)[1]
+		u, err := url.Parse(repo)
+		if err != nil || (u.Scheme != source.HttpScheme && u.Scheme != source.HttpsScheme) {
+			// Only the Git repositories over HTTP(S) are authenticated with the basic auth.
+			return table
+		}
+		cred, err := creds(u.Host)
+		if err != nil {
+			errs = append(errs, err)
+			return table
+		}
+		if cred == nil {
+			return table
+		}
+		src := source.GitScheme + "::" + repo
+		if m := depRefRegexp.FindStringSubmatch(table); m != nil {
+			src += "?ref=" + url.QueryEscape(m[2])
+		}
+		dir, err := fetchGitDependency(ctx, src, cred)
+		if err != nil {
+			errs = append(errs, err)
+			return table
+		}
+		return fmt.Sprintf("{ path = %s }", strconv.Quote(filepath.ToSlash(dir)))
+	})
+	if len(errs) > 0 {
+		return "", errs[0]
+	}
+	return dependencies, nil
+}
+
+// fetchGitDependency clones the Git dependency with the credentials, and moves the clone to the directory
+// keyed by the source in the temp directory.
+func fetchGitDependency(ctx context.Context, src string, cred *api.CredSpec) (string, error) {
+	dir, tmpDir, err := source.ReadThroughGetterWithContext(ctx, src, nil, source.WithBasicAuth(cred.Username, cred.Password))
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		return "", err
+	}
+	rel, err := filepath.Rel(tmpDir, dir)
 	if err != nil {
-		return nil, err
+		os.RemoveAll(tmpDir)
+		return "", err
 	}
-	deps := []string{}
-	for depName, depPath := range depsMap {
-		deps = append(deps, fmt.Sprintf("%s=%s", depName, depPath))
+	sum := sha256.Sum256([]byte(src))
+	keyed := filepath.Join(os.TempDir(), gitDependenciesDirName, hex.EncodeToString(sum[:]))
+	if err := os.MkdirAll(filepath.Dir(keyed), 0755); err != nil {
+		os.RemoveAll(tmpDir)
+		return "", err
 	}
-	return deps, nil
+	if err := os.RemoveAll(keyed); err != nil {
+		os.RemoveAll(tmpDir)
+		return "", err
+	}
+	if err := os.Rename(tmpDir, keyed); err != nil {
+		// Another run has just refreshed the same clone.
+		os.RemoveAll(tmpDir)
+		if _, statErr := os.Stat(keyed); statErr != nil {
+			return "", err
+		}
+	}
+	return filepath.Join(keyed, rel), nil
 }
 
-func constructOptions(resourceList *yaml.RNode, config *api.ConfigSpec) (*options.RunOptions, error) {
+func constructOptions(resourceList *yaml.RNode, config *api.ConfigSpec, envPolicy *EnvPolicy) (*options.RunOptions, error) {
 	resourceListOptionKCLValue, err := ToKCLValueString(resourceList, emptyConfig)
 	if err != nil {
 		return nil, errors.Wrap(err)
@@ -71,11 +259,11 @@ func constructOptions(resourceList *yaml.RNode, config *api.ConfigSpec) (*option
 	if err != nil {
 		return nil, errors.Wrap(err)
 	}
-	// 4. Read environment variables.
-	pathOptionKCLValue := os.Getenv("PATH")
+	// 4. Read the environment variables allowed by the env policy.
+	env := envPolicy.Environ()
 
 	// 5. Read Env map
-	envMapOptionKCLValue, err := getEnvMapOptionKCLValue()
+	envMapOptionKCLValue, err := getEnvMapOptionKCLValue(env)
 	if err != nil {
 		return nil, errors.Wrap(err)
 	}
@@ -100,25 +288,20 @@ func constructOptions(resourceList *yaml.RNode, config *api.ConfigSpec) (*option
 		fmt.Sprintf("%s=%s", itemsOptionName, itemsOptionKCLValue),
 		// resource.functionConfig.spec.params
 		fmt.Sprintf("%s=%s", paramsOptionName, paramsOptionKCLValue),
-		// environment variable example (PATH)
-		fmt.Sprintf("PATH=%s", pathOptionKCLValue),
 		// environment map example (option("env"))
 		fmt.Sprintf("env=%s", envMapOptionKCLValue),
 	)
+	// environment variable example (PATH)
+	if path, ok := env[pathEnvVar]; ok {
+		opts.Arguments = append(opts.Arguments, fmt.Sprintf("%s=%s", pathEnvVar, path))
+	}
 	return opts, nil
 }
 
-// getEnvMapOptionKCLValue retrieves the environment map from the KCL 'option("env")' function.
-func getEnvMapOptionKCLValue() (string, error) {
-	envMap := make(map[string]string)
-	env := os.Environ()
-	for _, e := range env {
-		pair := strings.SplitN(e, "=", 2)
-		envMap[pair[0]] = pair[1]
-	}
-
+// getEnvMapOptionKCLValue converts the environment map to the value of the KCL 'option("env")' function.
+func getEnvMapOptionKCLValue(env map[string]string) (string, error) {
 	envMapInterface := make(map[string]interface{})
-	for k, v := range envMap {
+	for k, v := range env {
 		envMapInterface[k] = v
 	}
 
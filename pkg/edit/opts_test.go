@@ -0,0 +1,42 @@
+package edit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"kcl-lang.io/krm-kcl/pkg/api"
+)
+
+func TestFetchGitDependencies(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake git command is a shell script")
+	}
+	// The fake git command clones a repository with one file.
+	bin := t.TempDir()
+	script := "#!/bin/sh\nif [ \"$1\" = clone ]; then mkdir -p \"$4\" && echo 'a = 1' > \"$4/main.k\"; fi\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(bin, "git"), []byte(script), 0755))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	creds := func(host string) (*api.CredSpec, error) {
+		if host == "git.example.com" {
+			return &api.CredSpec{Username: "user", Password: "password"}, nil
+		}
+		return nil, nil
+	}
+	deps, err := fetchGitDependencies(context.Background(), `konfig = { git = "https://git.example.com/konfig", tag = "v0.4.0" }
+public = { git = "https://github.com/kcl-lang/konfig", tag = "v0.4.0" }
+k8s = "1.28"
+`, creds)
+	assert.NoError(t, err)
+	m := regexp.MustCompile(`konfig = \{ path = "([^"]+)" \}`).FindStringSubmatch(deps)
+	if assert.NotNil(t, m, deps) {
+		assert.FileExists(t, filepath.Join(filepath.FromSlash(m[1]), "main.k"))
+	}
+	assert.Contains(t, deps, `public = { git = "https://github.com/kcl-lang/konfig", tag = "v0.4.0" }`)
+	assert.Contains(t, deps, `k8s = "1.28"`)
+}
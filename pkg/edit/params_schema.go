@@ -0,0 +1,359 @@
+package edit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/kube-openapi/pkg/validation/errors"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+	"k8s.io/kube-openapi/pkg/validation/strfmt"
+	"k8s.io/kube-openapi/pkg/validation/validate"
+	"kcl-lang.io/cli/pkg/options"
+	"kcl-lang.io/krm-kcl/pkg/source"
+	kerrors "sigs.k8s.io/kustomize/kyaml/errors"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const (
+	// ParamsSchemaFile is the file name of the JSON Schema of the params shipped in the KCL source package.
+	ParamsSchemaFile = "params.schema.json"
+	// ParamsSchemaName is the name of the KCL schema of the params declared in the KCL source package.
+	ParamsSchemaName = "Params"
+	// paramsPackageName is the name to import the package without a kcl.mod file by to check the params.
+	paramsPackageName = "params_schema_package"
+)
+
+var (
+	// paramsSchemaRegexp matches the declaration of the params KCL schema, e.g., `schema Params:`
+	paramsSchemaRegexp = regexp.MustCompile(`(?m)^schema\s+` + ParamsSchemaName + `\b`)
+	// modNameRegexp matches the package name in the kcl.mod file, e.g., `name = "set-annotations"`
+	modNameRegexp = regexp.MustCompile(`(?m)^\s*name\s*=\s*"([^"]+)"`)
+	// checkBlockRegexp matches the check block of a schema, e.g., `    check:`
+	checkBlockRegexp = regexp.MustCompile(`^\s+check\s*:\s*$`)
+	// attributeDeclRegexp matches the attribute declaration of a schema, e.g., `    replicas?: int = 1`
+	attributeDeclRegexp = regexp.MustCompile(`^\s+([A-Za-z_]\w*)\??\s*:`)
+	// requiredAttributeRegexp matches the KCL error of a missing required attribute,
+	// e.g., `attribute 'name' of Params is required and can't be None or Undefined`
+	requiredAttributeRegexp = regexp.MustCompile(`attribute '([^']+)' of (\w+) is required`)
+	// stringLiteralRegexp matches the string literals in a KCL expression.
+	stringLiteralRegexp = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'`)
+	// identifierRegexp matches the identifiers in a KCL expression.
+	identifierRegexp = regexp.MustCompile(`[A-Za-z_]\w*`)
+)
+
+// ParamsViolation is a violation of the params schema.
+type ParamsViolation struct {
+	// Path is the params path of the violation, e.g., params.labels.app
+	Path string
+	// Message describes the violation.
+	Message string
+}
+
+func (v ParamsViolation) String() string {
+	return fmt.Sprintf("%s: %s", v.Path, v.Message)
+}
+
+// ParamsValidationError is returned when the params violate the params schema of the KCL source package.
+type ParamsValidationError struct {
+	// Violations are all the violations of the params schema.
+	Violations []ParamsViolation
+}
+
+func (e *ParamsValidationError) Error() string {
+	violations := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		violations[i] = v.String()
+	}
+	return fmt.Sprintf("invalid params: [%s]", strings.Join(violations, ", "))
+}
+
+// validateParams validates the function config params in the resource list against the params schema of the
+// KCL source package before the KCL program is run. The JSON Schema file takes precedence over the KCL schema,
+// and the params are not validated if the package does not declare a params schema. The OCI sources must be
+// pulled into local packages before.
+func validateParams(entry *KCLEntryOrigin, resourceList *yaml.RNode, opts *options.RunOptions) error {
+	dir := packageDir(entry)
+	if dir == "" {
+		if source.IsOCI(entry.source) {
+			return fmt.Errorf("the params schema could not be loaded: the OCI source %s is not pulled", entry.source)
+		}
+		return nil
+	}
+	data, err := os.ReadFile(filepath.Join(dir, ParamsSchemaFile))
+	if err == nil {
+		return validateParamsWithJSONSchema(data, resourceList)
+	} else if !os.IsNotExist(err) {
+		return kerrors.Wrap(err)
+	}
+	declared, err := declaresParamsSchema(dir)
+	if err != nil || !declared {
+		return err
+	}
+	return validateParamsWithKCLSchema(dir, opts)
+}
+
+// validateParamsWithJSONSchema validates the params against the JSON Schema and returns all the violations.
+func validateParamsWithJSONSchema(data []byte, resourceList *yaml.RNode) error {
+	schema := &spec.Schema{}
+	if err := json.Unmarshal(data, schema); err != nil {
+		return kerrors.WrapPrefixf(err, "failed to parse the params schema %s", ParamsSchemaFile)
+	}
+	v, err := resourceList.Pipe(yaml.Lookup("functionConfig", "spec", "params"))
+	if err != nil {
+		return kerrors.Wrap(err)
+	}
+	// Validate the params in the JSON form, which is the form of `option("params")`.
+	value, err := ToKCLValueString(v, emptyConfig)
+	if err != nil {
+		return err
+	}
+	var params interface{}
+	if err := json.Unmarshal([]byte(value), &params); err != nil {
+		return kerrors.Wrap(err)
+	}
+	errs := validate.NewSchemaValidator(schema, nil, paramsOptionName, strfmt.Default).Validate(params).Errors
+	if len(errs) == 0 {
+		return nil
+	}
+	violations := make([]ParamsViolation, 0, len(errs))
+	for _, err := range errs {
+		violation := ParamsViolation{Path: paramsOptionName, Message: err.Error()}
+		if e, ok := err.(*errors.Validation); ok && e.Name != "" {
+			violation.Path = e.Name
+			violation.Message = strings.TrimPrefix(e.Error(), e.Name+" in body ")
+		}
+		violations = append(violations, violation)
+	}
+	// Sort the violations by the paths to get a stable output.
+	sort.SliceStable(violations, func(i, j int) bool { return violations[i].Path < violations[j].Path })
+	return &ParamsValidationError{Violations: violations}
+}
+
+// declaresParamsSchema returns whether the KCL files in the package root declare the params KCL schema.
+func declaresParamsSchema(dir string) (bool, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.k"))
+	if err != nil {
+		return false, kerrors.Wrap(err)
+	}
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.k") {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return false, kerrors.Wrap(err)
+		}
+		if paramsSchemaRegexp.Match(data) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// validateParamsWithKCLSchema validates the params against the params KCL schema by running a KCL program
+// which imports the package and converts the params to the schema with the same options as the run. The KCL
+// schema checks stop at the first violation, so the program is run again without the params attributes which
+// are found to violate the schema until it passes, and all the violations are reported with their paths.
+func validateParamsWithKCLSchema(dir string, opts *options.RunOptions) error {
+	schema, err := loadParamsKCLSchema(dir)
+	if err != nil {
+		return err
+	}
+	tmpDir, err := os.MkdirTemp("", "kcl-sandbox-params")
+	if err != nil {
+		return fmt.Errorf("error creating temp directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	file := filepath.Join(tmpDir, "params.k")
+	var violations []ParamsViolation
+	excluded := []string{}
+	for {
+		err := checkParamsWithKCLSchema(schema, file, excluded, opts)
+		if err == nil {
+			break
+		}
+		path, attr := paramsOptionName, schema.attribute(err)
+		if attr != "" {
+			if slices.Contains(excluded, attr) {
+				// A violating attribute which is required is reported as missing after it is excluded,
+				// and the other attributes have passed the type checks.
+				break
+			}
+			path += "." + attr
+			excluded = append(excluded, attr)
+		}
+		violations = append(violations, ParamsViolation{Path: path, Message: strings.TrimSpace(err.Error())})
+		if attr == "" {
+			// The violation can not be attributed to a params attribute, and the check can not go on.
+			break
+		}
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	sort.SliceStable(violations, func(i, j int) bool { return violations[i].Path < violations[j].Path })
+	return &ParamsValidationError{Violations: violations}
+}
+
+// checkParamsWithKCLSchema runs the KCL program which converts the params without the excluded attributes
+// to the params KCL schema, and returns the error of the run.
+func checkParamsWithKCLSchema(schema *paramsKCLSchema, file string, excluded []string, opts *options.RunOptions) error {
+	names, err := json.Marshal(excluded)
+	if err != nil {
+		return kerrors.Wrap(err)
+	}
+	code := fmt.Sprintf(`import %[1]s
+
+_excluded = %[2]s
+_input = option("%[3]s") or {}
+_params: %[1]s.%[4]s = {k: v for k, v in _input if k not in _excluded}
+`, schema.name, names, paramsOptionName, ParamsSchemaName)
+	if err := os.WriteFile(file, []byte(code), 0666); err != nil {
+		return kerrors.Wrap(err)
+	}
+	check := *opts
+	check.Entries = []string{file}
+	check.Oci, check.Tag = "", ""
+	check.ExternalPackages = append(append([]string{}, opts.ExternalPackages...), fmt.Sprintf("%s=%s", schema.name, schema.dir))
+	check.Writer = io.Discard
+	if err := check.Complete([]string{}); err != nil {
+		return kerrors.Wrap(err)
+	}
+	if err := check.Validate(); err != nil {
+		return kerrors.Wrap(err)
+	}
+	return check.Run()
+}
+
+// paramsKCLSchema is the params KCL schema declared in the package.
+type paramsKCLSchema struct {
+	// name is the name to import the package by.
+	name string
+	// dir is the package directory.
+	dir string
+	// file is the KCL file which declares the schema.
+	file string
+	// attributes are the schema attributes keyed by the lines of their declarations.
+	attributes map[int]string
+	// checks are the check conditions of the schema keyed by their lines.
+	checks map[int]string
+}
+
+// loadParamsKCLSchema loads the params KCL schema declared in the package. The package is imported by the
+// name in its kcl.mod file, and by the default name if it has no kcl.mod file.
+func loadParamsKCLSchema(dir string) (*paramsKCLSchema, error) {
+	schema := &paramsKCLSchema{name: paramsPackageName, dir: dir}
+	mod, err := os.ReadFile(filepath.Join(dir, "kcl.mod"))
+	if err == nil {
+		m := modNameRegexp.FindSubmatch(mod)
+		if m == nil {
+			return nil, fmt.Errorf("the params schema could not be loaded: the package name is not found in %s", filepath.Join(dir, "kcl.mod"))
+		}
+		schema.name = strings.ReplaceAll(string(m[1]), "-", "_")
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("the params schema could not be loaded: %v", err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.k"))
+	if err != nil {
+		return nil, kerrors.Wrap(err)
+	}
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.k") {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("the params schema could not be loaded: %v", err)
+		}
+		if paramsSchemaRegexp.Match(data) {
+			schema.file = file
+			schema.parse(string(data))
+			return schema, nil
+		}
+	}
+	return nil, fmt.Errorf("the params schema could not be loaded: the schema %s is not found in %s", ParamsSchemaName, dir)
+}
+
+// parse records the attribute declarations and the check conditions of the schema body in the KCL code.
+func (s *paramsKCLSchema) parse(code string) {
+	s.attributes, s.checks = map[int]string{}, map[int]string{}
+	inSchema, inCheck := false, false
+	for i, line := range strings.Split(code, "\n") {
+		if paramsSchemaRegexp.MatchString(line) {
+			inSchema, inCheck = true, false
+			continue
+		}
+		if !inSchema || strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
+			// The schema body ends at the next unindented statement.
+			inSchema = false
+			continue
+		}
+		// The lines of the KCL error locations start at 1.
+		if checkBlockRegexp.MatchString(line) {
+			inCheck = true
+		} else if inCheck {
+			s.checks[i+1] = line
+		} else if m := attributeDeclRegexp.FindStringSubmatch(line); m != nil {
+			s.attributes[i+1] = m[1]
+		}
+	}
+}
+
+// attribute returns the schema attribute which the KCL error of the params check is raised for, or an empty
+// string if the error can not be attributed to a single attribute. The required attributes are named in the
+// errors, and the other errors are located at the declarations of the attributes, or at the check conditions
+// which refer to one attribute.
+func (s *paramsKCLSchema) attribute(err error) string {
+	msg := err.Error()
+	if m := requiredAttributeRegexp.FindStringSubmatch(msg); m != nil && m[2] == ParamsSchemaName {
+		return m[1]
+	}
+	for _, m := range errorLocationRegexp.FindAllStringSubmatch(msg, -1) {
+		if filepath.Clean(m[1]) != filepath.Clean(s.file) {
+			continue
+		}
+		line, err := strconv.Atoi(m[2])
+		if err != nil {
+			continue
+		}
+		if attr, ok := s.attributes[line]; ok {
+			return attr
+		}
+		if cond, ok := s.checks[line]; ok {
+			return s.conditionAttribute(cond)
+		}
+	}
+	return ""
+}
+
+// conditionAttribute returns the only schema attribute which the check condition refers to, or an empty
+// string if it refers to none or several.
+func (s *paramsKCLSchema) conditionAttribute(cond string) string {
+	// The string literals, e.g., the check message, do not refer to the attributes.
+	cond = stringLiteralRegexp.ReplaceAllString(cond, `""`)
+	attrs := map[string]bool{}
+	for _, attr := range s.attributes {
+		attrs[attr] = true
+	}
+	var found string
+	for _, ident := range identifierRegexp.FindAllString(cond, -1) {
+		if !attrs[ident] || ident == found {
+			continue
+		} else if found != "" {
+			return ""
+		}
+		found = ident
+	}
+	return found
+}
@@ -0,0 +1,172 @@
+package edit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/kyaml/errors"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const paramsSchema = `{
+  "type": "object",
+  "required": ["name"],
+  "properties": {
+    "name": {"type": "string"},
+    "replicas": {"type": "integer", "minimum": 1},
+    "labels": {
+      "type": "object",
+      "additionalProperties": {"type": "string"}
+    }
+  }
+}`
+
+func TestValidateParams(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, ParamsSchemaFile), []byte(paramsSchema), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "main.k"), []byte("a = 1"), 0644))
+	entry := &KCLEntryOrigin{source: filepath.Join(dir, "main.k")}
+
+	testcases := []struct {
+		name         string
+		params       string
+		expectErrMsg string
+	}{
+		{
+			name: "valid params",
+			params: `
+      name: app
+      replicas: 3
+      labels:
+        env: prod
+`,
+		},
+		{
+			name: "invalid params",
+			params: `
+      replicas: 0
+      labels:
+        env: 1
+`,
+			expectErrMsg: "invalid params: [params.labels.env: must be of type string: \"number\", params.name: is required, params.replicas: should be greater than or equal to 1]",
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			resourceList := yaml.MustParse(`apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+functionConfig:
+  apiVersion: krm.kcl.dev/v1alpha1
+  kind: KCLRun
+  spec:
+    source: a = 1
+    params:` + tc.params)
+			err := validateParams(entry, resourceList, nil)
+			if tc.expectErrMsg != "" {
+				assert.EqualError(t, err, tc.expectErrMsg)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+	// The OCI sources which are not pulled can not be validated.
+	assert.EqualError(t, validateParams(&KCLEntryOrigin{source: "oci://ghcr.io/kcl-lang/set-annotation"}, nil, nil),
+		"the params schema could not be loaded: the OCI source oci://ghcr.io/kcl-lang/set-annotation is not pulled")
+}
+
+const paramsKCLSchemaCode = `import regex
+
+schema Params:
+    # The application name.
+    name: str
+    replicas?: int = 1
+    labels?: {str:str}
+
+    check:
+        replicas >= 1, "replicas must be positive"
+        regex.match(name, "^[a-z]+$")
+        not labels or len(labels) <= len(name)
+
+items = option("items")
+`
+
+func TestLoadParamsKCLSchema(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "main.k")
+	assert.NoError(t, os.WriteFile(file, []byte(paramsKCLSchemaCode), 0644))
+	// The package without a kcl.mod file is imported by the default name.
+	schema, err := loadParamsKCLSchema(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, paramsPackageName, schema.name)
+	assert.Equal(t, file, schema.file)
+	assert.Equal(t, map[int]string{5: "name", 6: "replicas", 7: "labels"}, schema.attributes)
+
+	testcases := []struct {
+		name         string
+		err          string
+		expectedAttr string
+	}{
+		{
+			name:         "required attribute",
+			err:          "EvaluationError\nattribute 'name' of Params is required and can't be None or Undefined",
+			expectedAttr: "name",
+		},
+		{
+			name:         "attribute type",
+			err:          "EvaluationError\n --> /tmp/params.k:5:1\n  |\n --> " + file + ":6:5\n  |\n6 |     replicas?: int = 1\n  | expect int, got str",
+			expectedAttr: "replicas",
+		},
+		{
+			name:         "check condition of an attribute",
+			err:          "EvaluationError\n --> " + file + ":11:1\n  |\n11 |         regex.match(name, \"^[a-z]+$\")\n  | Check failed on the condition",
+			expectedAttr: "name",
+		},
+		{
+			name: "check condition of several attributes",
+			err:  "EvaluationError\n --> " + file + ":12:1\n  |\n  | Check failed on the condition",
+		},
+		{
+			name: "other file",
+			err:  "EvaluationError\n --> /tmp/other.k:6:5\n  |\n  | expect int, got str",
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedAttr, schema.attribute(errors.Errorf("%s", tc.err)))
+		})
+	}
+
+	// The package is imported by the name in the kcl.mod file.
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "kcl.mod"), []byte("[package]\nname = \"set-replicas\"\n"), 0644))
+	schema, err = loadParamsKCLSchema(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "set_replicas", schema.name)
+	// The schema can not be loaded without the package name.
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "kcl.mod"), []byte("[package]\n"), 0644))
+	_, err = loadParamsKCLSchema(dir)
+	assert.EqualError(t, err, "the params schema could not be loaded: the package name is not found in "+filepath.Join(dir, "kcl.mod"))
+}
+
+func TestTransformInvalidParams(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, ParamsSchemaFile), []byte(paramsSchema), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "main.k"), []byte("items = option(\"items\")"), 0644))
+	st := &SimpleTransformer{
+		Source: dir,
+		FunctionConfig: yaml.MustParse(`apiVersion: krm.kcl.dev/v1alpha1
+kind: KCLRun
+spec:
+  params:
+    replicas: 0
+`),
+	}
+	// The params violations fail the run instead of being reported as the results.
+	out, results, err := st.TransformWithResults([]*yaml.RNode{yaml.MustParse("kind: Deployment")})
+	assert.Nil(t, out)
+	assert.Nil(t, results)
+	var paramsErr *ParamsValidationError
+	assert.True(t, errors.As(err, &paramsErr))
+	assert.EqualError(t, err, "invalid params: [params.name: is required, params.replicas: should be greater than or equal to 1]")
+}
@@ -0,0 +1,136 @@
+package edit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/go-getter"
+	"kcl-lang.io/krm-kcl/pkg/source"
+)
+
+const (
+	// FetchPhase is the phase of fetching the KCL source.
+	FetchPhase = "fetching the source"
+	// ResolvePhase is the phase of resolving the external dependencies.
+	ResolvePhase = "resolving the dependencies"
+	// EvaluatePhase is the phase of evaluating the KCL program.
+	EvaluatePhase = "evaluating the KCL program"
+)
+
+// PhaseError is returned when the KCL run times out or is canceled in a phase. The KCL evaluation can not
+// be interrupted, so it keeps running in the background until it finishes, and the timeout only stops it
+// when the process exits, e.g., the KRM function process which reports the error. The long-running
+// embedders can wait on Done for the abandoned phase.
+type PhaseError struct {
+	// Phase is the phase in which the run is stopped, e.g., EvaluatePhase.
+	Phase string
+	// Err is the context error, e.g., context.DeadlineExceeded.
+	Err error
+	// done is closed when the abandoned phase function returns, or nil if no function is abandoned.
+	done <-chan struct{}
+}
+
+// Done returns a channel which is closed when the abandoned phase function returns, and for the errors
+// of RunKCLWithContext, after the temp directories of the run are removed too. The channel is closed at
+// once if the phase has not started.
+func (e *PhaseError) Done() <-chan struct{} {
+	if e.done == nil {
+		done := make(chan struct{})
+		close(done)
+		return done
+	}
+	return e.done
+}
+
+func (e *PhaseError) Error() string {
+	if errors.Is(e.Err, context.DeadlineExceeded) {
+		return fmt.Sprintf("the KCL run timed out while %s", e.Phase)
+	}
+	return fmt.Sprintf("the KCL run was canceled while %s: %v", e.Phase, e.Err)
+}
+
+func (e *PhaseError) Unwrap() error {
+	return e.Err
+}
+
+// runPhase runs the function of the phase and returns a PhaseError when the context is done before
+// the function returns. The KCL runtime and the KCL package manager can not be interrupted, so the
+// function keeps running in the background in that case, and the cleanups, if not nil, are deferred
+// until it returns, e.g., the source directory is not removed while the abandoned evaluation reads it.
+// The caller must not read the states written by the function after the PhaseError is returned.
+func runPhase(ctx context.Context, phase string, c *cleanups, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return &PhaseError{Phase: phase, Err: err}
+	}
+	done := make(chan error, 1)
+	returned := make(chan struct{})
+	go func() {
+		defer close(returned)
+		done <- fn()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		c.wait(returned)
+		return &PhaseError{Phase: phase, Err: ctx.Err(), done: returned}
+	}
+}
+
+// cleanups are the cleanup functions of a KCL run, e.g., removing the temp source directory, which
+// run in the reverse order after the abandoned phase functions of the run return.
+type cleanups struct {
+	fns []func()
+	// pending are closed when the abandoned phase functions return.
+	pending []<-chan struct{}
+}
+
+// add adds the cleanup function.
+func (c *cleanups) add(fn func()) {
+	c.fns = append(c.fns, fn)
+}
+
+// wait defers the cleanups until the channel is closed.
+func (c *cleanups) wait(returned <-chan struct{}) {
+	if c != nil {
+		c.pending = append(c.pending, returned)
+	}
+}
+
+// run runs the cleanup functions at once, or in the background after the abandoned phase functions return,
+// and returns a channel which is closed after the cleanup functions run.
+func (c *cleanups) run() <-chan struct{} {
+	fns, pending := c.fns, c.pending
+	done := make(chan struct{})
+	cleanup := func() {
+		defer close(done)
+		for i := len(fns) - 1; i >= 0; i-- {
+			fns[i]()
+		}
+	}
+	if len(pending) == 0 {
+		cleanup()
+		return done
+	}
+	go func() {
+		for _, p := range pending {
+			<-p
+		}
+		cleanup()
+	}()
+	return done
+}
+
+// fetchSource fetches the KCL source in the fetch phase, and the remote source fetch is stopped
+// when the context is done.
+func fetchSource(ctx context.Context, src string, fetch *source.FetchOptions, opts ...getter.ClientOption) (*KCLEntryOrigin, error) {
+	if err := ctx.Err(); err != nil {
+		return &KCLEntryOrigin{}, &PhaseError{Phase: FetchPhase, Err: err}
+	}
+	entry, err := SourceToTempEntryWithContext(ctx, src, fetch, opts...)
+	if err != nil && ctx.Err() != nil {
+		return entry, &PhaseError{Phase: FetchPhase, Err: ctx.Err()}
+	}
+	return entry, err
+}
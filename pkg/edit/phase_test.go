@@ -0,0 +1,93 @@
+package edit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/kyaml/errors"
+)
+
+func TestRunPhase(t *testing.T) {
+	// The function returns before the deadline.
+	assert.NoError(t, runPhase(context.Background(), EvaluatePhase, nil, func() error { return nil }))
+
+	// The function blocks until the deadline.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	block := make(chan struct{})
+	defer close(block)
+	err := runPhase(ctx, EvaluatePhase, nil, func() error {
+		<-block
+		return nil
+	})
+	assert.EqualError(t, err, "the KCL run timed out while evaluating the KCL program")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	// The context is canceled before the phase.
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	err = runPhase(ctx, ResolvePhase, nil, func() error {
+		t.Fatal("the function must not run")
+		return nil
+	})
+	assert.EqualError(t, err, "the KCL run was canceled while resolving the dependencies: context canceled")
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestCleanupsWaitForAbandonedPhase(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	c := &cleanups{}
+	var order []string
+	cleaned := make(chan struct{})
+	c.add(func() { order = append(order, "first"); close(cleaned) })
+	c.add(func() { order = append(order, "second") })
+	block := make(chan struct{})
+	err := runPhase(ctx, EvaluatePhase, c, func() error {
+		<-block
+		return nil
+	})
+	var phaseErr *PhaseError
+	assert.True(t, errors.As(err, &phaseErr))
+	// The cleanups wait for the abandoned function.
+	done := c.run()
+	select {
+	case <-cleaned:
+		t.Fatal("the cleanups must not run before the abandoned function returns")
+	case <-phaseErr.Done():
+		t.Fatal("the phase must not be done before the abandoned function returns")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(block)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the cleanups must run after the abandoned function returns")
+	}
+	<-phaseErr.Done()
+	assert.Equal(t, []string{"second", "first"}, order)
+
+	// The cleanups run at once without any abandoned function.
+	c = &cleanups{}
+	ran := false
+	c.add(func() { ran = true })
+	c.run()
+	assert.True(t, ran)
+}
+
+func TestRunKCLWithCanceledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := RunKCLWithContext(ctx, "", "a = 1", nil, &RunOptions{})
+	var phaseErr *PhaseError
+	assert.True(t, errors.As(err, &phaseErr))
+	assert.Equal(t, FetchPhase, phaseErr.Phase)
+	// No phase is abandoned, and the run is done at once.
+	select {
+	case <-phaseErr.Done():
+	default:
+		t.Fatal("the run must be done without any abandoned phase")
+	}
+}
@@ -0,0 +1,159 @@
+package edit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"kcl-lang.io/kpm/pkg/client"
+	"kcl-lang.io/krm-kcl/pkg/api"
+	"kcl-lang.io/krm-kcl/pkg/source"
+)
+
+const (
+	// SandboxEnvVar is the environment variable which enables the sandbox mode for all the KCL programs.
+	SandboxEnvVar = "KCL_SANDBOX"
+	// DefaultMaxOutputSize is the default max size of the KCL program output in bytes in the sandbox mode.
+	DefaultMaxOutputSize = 10 << 20
+)
+
+// SandboxOptions limit what the KCL program can touch. In the sandbox mode, the KCL plugins and the file
+// system writes are blocked, the file reads are restricted to the source directory and the output size is capped.
+// The KCL runtime can not disable the file and plugin modules, so the blocked calls and the file reads are
+// checked by a best-effort lint of the KCL code before the run, and only the output size is capped at run time.
+// The sandbox mode is not an isolation of the untrusted code, e.g., from a container.
+type SandboxOptions struct {
+	// Enabled enables the sandbox mode, which is also enabled by the KCL_SANDBOX environment variable.
+	Enabled bool
+	// MaxOutputSize is the max size of the program output in bytes, and defaults to DefaultMaxOutputSize.
+	MaxOutputSize int64
+}
+
+// SandboxError is returned when the KCL program violates the sandbox policy.
+type SandboxError struct {
+	// Violations are all the violations of the sandbox policy.
+	Violations []string
+}
+
+func (e *SandboxError) Error() string {
+	return fmt.Sprintf("sandbox violation: [%s]", strings.Join(e.Violations, ", "))
+}
+
+// sandboxOptions returns the sandbox options of the run, or nil if the sandbox mode is not enabled by the
+// options or the KCL_SANDBOX environment variable.
+func sandboxOptions(o *RunOptions) *SandboxOptions {
+	sandbox := SandboxOptions{MaxOutputSize: DefaultMaxOutputSize}
+	if o.Sandbox != nil {
+		sandbox.Enabled = o.Sandbox.Enabled
+		if o.Sandbox.MaxOutputSize > 0 {
+			sandbox.MaxOutputSize = o.Sandbox.MaxOutputSize
+		}
+	}
+	switch strings.ToLower(os.Getenv(SandboxEnvVar)) {
+	case "ok", "yes", "true", "1", "on":
+		sandbox.Enabled = true
+	}
+	if !sandbox.Enabled {
+		return nil
+	}
+	return &sandbox
+}
+
+// pullOCISource pulls the OCI source into the local package cache as a dependency and returns
+// the local package path, so that the source can be checked before the run. The registry is
+// authenticated with the credentials of the fetch options if any.
+func pullOCISource(src string, fetch *source.FetchOptions) (string, error) {
+	ref, tag := ociSourceRef(src)
+	name := path.Base(source.TrimOCIPrefix(ref))
+	dependency := fmt.Sprintf("%s = { oci = %q }", name, ref)
+	if tag != "" {
+		dependency = fmt.Sprintf("%s = { oci = %q, tag = %q }", name, ref, tag)
+	}
+	cli, err := client.NewKpmClient()
+	if err != nil {
+		return "", err
+	}
+	// The source is not a dependency of the KCLRun, and is not verified against the dependency lock.
+	deps, err := resolveDeps(context.Background(), cli, dependency, fetchCredentials(fetch))
+	if err != nil {
+		return "", source.RedactError(err)
+	}
+	dir, ok := deps[name]
+	if !ok {
+		return "", fmt.Errorf("failed to pull the OCI source %s", src)
+	}
+	return dir, nil
+}
+
+// fetchOCISource pulls the OCI source into a local directory, and returns the directory and the temp
+// directory to be removed. The sources pinned by the digests or verified against the signatures are
+// pulled from the registry directly, and the others are pulled by the KCL package manager.
+func fetchOCISource(ctx context.Context, src string, fetch *source.FetchOptions) (string, string, error) {
+	verify, err := fetch.VerifiesSignature()
+	if err != nil {
+		return src, "", err
+	}
+	if verify || source.IsOCIDigest(src) {
+		return source.FetchOCI(ctx, src, fetch)
+	}
+	var dir, tmpDir string
+	err = runPhase(ctx, FetchPhase, nil, func() (err error) {
+		dir, tmpDir, err = pullOCISourceWithCache(src, fetch)
+		return err
+	})
+	var phaseErr *PhaseError
+	if errors.As(err, &phaseErr) {
+		// The abandoned pull may still write the directories.
+		return "", "", err
+	}
+	return dir, tmpDir, err
+}
+
+// pullOCISourceWithCache pulls the OCI source through the source cache of the fetch options if any,
+// and returns the local package path and the temp directory to be removed.
+func pullOCISourceWithCache(src string, fetch *source.FetchOptions) (string, string, error) {
+	if fetch == nil || fetch.Cache == nil {
+		dir, err := pullOCISource(src, fetch)
+		return dir, "", err
+	}
+	return fetch.Cache.Fetch(src, func() (string, string, error) {
+		dir, err := pullOCISource(src, fetch)
+		return dir, "", err
+	})
+}
+
+// fetchCredentials returns the credentials of the fetch options as the CredentialsFunc, or nil if
+// there are no credentials.
+func fetchCredentials(fetch *source.FetchOptions) CredentialsFunc {
+	if fetch == nil || fetch.Credentials == nil {
+		return nil
+	}
+	return func(host string) (*api.CredSpec, error) {
+		username, password, err := fetch.Credentials(host)
+		if err != nil || (username == "" && password == "") {
+			return nil, err
+		}
+		return &api.CredSpec{Url: host, Username: username, Password: password}, nil
+	}
+}
+
+// limitWriter writes at most max bytes to the writer and records whether the output exceeds the limit.
+type limitWriter struct {
+	w        io.Writer
+	max      int64
+	n        int64
+	exceeded bool
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if l.n+int64(len(p)) > l.max {
+		l.exceeded = true
+		return 0, fmt.Errorf("the output exceeds the max size %d bytes", l.max)
+	}
+	l.n += int64(len(p))
+	return l.w.Write(p)
+}
@@ -0,0 +1,78 @@
+package edit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/kyaml/errors"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+func TestSandboxOptions(t *testing.T) {
+	t.Setenv(SandboxEnvVar, "")
+	assert.Nil(t, sandboxOptions(&RunOptions{}))
+	assert.Nil(t, sandboxOptions(&RunOptions{Sandbox: &SandboxOptions{MaxOutputSize: 1}}))
+	assert.Equal(t, &SandboxOptions{Enabled: true, MaxOutputSize: DefaultMaxOutputSize}, sandboxOptions(&RunOptions{Sandbox: &SandboxOptions{Enabled: true}}))
+	t.Setenv(SandboxEnvVar, "true")
+	assert.Equal(t, &SandboxOptions{Enabled: true, MaxOutputSize: 1}, sandboxOptions(&RunOptions{Sandbox: &SandboxOptions{MaxOutputSize: 1}}))
+}
+
+func TestRunKCLInSandbox(t *testing.T) {
+	t.Setenv(SandboxEnvVar, "true")
+	resourceList := yaml.MustParse(`apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items: []
+`)
+	_, err := RunKCLWithConfig("test", "import file\n\na = file.read_env(\"HOME\")\n", nil, resourceList, nil)
+	var sandboxErr *SandboxError
+	assert.True(t, errors.As(err, &sandboxErr))
+	assert.EqualError(t, err, "sandbox violation: [prog.k: `file.read_env` is not allowed]")
+}
+
+func TestLimitWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := &limitWriter{w: &buf, max: 5}
+	_, err := w.Write([]byte("abc"))
+	assert.NoError(t, err)
+	_, err = w.Write([]byte("def"))
+	assert.EqualError(t, err, "the output exceeds the max size 5 bytes")
+	assert.True(t, w.exceeded)
+	assert.Equal(t, "abc", buf.String())
+}
+
+func TestRunKCLInSandboxWithModDependencies(t *testing.T) {
+	t.Setenv(SandboxEnvVar, "true")
+	resourceList := yaml.MustParse(`apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items: []
+`)
+	// The violation is moved into a local dependency of a local dependency in the kcl.mod files.
+	root := t.TempDir()
+	pkg := filepath.Join(root, "pkg")
+	helper := filepath.Join(root, "helper")
+	writer := filepath.Join(root, "writer")
+	for file, content := range map[string]string{
+		filepath.Join(pkg, "kcl.mod"):         "[package]\nname = \"pkg\"\n\n[dependencies]\nhelper = { path = \"../helper\" }\n",
+		filepath.Join(pkg, "main.k"):          "import helper\n\na = helper.a\n",
+		filepath.Join(helper, "kcl.mod"):      "[package]\nname = \"helper\"\n\n[dependencies]\nwriter = { path = \"../writer\" }\n",
+		filepath.Join(helper, "helper.k"):     "import writer\n\na = writer.a\n",
+		filepath.Join(writer, "writer.k"):     "import file\n\na = file.write(\"/tmp/out\", \"\")\n",
+		filepath.Join(root, "bad", "kcl.mod"): "[package]\nname = \"bad\"\n\n[dependencies]\nk8s = { oci = \"oci://localhost:1/kcl-lang/none\", tag = \"0.0.1\" }\n",
+		filepath.Join(root, "bad", "main.k"):  "a = 1\n",
+	} {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+		assert.NoError(t, os.WriteFile(file, []byte(content), 0644))
+	}
+	_, err := RunKCLWithConfig("test", pkg, nil, resourceList, nil)
+	var sandboxErr *SandboxError
+	assert.True(t, errors.As(err, &sandboxErr))
+	assert.EqualError(t, err, "sandbox violation: [writer.k: `file.write` is not allowed]")
+
+	// The run is rejected when the dependencies can not be resolved to be checked.
+	_, err = RunKCLWithConfig("test", filepath.Join(root, "bad"), nil, resourceList, nil)
+	assert.True(t, errors.As(err, &sandboxErr))
+	assert.ErrorContains(t, err, "sandbox violation: [the dependencies of the source package can not be checked: ")
+}
@@ -0,0 +1,35 @@
+package edit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"kcl-lang.io/krm-kcl/pkg/source"
+	"sigs.k8s.io/kustomize/kyaml/errors"
+)
+
+func TestSourceToTempEntryWithRequiredSignature(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	t.Setenv(source.PublicKeyEnvVar, "")
+	fetch := &source.FetchOptions{RequireSignature: true}
+
+	// The inline and the local sources can not be signed.
+	for _, src := range []string{"a = 1", "./main.k"} {
+		entry, err := SourceToTempEntryWithContext(context.Background(), src, fetch)
+		defer KCLEntryOriginTmpDirCleanup(entry)
+		var sigErr *source.SignatureError
+		assert.True(t, errors.As(err, &sigErr))
+		assert.EqualError(t, err, "signature verification failed for "+src+": the source type does not support signatures")
+	}
+
+	// The public key is required.
+	entry, err := SourceToTempEntryWithContext(context.Background(), server.URL+"/main.k", fetch)
+	defer KCLEntryOriginTmpDirCleanup(entry)
+	assert.EqualError(t, err, "the signature is required but no public key is configured, set the KCL_PUBLIC_KEY environment variable")
+}
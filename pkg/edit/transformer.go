@@ -1,10 +1,14 @@
 package edit
 
 import (
+	"context"
 	"fmt"
+	"strings"
 
 	"github.com/hashicorp/go-getter"
 	"kcl-lang.io/krm-kcl/pkg/api"
+	"kcl-lang.io/krm-kcl/pkg/kube"
+	"kcl-lang.io/krm-kcl/pkg/source"
 	"sigs.k8s.io/kustomize/kyaml/errors"
 	"sigs.k8s.io/kustomize/kyaml/yaml"
 )
@@ -34,30 +38,86 @@ type SimpleTransformer struct {
 	Config *api.ConfigSpec
 	// Getter options
 	GetterOptions []getter.ClientOption
+	// Env declares the environment variables exposed to the KCL program, and nothing is exposed if it is nil.
+	Env *EnvPolicy
+	// Sandbox limits what the KCL program can touch.
+	Sandbox *SandboxOptions
+	// Fetch are the retry and progress options to fetch the remote source.
+	Fetch *source.FetchOptions
 }
 
 // Format transformer using the name and source.
 func (st *SimpleTransformer) String() string {
 	return fmt.Sprintf(
-		"name: %v source: %v", st.Name, st.Source)
+		"name: %v source: %v", st.Name, source.Redact(st.Source))
 }
 
 // Transform YAML nodes and return error if any error occurs.
+// The results with the error severity are returned as the error.
 func (st *SimpleTransformer) Transform(nodes []*yaml.RNode) ([]*yaml.RNode, error) {
+	out, results, err := st.TransformWithResults(nodes)
+	if err != nil {
+		return nil, err
+	}
+	if results.HasErrors() {
+		return nil, results
+	}
+	return out, nil
+}
+
+// TransformWithResults transforms YAML nodes and returns the results produced by the KCL program.
+// When an assertion of the KCL program fails, the input nodes are returned unchanged with the error
+// results, which point to the offending node when the error names one. The other failures, e.g., the
+// source fetch errors, the compile errors and the sandbox violations, are returned as the error.
+func (st *SimpleTransformer) TransformWithResults(nodes []*yaml.RNode) ([]*yaml.RNode, kube.Results, error) {
+	return st.TransformWithContext(context.Background(), nodes)
+}
+
+// TransformWithContext transforms YAML nodes in the same way as TransformWithResults, and returns
+// a PhaseError when the context is done before the KCL program finishes, e.g., the deadline is exceeded.
+func (st *SimpleTransformer) TransformWithContext(ctx context.Context, nodes []*yaml.RNode) ([]*yaml.RNode, kube.Results, error) {
+	out, err := st.run(ctx, nodes)
+	if err != nil {
+		var assertionErr *AssertionError
+		if !errors.As(err, &assertionErr) {
+			return nil, nil, err
+		}
+		return nodes, errorResults(err), nil
+	}
+	// 3. Unwrap KRM function spec to KCLRun resource.
+	updatedNodes, _, results, err := UnwrapResourcesWithResults(out)
+	if err != nil {
+		return nil, nil, err
+	}
+	return updatedNodes, results, nil
+}
+
+// run wraps the nodes to a resource list and runs the KCL program.
+func (st *SimpleTransformer) run(ctx context.Context, nodes []*yaml.RNode) ([]*yaml.RNode, error) {
 	// 1. Wrap KCLRun resource to KRM the function spec.
 	in, err := WrapResources(nodes, st.FunctionConfig)
 	if err != nil {
 		return nil, errors.Wrap(err)
 	}
-
 	// 2. Run code
-	out, err := RunKCLWithConfig(st.Name, st.Source, st.Dependencies, in, st.Config, st.GetterOptions...)
-
+	out, err := RunKCLWithContext(ctx, st.Name, st.Source, in, &RunOptions{
+		Dependencies:  st.Dependencies,
+		Config:        st.Config,
+		Env:           st.Env,
+		Sandbox:       st.Sandbox,
+		GetterOptions: st.GetterOptions,
+		Fetch:         st.Fetch,
+	})
 	if err != nil {
 		return nil, errors.Wrap(err)
 	}
+	return out, nil
+}
 
-	// 3. Unwrap KRM function spec to KCLRun resource.
-	updatedNodes, _, err := UnwrapResources(out)
-	return updatedNodes, err
+// errorResults converts the assertion failure of the KCL program to the error result without running
+// the program again. The KCL error tells neither which item failed the assertion nor the item index, so
+// the result is not attributed to any resource. The program returns the `results` variable with the
+// `resourceRef` of each offending resource to point to them.
+func errorResults(err error) kube.Results {
+	return kube.Results{{Message: strings.TrimSpace(err.Error()), Severity: kube.Error}}
 }
@@ -0,0 +1,26 @@
+package edit
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"kcl-lang.io/krm-kcl/pkg/kube"
+)
+
+func TestErrorResults(t *testing.T) {
+	// The messages name the resources, the temp paths and the error codes, and none of them is guessed
+	// to be the offending resource.
+	for _, message := range []string{
+		"The number of replicas 6 is not allowed for nginx.",
+		"nginx and redis must have the same replicas",
+		"EvaluationError\n --> /tmp/app/main.k:2:1\n  |\n2 | assert item.metadata.name != \"error\"\n  |",
+		"The replicas are not allowed",
+	} {
+		results := errorResults(errors.New(message + "\n"))
+		assert.Len(t, results, 1)
+		assert.Equal(t, message, results[0].Message)
+		assert.Equal(t, kube.Error, results[0].Severity)
+		assert.Nil(t, results[0].ResourceRef)
+	}
+}
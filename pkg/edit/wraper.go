@@ -3,6 +3,8 @@ package edit
 import (
 	"kcl-lang.io/krm-kcl/pkg/api"
 	"kcl-lang.io/krm-kcl/pkg/api/v1alpha1"
+	"kcl-lang.io/krm-kcl/pkg/api/v1beta1"
+	"kcl-lang.io/krm-kcl/pkg/kube"
 	"sigs.k8s.io/kustomize/kyaml/errors"
 	"sigs.k8s.io/kustomize/kyaml/kio"
 	"sigs.k8s.io/kustomize/kyaml/yaml"
@@ -13,7 +15,8 @@ func WrapResources(nodes []*yaml.RNode, fc *yaml.RNode) (*yaml.RNode, error) {
 	var ynodes []*yaml.Node
 	for _, rnode := range nodes {
 		// Filter KCLRun resources
-		if rnode.GetApiVersion() == v1alpha1.KCLRunAPIVersion && rnode.GetKind() == api.KCLRunKind {
+		if (rnode.GetApiVersion() == v1alpha1.KCLRunAPIVersion || rnode.GetApiVersion() == v1beta1.KCLRunAPIVersion) &&
+			rnode.GetKind() == api.KCLRunKind {
 			continue
 		}
 		ynodes = append(ynodes, rnode.YNode())
@@ -46,36 +49,54 @@ func WrapResources(nodes []*yaml.RNode, fc *yaml.RNode) (*yaml.RNode, error) {
 
 // UnwrapResources unwraps the resources and the functionConfig from a resourceList
 func UnwrapResources(nodes []*yaml.RNode) ([]*yaml.RNode, *yaml.RNode, error) {
+	outs, fc, _, err := UnwrapResourcesWithResults(nodes)
+	return outs, fc, err
+}
+
+// UnwrapResourcesWithResults unwraps the resources, the functionConfig and the results from a resourceList
+func UnwrapResourcesWithResults(nodes []*yaml.RNode) ([]*yaml.RNode, *yaml.RNode, kube.Results, error) {
 	var in *yaml.RNode
 	if len(nodes) == 0 {
-		return []*yaml.RNode{}, nil, nil
+		return []*yaml.RNode{}, nil, nil, nil
 	} else if len(nodes) == 1 {
 		in = nodes[0]
 	} else {
 		out, err := WrapResources(nodes, nil)
 		if err != nil {
-			return nil, nil, errors.Wrap(err)
+			return nil, nil, nil, errors.Wrap(err)
 		}
 		in = out
 	}
 	// Find items
 	items, err := in.Pipe(yaml.Lookup("items"))
 	if err != nil {
-		return nil, nil, errors.Wrap(err)
+		return nil, nil, nil, errors.Wrap(err)
+	}
+	// Find results
+	resultsNode, err := in.Pipe(yaml.Lookup("results"))
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err)
+	}
+	results, err := kube.ParseResults(resultsNode)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err)
 	}
 	var outs []*yaml.RNode
 	// If the items field does not exist, regard the input resource as the output resource.
+	// A document which only contains the results field has no output resources.
 	if items.IsNil() && !in.IsNil() {
-		outs = []*yaml.RNode{in}
+		if resultsNode.IsNil() {
+			outs = []*yaml.RNode{in}
+		}
 	} else {
 		outs, err = items.Elements()
 		if err != nil {
-			return nil, nil, errors.Wrap(err)
+			return nil, nil, nil, errors.Wrap(err)
 		}
 	}
 	fc, err := in.Pipe(yaml.Lookup("functionConfig"))
 	if err != nil {
-		return nil, nil, errors.Wrap(err)
+		return nil, nil, nil, errors.Wrap(err)
 	}
-	return outs, fc, nil
+	return outs, fc, results, nil
 }
@@ -1,9 +1,10 @@
 package kio
 
 import (
-	"kcl-lang.io/krm-kcl/pkg/api"
-	"kcl-lang.io/krm-kcl/pkg/api/v1alpha1"
+	"context"
+
 	"kcl-lang.io/krm-kcl/pkg/config"
+	"kcl-lang.io/krm-kcl/pkg/kube"
 
 	"sigs.k8s.io/kustomize/kyaml/kio"
 	"sigs.k8s.io/kustomize/kyaml/yaml"
@@ -11,68 +12,79 @@ import (
 
 // Filter implements kio.Filter
 type Filter struct {
-	rw *kio.ByteReadWriter
+	// ctx stops the KCL functions when it is done.
+	ctx context.Context
+	rw  *kio.ByteReadWriter
+	// results collects the results produced by the KCL functions.
+	results *kube.Results
+	// options are the run options of the KCL functions.
+	options config.Options
 }
 
 // Filter checks each input and ensures that all containers have cpu and memory
 // reservations set, otherwise it returns an error.
 func (f Filter) Filter(in []*yaml.RNode) ([]*yaml.RNode, error) {
-	// Whether has fnCfg in the `functionConfig` field input resource list
-	hasFnCfg := f.rw.FunctionConfig != nil
-	configs, idxs, err := f.parseConfigs(in)
+	configs, fnCfgs, err := f.parseConfigs(in)
 	if err != nil {
 		return nil, err
 	}
+	ctx := f.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
 	for idx, c := range configs {
-		var fnCfg *yaml.RNode
-		if hasFnCfg {
-			fnCfg = f.rw.FunctionConfig
-		} else {
-			fnCfg = in[idxs[idx]]
-		}
-		in, err = c.Transform(in, fnCfg)
+		var results kube.Results
+		in, results, err = c.TransformWithContext(ctx, in, fnCfgs[idx])
 		if err != nil {
 			return nil, err
 		}
+		if f.results != nil {
+			*f.results = append(*f.results, results...)
+		} else if results.HasErrors() {
+			return nil, results
+		}
 	}
 	return in, nil
 }
 
-// parseConfigs parses the input manifests into an API struct.
-func (f *Filter) parseConfigs(in []*yaml.RNode) ([]*config.KCLRun, []int, error) {
-	var configs []*config.KCLRun
-	var idxs []int
-	// If KCLRun is not found in the function config, find it in the input manifests
-	if f.rw.FunctionConfig == nil {
-		for idx, i := range in {
-			if i.GetApiVersion() == v1alpha1.KCLRunAPIVersion && i.GetKind() == api.KCLRunKind {
-				// Parse the input function config.
-				config, err := f.parseConfig(i)
-				f.rw.FunctionConfig = i
-				if err != nil {
-					return nil, nil, err
-				}
-				idxs = append(idxs, idx)
-				configs = append(configs, config)
-			}
-		}
-	} else {
-		// Parse the input function config.
-		config, err := f.parseConfig(f.rw.FunctionConfig)
+// parseConfigs parses the input manifests into API structs and returns them
+// with their function config nodes.
+func (f *Filter) parseConfigs(in []*yaml.RNode) ([]*config.KCLRun, []*yaml.RNode, error) {
+	// Use the KCLRun in the `functionConfig` field of the input resource list.
+	if f.rw.FunctionConfig != nil {
+		c, err := f.parseConfig(f.rw.FunctionConfig)
 		if err != nil {
 			return nil, nil, err
 		}
-		configs = append(configs, config)
+		return []*config.KCLRun{c}, []*yaml.RNode{f.rw.FunctionConfig}, nil
 	}
-	return configs, idxs, nil
+	// If KCLRun is not found in the function config, find it in the input manifests.
+	var configs []*config.KCLRun
+	var fnCfgs []*yaml.RNode
+	for _, i := range in {
+		if config.IsKCLRun(i.GetApiVersion(), i.GetKind()) {
+			config, err := f.parseConfig(i)
+			if err != nil {
+				return nil, nil, err
+			}
+			configs = append(configs, config)
+			fnCfgs = append(fnCfgs, i)
+		}
+	}
+	return configs, fnCfgs, nil
 }
 
 // parseConfig parses the functionConfig into an API struct.
+// The functionConfig can be a KCLRun or a ConfigMap resource.
 func (f *Filter) parseConfig(in *yaml.RNode) (*config.KCLRun, error) {
+	o, err := kube.ParseKubeObject([]byte(in.MustString()))
+	if err != nil {
+		return nil, err
+	}
 	// Parse the input function config.
-	var config config.KCLRun
-	if err := yaml.Unmarshal([]byte(in.MustString()), &config); err != nil {
+	c := config.New()
+	if err := c.Config(o); err != nil {
 		return nil, err
 	}
-	return &config, nil
+	return c.WithOptions(f.options), nil
 }
@@ -1,9 +1,13 @@
 package kio
 
 import (
+	"context"
 	"io"
 
+	"kcl-lang.io/krm-kcl/pkg/config"
+	"kcl-lang.io/krm-kcl/pkg/kube"
 	"sigs.k8s.io/kustomize/kyaml/kio"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
 )
 
 // NewPipeline creates a new kio.Pipeline with the given reader, writer, and keepReaderAnnotations flag.
@@ -20,10 +24,53 @@ import (
 // Pipeline reads Resource Configuration from a set of Inputs, applies some
 // transformation filters, and writes the results to a set of Outputs.
 func NewPipeline(reader io.Reader, writer io.Writer, keepReaderAnnotations bool) kio.Pipeline {
+	return NewPipelineWithOptions(reader, writer, keepReaderAnnotations, config.Options{})
+}
+
+// NewPipelineWithOptions creates a new kio.Pipeline in the same way as NewPipeline, and the KCL functions
+// are run with the given run options, e.g., the active profile.
+func NewPipelineWithOptions(reader io.Reader, writer io.Writer, keepReaderAnnotations bool, options config.Options) kio.Pipeline {
+	return NewPipelineWithContext(context.Background(), reader, writer, keepReaderAnnotations, options)
+}
+
+// NewPipelineWithContext creates a new kio.Pipeline in the same way as NewPipelineWithOptions, and the KCL
+// functions are stopped when the context is done, e.g., the process is interrupted.
+func NewPipelineWithContext(ctx context.Context, reader io.Reader, writer io.Writer, keepReaderAnnotations bool, options config.Options) kio.Pipeline {
 	rw := &kio.ByteReadWriter{Reader: reader, Writer: writer, KeepReaderAnnotations: keepReaderAnnotations}
+	results := &kube.Results{}
 	return kio.Pipeline{
-		Inputs:  []kio.Reader{rw},             // read the inputs into a slice
-		Filters: []kio.Filter{Filter{rw: rw}}, // run the filter against the inputs
-		Outputs: []kio.Writer{rw},             // copy the inputs to the output
+		Inputs:  []kio.Reader{rw},                                                           // read the inputs into a slice
+		Filters: []kio.Filter{Filter{ctx: ctx, rw: rw, results: results, options: options}}, // run the filter against the inputs
+		Outputs: []kio.Writer{Writer{rw: rw, results: results}},                             // copy the inputs and the results to the output
+	}
+}
+
+// Writer implements kio.Writer, which writes the resources with the results produced by the
+// KCL functions into the ResourceList, and returns the results as an error when any of them
+// has the error severity.
+type Writer struct {
+	rw      *kio.ByteReadWriter
+	results *kube.Results
+}
+
+// Write writes the resources and the results.
+func (w Writer) Write(nodes []*yaml.RNode) error {
+	if len(*w.results) > 0 {
+		results, err := w.results.ToRNode()
+		if err != nil {
+			return err
+		}
+		// Keep the results of the previous functions in the input ResourceList.
+		if w.rw.Results != nil && w.rw.Results.YNode().Kind == yaml.SequenceNode {
+			results.YNode().Content = append(w.rw.Results.YNode().Content, results.YNode().Content...)
+		}
+		w.rw.Results = results
+	}
+	if err := w.rw.Write(nodes); err != nil {
+		return err
+	}
+	if w.results.HasErrors() {
+		return *w.results
 	}
+	return nil
 }
@@ -46,6 +46,11 @@ func (o *KubeObject) GetKind() string {
 	return o.node.GetKind()
 }
 
+// GetLabels retrieves the labels of the Kubernetes object.
+func (o *KubeObject) GetLabels() map[string]string {
+	return o.node.GetLabels()
+}
+
 // As unmarshals the Kubernetes object into a Go struct pointed by ptr.
 func (o *KubeObject) As(ptr interface{}) error {
 	if ptr == nil || reflect.ValueOf(ptr).Kind() != reflect.Ptr {
@@ -12,6 +12,7 @@ type ResourceList struct {
 	yaml.ResourceMeta `json:",inline" yaml:",inline"`
 	Items             KubeObjects `yaml:"items" json:"items"`                                       // Items is a slice of Kubernetes objects.
 	FunctionConfig    *KubeObject `yaml:"functionConfig,omitempty" json:"functionConfig,omitempty"` // FunctionConfig is an optional KubeObject that describes the function configuration.
+	Results           Results     `yaml:"results,omitempty" json:"results,omitempty"`               // Results is an optional list of results produced by the functions.
 }
 
 // ParseResourceList takes a byte slice of a YAML ResourceList and parses it into a ResourceList structure.
@@ -33,5 +34,11 @@ func ParseResourceList(in []byte) (*ResourceList, error) {
 	if items, err := o.GetNestedSlice("items"); err == nil {
 		rl.Items = items
 	}
+	// Parse Results if present.
+	if results, err := o.GetNestedMap("results"); err == nil {
+		if rl.Results, err = ParseResults(results.Node()); err != nil {
+			return nil, err
+		}
+	}
 	return rl, nil
 }
@@ -19,6 +19,13 @@ functionConfig:
   kind: ConfigMap
   metadata:
     name: test-config
+results:
+  - message: replicas must be less than 5
+    severity: error
+    resourceRef:
+      apiVersion: v1
+      kind: Pod
+      name: test-pod
 `
 	// Call ParseResourceList to parse the YAML string into a ResourceList.
 	resourceList, err := ParseResourceList([]byte(testYAML))
@@ -34,4 +41,7 @@ functionConfig:
 	if resourceList.FunctionConfig == nil {
 		t.Error("Expected a function config but got nil")
 	}
+	if len(resourceList.Results) != 1 || !resourceList.Results.HasErrors() {
+		t.Errorf("Expected one error result, but got '%v'", resourceList.Results)
+	}
 }
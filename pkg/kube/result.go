@@ -0,0 +1,167 @@
+package kube
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/kustomize/kyaml/kio/kioutil"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// Severity indicates the severity of the Result
+type Severity string
+
+const (
+	// Error indicates the result is an error.  Will cause the function to exit non-0.
+	Error Severity = "error"
+	// Warning indicates the result is a warning
+	Warning Severity = "warning"
+	// Info indicates the result is an informative message
+	Info Severity = "info"
+)
+
+// Result defines a validation result defined in the KRM function specification.
+type Result struct {
+	// Message is a human readable message. This field is required.
+	Message string `yaml:"message,omitempty" json:"message,omitempty"`
+	// Severity is the severity of this result
+	Severity Severity `yaml:"severity,omitempty" json:"severity,omitempty"`
+	// ResourceRef is a reference to a resource.
+	// Required fields: apiVersion, kind, name.
+	ResourceRef *yaml.ResourceIdentifier `yaml:"resourceRef,omitempty" json:"resourceRef,omitempty"`
+	// Field is a reference to the field in a resource this result refers to
+	Field *Field `yaml:"field,omitempty" json:"field,omitempty"`
+	// File references a file containing the resource this result refers to
+	File *File `yaml:"file,omitempty" json:"file,omitempty"`
+	// Tags is an unstructured key value map stored with a result that may be set
+	// by external tools to store and retrieve arbitrary metadata
+	Tags map[string]string `yaml:"tags,omitempty" json:"tags,omitempty"`
+}
+
+// Field references a field in a resource
+type Field struct {
+	// Path is the field path. This field is required.
+	Path string `yaml:"path,omitempty" json:"path,omitempty"`
+	// CurrentValue is the current field value
+	CurrentValue interface{} `yaml:"currentValue,omitempty" json:"currentValue,omitempty"`
+	// ProposedValue is the proposed value of the field to fix an issue.
+	ProposedValue interface{} `yaml:"proposedValue,omitempty" json:"proposedValue,omitempty"`
+}
+
+// File references a file containing a resource
+type File struct {
+	// Path is relative path to the file containing the resource.
+	// This field is required.
+	Path string `yaml:"path,omitempty" json:"path,omitempty"`
+	// Index is the index into the file containing the resource
+	// (i.e. if there are multiple resources in a single file)
+	Index int `yaml:"index,omitempty" json:"index,omitempty"`
+}
+
+// String returns the result in the format [<severity>] <kind>/<namespace>/<name>: <message>.
+func (r Result) String() string {
+	var builder strings.Builder
+	severity := r.Severity
+	if severity == "" {
+		severity = Info
+	}
+	builder.WriteString("[" + string(severity) + "] ")
+	if r.ResourceRef != nil {
+		builder.WriteString(r.ResourceRef.Kind + "/")
+		if r.ResourceRef.Namespace != "" {
+			builder.WriteString(r.ResourceRef.Namespace + "/")
+		}
+		builder.WriteString(r.ResourceRef.Name)
+		if r.Field != nil && r.Field.Path != "" {
+			builder.WriteString(" " + r.Field.Path)
+		}
+		builder.WriteString(": ")
+	}
+	builder.WriteString(r.Message)
+	return builder.String()
+}
+
+// Results is a list of results, and it implements the error interface.
+type Results []*Result
+
+// Error returns the results in the string format.
+func (r Results) Error() string {
+	var elems []string
+	for _, result := range r {
+		elems = append(elems, result.String())
+	}
+	return strings.Join(elems, "\n")
+}
+
+// HasErrors checks if any of the results has the error severity.
+func (r Results) HasErrors() bool {
+	for _, result := range r {
+		if result.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+// ToRNode converts the results to a YAML sequence node.
+func (r Results) ToRNode() (*yaml.RNode, error) {
+	if r == nil {
+		r = Results{}
+	}
+	data, err := yaml.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Parse(string(data))
+}
+
+// ParseResults parses the results from a YAML sequence node.
+func ParseResults(node *yaml.RNode) (Results, error) {
+	if node.IsNilOrEmpty() {
+		return nil, nil
+	}
+	data, err := node.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	var results Results
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, fmt.Errorf("failed to parse results: %w", err)
+	}
+	return results, nil
+}
+
+// ErrorResult returns a result with the error severity for the error.
+func ErrorResult(err error) *Result {
+	return &Result{
+		Message:  err.Error(),
+		Severity: Error,
+	}
+}
+
+// ObjectResult returns a result which refers to the resource node.
+func ObjectResult(message string, node *yaml.RNode, severity Severity) *Result {
+	result := &Result{
+		Message:  message,
+		Severity: severity,
+		ResourceRef: &yaml.ResourceIdentifier{
+			TypeMeta: yaml.TypeMeta{
+				APIVersion: node.GetApiVersion(),
+				Kind:       node.GetKind(),
+			},
+			NameMeta: yaml.NameMeta{
+				Name:      node.GetName(),
+				Namespace: node.GetNamespace(),
+			},
+		},
+	}
+	if path, index, err := kioutil.GetFileAnnotations(node); err == nil && path != "" {
+		result.File = &File{Path: path}
+		if i, err := strconv.Atoi(index); err == nil {
+			result.File.Index = i
+		}
+	}
+	return result
+}
@@ -0,0 +1,55 @@
+package kube
+
+import (
+	"errors"
+	"testing"
+
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// TestResults tests the Results methods.
+func TestResults(t *testing.T) {
+	node := yaml.MustParse(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+  namespace: prod
+  annotations:
+    config.kubernetes.io/path: deployment.yaml
+    config.kubernetes.io/index: '1'
+`)
+	results := Results{
+		ObjectResult("replicas must be less than 5", node, Error),
+		{Message: "checked", Severity: Info},
+	}
+	if !results.HasErrors() {
+		t.Errorf("Expected results to have errors")
+	}
+	expectedErr := "[error] Deployment/prod/nginx: replicas must be less than 5\n[info] checked"
+	if results.Error() != expectedErr {
+		t.Errorf("Expected error to be '%s', but got '%s'", expectedErr, results.Error())
+	}
+	if results[0].File == nil || results[0].File.Path != "deployment.yaml" || results[0].File.Index != 1 {
+		t.Errorf("Expected the result file to be deployment.yaml:1, but got '%v'", results[0].File)
+	}
+	if ErrorResult(errors.New("failed")).Severity != Error {
+		t.Errorf("Expected the error result to have the error severity")
+	}
+
+	// Round trip the results through the YAML node.
+	rn, err := results.ToRNode()
+	if err != nil {
+		t.Fatalf("ToRNode failed with an error: %v", err)
+	}
+	parsed, err := ParseResults(rn)
+	if err != nil {
+		t.Fatalf("ParseResults failed with an error: %v", err)
+	}
+	if parsed.Error() != expectedErr {
+		t.Errorf("Expected parsed results to be '%s', but got '%s'", expectedErr, parsed.Error())
+	}
+	if parsed[0].ResourceRef.APIVersion != "apps/v1" {
+		t.Errorf("Expected the resource ref apiVersion to be 'apps/v1', but got '%s'", parsed[0].ResourceRef.APIVersion)
+	}
+}
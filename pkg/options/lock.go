@@ -0,0 +1,105 @@
+package options
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"kcl-lang.io/krm-kcl/pkg/api"
+	"kcl-lang.io/krm-kcl/pkg/config"
+	"kcl-lang.io/krm-kcl/pkg/edit"
+	"kcl-lang.io/krm-kcl/pkg/kube"
+	"kcl-lang.io/krm-kcl/pkg/source"
+	"sigs.k8s.io/kustomize/kyaml/kio"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// LockOptions is the options for the lock command.
+type LockOptions struct {
+	// Path is the package directory or the file which contains the KCLRuns.
+	Path string
+	// LockFile is the -o flag, which defaults to the krm-kcl.lock file in the package directory.
+	LockFile string
+}
+
+// NewLockOptions creates a new options for the lock command.
+func NewLockOptions() *LockOptions {
+	return &LockOptions{Path: "."}
+}
+
+// Run resolves all the KCLRun sources and dependencies in the package and writes the lock file.
+func (o *LockOptions) Run(ctx context.Context) error {
+	nodes, dir, err := o.read()
+	if err != nil {
+		return err
+	}
+	lock := source.NewLock()
+	for _, n := range nodes {
+		if !isFunctionConfig(n) {
+			continue
+		}
+		obj, err := kube.ParseKubeObject([]byte(n.MustString()))
+		if err != nil {
+			return err
+		}
+		c := config.New()
+		if err := c.Config(obj); err != nil {
+			return err
+		}
+		// The sources are resolved with the same credentials as the run, e.g., the Secrets in the package.
+		creds, err := c.Credentials(nodes)
+		if err != nil {
+			return err
+		}
+		sources, dependencies := c.Sources()
+		locked, err := edit.ResolveLockWithCredentials(ctx, sources, dependencies, creds)
+		if err != nil {
+			return err
+		}
+		for _, s := range locked.Sources {
+			lock.AddSource(s)
+		}
+		for _, d := range locked.Dependencies {
+			if err := lock.AddDependency(d); err != nil {
+				return err
+			}
+		}
+	}
+	lockFile := o.LockFile
+	if lockFile == "" {
+		lockFile = filepath.Join(dir, source.LockFileName)
+	}
+	return lock.Write(lockFile)
+}
+
+// isFunctionConfig checks if the node is a KCLRun, or a ConfigMap function config whose `source` data is a
+// remote source, which is verified against the lock at run time in the same way as the KCLRun. The other
+// ConfigMaps are not function configs or have nothing to lock.
+func isFunctionConfig(n *yaml.RNode) bool {
+	if config.IsKCLRun(n.GetApiVersion(), n.GetKind()) {
+		return true
+	}
+	if n.GetApiVersion() != config.ConfigMapAPIVersion || n.GetKind() != config.ConfigMapKind {
+		return false
+	}
+	return source.IsRemote(n.GetDataMap()[api.SourceKey])
+}
+
+// read reads the resources of the package directory or the file, and returns the package directory.
+func (o *LockOptions) read() ([]*yaml.RNode, string, error) {
+	info, err := os.Stat(o.Path)
+	if err != nil {
+		return nil, "", err
+	}
+	if info.IsDir() {
+		nodes, err := kio.LocalPackageReader{PackagePath: o.Path, OmitReaderAnnotations: true}.Read()
+		return nodes, o.Path, err
+	}
+	file, err := os.Open(o.Path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+	nodes, err := (&kio.ByteReader{Reader: file, OmitReaderAnnotations: true}).Read()
+	return nodes, filepath.Dir(o.Path), err
+}
@@ -0,0 +1,84 @@
+package options
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"kcl-lang.io/krm-kcl/pkg/source"
+)
+
+func TestLockRun(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("a = 1"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "fn.yaml"), []byte(`apiVersion: krm.kcl.dev/v1alpha1
+kind: KCLRun
+metadata:
+  name: set-annotation
+spec:
+  source: `+server.URL+`/main.k
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: set-labels
+data:
+  source: `+server.URL+`/labels.k
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app-config
+data:
+  source: a = 1
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+`), 0644))
+	o := NewLockOptions()
+	o.Path = dir
+	assert.NoError(t, o.Run(context.Background()))
+
+	lock, err := source.LoadLock(filepath.Join(dir, source.LockFileName))
+	assert.NoError(t, err)
+	// The ConfigMap function config with a remote source is locked too.
+	assert.Len(t, lock.Sources, 2)
+	for _, src := range []string{server.URL + "/main.k", server.URL + "/labels.k"} {
+		if locked := lock.Source(src); assert.NotNil(t, locked, src) {
+			assert.Regexp(t, `^sha256:[0-9a-f]{64}$`, locked.Digest)
+		}
+	}
+}
+
+func TestRunOptionsLock(t *testing.T) {
+	t.Setenv(source.LockFileEnvVar, "")
+	dir := t.TempDir()
+	input := filepath.Join(dir, "fn.yaml")
+
+	// There is no lock file.
+	lock, err := (&RunOptions{InputPath: input}).lock()
+	assert.NoError(t, err)
+	assert.Nil(t, lock)
+
+	// The krm-kcl.lock file written by the lock command is used by default.
+	written := source.NewLock()
+	written.AddSource(source.LockedSource{Source: "oci://ghcr.io/kcl-lang/set-annotation", Digest: "sha256:0"})
+	assert.NoError(t, written.Write(filepath.Join(dir, source.LockFileName)))
+	lock, err = (&RunOptions{InputPath: input}).lock()
+	assert.NoError(t, err)
+	assert.Equal(t, written, lock)
+
+	// The --lock flag takes precedence.
+	_, err = (&RunOptions{InputPath: input, LockFile: filepath.Join(dir, "other.lock")}).lock()
+	assert.Error(t, err)
+}
@@ -2,10 +2,16 @@ package options
 
 import (
 	"bufio"
+	"context"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"time"
 
+	"kcl-lang.io/krm-kcl/pkg/config"
 	"kcl-lang.io/krm-kcl/pkg/kio"
+	"kcl-lang.io/krm-kcl/pkg/source"
 )
 
 // RunOptions is the options for the run command
@@ -18,6 +24,27 @@ type RunOptions struct {
 	PathEnvVar string
 	// Environment map from KCL option("env")
 	EnvMap map[string]string
+	// Profile is the --profile flag, which selects the active profile of the KCLRun.
+	Profile string
+	// Sandbox is the --sandbox flag, which enables the sandbox mode for all the KCLRuns.
+	Sandbox bool
+	// Timeout is the --timeout flag, which is the default timeout of the KCLRuns.
+	Timeout time.Duration
+	// Retries is the --retries flag, which is the max number of retries of a failed remote source fetch.
+	Retries int
+	// Cache is the --cache flag, which caches the fetched remote sources.
+	Cache bool
+	// CacheDir is the --cache-dir flag, which is the source cache directory.
+	CacheDir string
+	// CacheTTL is the --cache-ttl flag, which is the time to live of the cached mutable refs.
+	CacheTTL time.Duration
+	// Offline is the --offline flag, which only uses the cached sources.
+	Offline bool
+	// LockFile is the --lock flag, which is the lock file to verify the sources and the dependencies, and
+	// defaults to the krm-kcl.lock file written by the lock command in the directory of the input file.
+	LockFile string
+	// PublicKey is the --public-key flag, which is the public key file to verify the source signatures.
+	PublicKey string
 }
 
 // RunOptions creates a new options for the run command.
@@ -30,6 +57,28 @@ func NewRunOptions() *RunOptions {
 
 // Run the with the run command options.
 func (o *RunOptions) Run() error {
+	return o.RunContext(context.Background())
+}
+
+// RunContext runs the run command options, and the KCL functions are stopped when the context is done.
+func (o *RunOptions) RunContext(ctx context.Context) error {
+	lock, err := o.lock()
+	if err != nil {
+		return err
+	}
+	fetch := &source.FetchOptions{
+		Retries:  o.Retries,
+		Progress: reportRetries,
+		Cache:    o.cache(),
+		Lock:     lock,
+	}
+	if o.PublicKey != "" {
+		key, err := source.LoadPublicKey(o.PublicKey)
+		if err != nil {
+			return err
+		}
+		fetch.PublicKey = key
+	}
 	reader, err := o.reader()
 	if err != nil {
 		return err
@@ -38,8 +87,54 @@ func (o *RunOptions) Run() error {
 	if err != nil {
 		return err
 	}
-	pipeline := kio.NewPipeline(reader, writer, false)
-	return pipeline.Execute()
+	defer writer.Close()
+	pipeline := kio.NewPipelineWithContext(ctx, reader, writer, false, config.Options{
+		Profile: o.Profile,
+		Sandbox: o.Sandbox,
+		Timeout: o.Timeout,
+		Fetch:   fetch,
+	})
+	if err := pipeline.Execute(); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// cache returns the source cache of the run command options, or nil if the cache is not enabled
+// by the flags. The offline mode implies the cache.
+func (o *RunOptions) cache() *source.Cache {
+	if !o.Cache && !o.Offline && o.CacheDir == "" {
+		return nil
+	}
+	return &source.Cache{Dir: o.CacheDir, TTL: o.CacheTTL, Offline: o.Offline}
+}
+
+// lock returns the lock file of the --lock flag or the KCL_LOCK_FILE environment variable, or the
+// krm-kcl.lock file in the directory of the input file, or the working directory for the stdin input,
+// if it exists. Nil is returned if there is no lock file.
+func (o *RunOptions) lock() (*source.Lock, error) {
+	if o.LockFile != "" {
+		return source.LoadLock(o.LockFile)
+	}
+	if os.Getenv(source.LockFileEnvVar) != "" {
+		return source.DefaultLock()
+	}
+	dir := "."
+	if o.InputPath != "" && o.InputPath != "-" {
+		dir = filepath.Dir(o.InputPath)
+	}
+	lockFile := filepath.Join(dir, source.LockFileName)
+	if _, err := os.Stat(lockFile); os.IsNotExist(err) {
+		return nil, nil
+	}
+	return source.LoadLock(lockFile)
+}
+
+// reportRetries reports the retries of the remote source fetches to the stderr.
+func reportRetries(p source.FetchProgress) {
+	if p.Event == source.FetchRetrying {
+		fmt.Fprintf(os.Stderr, "fetching %s failed: %v, retrying in %s\n", p.Source, p.Err, p.Backoff)
+	}
 }
 
 func (o *RunOptions) reader() (io.Reader, error) {
@@ -54,14 +149,37 @@ func (o *RunOptions) reader() (io.Reader, error) {
 	}
 }
 
-func (o *RunOptions) writer() (io.Writer, error) {
+// writer returns the output file of the -o flag, which is flushed and closed by Close, or the stdout.
+func (o *RunOptions) writer() (*outputWriter, error) {
 	if o.OutputPath == "" {
-		return os.Stdout, nil
+		return &outputWriter{Writer: bufio.NewWriter(os.Stdout)}, nil
 	} else {
-		file, err := os.OpenFile(o.OutputPath, os.O_CREATE|os.O_RDWR, 0744)
+		file, err := os.OpenFile(o.OutputPath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0744)
 		if err != nil {
 			return nil, err
 		}
-		return bufio.NewWriter(file), nil
+		return &outputWriter{Writer: bufio.NewWriter(file), file: file}, nil
+	}
+}
+
+// outputWriter buffers the output, and the buffered output is lost unless it is closed.
+type outputWriter struct {
+	*bufio.Writer
+	file   *os.File
+	closed bool
+}
+
+// Close flushes the buffered output and closes the output file. It is a no-op once closed.
+func (w *outputWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	err := w.Flush()
+	if w.file != nil {
+		if closeErr := w.file.Close(); err == nil {
+			err = closeErr
+		}
 	}
+	return err
 }
@@ -1,7 +1,14 @@
 package options
 
 import (
+	"bytes"
+	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/kyaml/kio"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
 )
 
 type fields struct {
@@ -15,36 +22,251 @@ type suite struct {
 	wantErr bool
 }
 
+// expectResult is a result expected in the output, and the message of the result contains the message.
+type expectResult struct {
+	severity string
+	message  string
+}
+
 func TestRunCode(t *testing.T) {
-	tests := []suite{
+	deploymentWithAnnotation := `
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    annotations:
+      managed-by: krm-kcl
+  spec:
+    replicas: 2
+`
+	tests := []struct {
+		name    string
+		fields  fields
+		wantErr bool
+		// expectItems are the output items in order, which are compared regardless of the order of the fields.
+		expectItems string
+		// expectResults are the output results in order.
+		expectResults []expectResult
+	}{
 		{
-			"resource_list",
-			fields{
-				InputPath: "./testdata/resource_list/kcl-run-code.yaml",
-			},
-			false,
+			name:        "resource_list",
+			fields:      fields{InputPath: "./testdata/resource_list/kcl-run-code.yaml"},
+			expectItems: deploymentWithAnnotation + "- kind: Service\n",
 		},
 		{
-			"yaml_stream",
-			fields{
-				InputPath: "./testdata/yaml_stream/kcl-run-code.yaml",
-			},
-			false,
+			name:        "resource_list_configmap",
+			fields:      fields{InputPath: "./testdata/resource_list/kcl-run-configmap.yaml"},
+			expectItems: deploymentWithAnnotation + "- kind: Service\n",
+		},
+		{
+			// The Service does not match the constraints, and it is output unchanged at its original position.
+			name:        "resource_list_match_constraints",
+			fields:      fields{InputPath: "./testdata/resource_list/kcl-run-match-constraints.yaml"},
+			expectItems: deploymentWithAnnotation + "- apiVersion: v1\n  kind: Service\n",
+		},
+		{
+			// The KCLRun in the items is consumed by the function, and it is dropped from the output.
+			name:        "resource_list_kclrun_item",
+			fields:      fields{InputPath: "./testdata/resource_list/kcl-run-kclrun-item.yaml"},
+			expectItems: deploymentWithAnnotation + "- apiVersion: v1\n  kind: Service\n",
+		},
+		{
+			name:   "resource_list_results",
+			fields: fields{InputPath: "./testdata/resource_list/kcl-run-results.yaml"},
+			expectItems: `
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: nginx
+  spec:
+    replicas: 2
+`,
+			expectResults: []expectResult{{severity: "info", message: "The number of replicas is 2"}},
+		},
+		{
+			name:    "resource_list_assert_failure",
+			fields:  fields{InputPath: "./testdata/resource_list/kcl-run-assert-failure.yaml"},
+			wantErr: true,
+		},
+		{
+			// The resources are output unchanged with the warnings of the failed assertion.
+			name:   "resource_list_assert_warn",
+			fields: fields{InputPath: "./testdata/resource_list/kcl-run-assert-warn.yaml"},
+			expectItems: `
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: nginx
+  spec:
+    enforcementAction: warn
+    replicas: 6
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: redis
+  spec:
+    enforcementAction: warn
+    replicas: 2
+`,
+			expectResults: []expectResult{{severity: "warning", message: "The number of replicas 6 is not allowed for nginx"}},
+		},
+		{
+			name:   "resource_list_assert_dryrun",
+			fields: fields{InputPath: "./testdata/resource_list/kcl-run-assert-dryrun.yaml"},
+			expectItems: `
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: nginx
+  spec:
+    enforcementAction: dryrun
+    replicas: 6
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: redis
+  spec:
+    enforcementAction: dryrun
+    replicas: 2
+`,
+			expectResults: []expectResult{{severity: "info", message: "The number of replicas 6 is not allowed for nginx"}},
+		},
+		{
+			name:    "resource_list_compile_error_warn",
+			fields:  fields{InputPath: "./testdata/resource_list/kcl-run-compile-error-warn.yaml"},
+			wantErr: true,
+		},
+		{
+			name:    "resource_list_validation_contract",
+			fields:  fields{InputPath: "./testdata/resource_list/kcl-run-validation-contract.yaml"},
+			wantErr: true,
+		},
+		{
+			name:   "resource_list_steps",
+			fields: fields{InputPath: "./testdata/resource_list/kcl-run-steps.yaml"},
+			expectItems: `
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: nginx
+    namespace: default
+    annotations:
+      managed-by: krm-kcl
+  spec:
+    replicas: 2
+- apiVersion: v1
+  kind: Service
+  metadata:
+    name: nginx
+    namespace: default
+`,
+		},
+		{
+			name:   "resource_list_v1beta1",
+			fields: fields{InputPath: "./testdata/resource_list/kcl-run-v1beta1.yaml"},
+			expectItems: `
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: nginx
+    annotations:
+      managed-by: krm-kcl
+  spec:
+    replicas: 2
+`,
+		},
+		{
+			// The inline params take precedence, and the local config referenced by paramsFrom is dropped.
+			name:   "resource_list_params_from",
+			fields: fields{InputPath: "./testdata/resource_list/kcl-run-params-from.yaml"},
+			expectItems: `
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: nginx
+    annotations:
+      env: prod
+      managed-by: krm-kcl
+  spec:
+    replicas: 2
+`,
+		},
+		{
+			name:   "resource_list_profiles",
+			fields: fields{InputPath: "./testdata/resource_list/kcl-run-profiles.yaml"},
+			expectItems: `
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: nginx
+    labels:
+      app: nginx
+      env: prod
+  spec:
+    replicas: 3
+`,
+		},
+		{
+			name:    "resource_list_params_schema",
+			fields:  fields{InputPath: "./testdata/resource_list/kcl-run-params-schema.yaml"},
+			wantErr: true,
+		},
+		{
+			name:    "resource_list_sandbox",
+			fields:  fields{InputPath: "./testdata/resource_list/kcl-run-sandbox.yaml"},
+			wantErr: true,
+		},
+		{
+			// The KCLRun in the YAML stream is consumed by the function, and it is dropped from the output.
+			name:        "yaml_stream",
+			fields:      fields{InputPath: "./testdata/yaml_stream/kcl-run-code.yaml"},
+			expectItems: deploymentWithAnnotation + "- kind: Service\n",
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			o := &RunOptions{
 				InputPath:  tt.fields.InputPath,
-				OutputPath: tt.fields.OutputPath,
+				OutputPath: filepath.Join(t.TempDir(), "output.yaml"),
 			}
 			if err := o.Run(); (err != nil) != tt.wantErr {
 				t.Errorf("TestRunCode() error = %v, wantErr %v", err, tt.wantErr)
 			}
+			if tt.wantErr {
+				return
+			}
+			items, results := readOutput(t, o.OutputPath)
+			var expectItems []interface{}
+			assert.NoError(t, yaml.Unmarshal([]byte(tt.expectItems), &expectItems))
+			assert.Equal(t, expectItems, items)
+			assert.Len(t, results, len(tt.expectResults))
+			for i := 0; i < len(results) && i < len(tt.expectResults); i++ {
+				assert.Equal(t, tt.expectResults[i].severity, results[i]["severity"])
+				assert.Contains(t, results[i]["message"], tt.expectResults[i].message)
+			}
 		})
 	}
 }
 
+// readOutput reads the items and the results of the output ResourceList or YAML stream.
+func readOutput(t *testing.T, path string) ([]interface{}, []map[string]interface{}) {
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	reader := &kio.ByteReader{Reader: bytes.NewReader(data), OmitReaderAnnotations: true}
+	nodes, err := reader.Read()
+	assert.NoError(t, err)
+	var items []interface{}
+	for _, n := range nodes {
+		var item interface{}
+		assert.NoError(t, yaml.Unmarshal([]byte(n.MustString()), &item))
+		items = append(items, item)
+	}
+	var results []map[string]interface{}
+	if reader.Results != nil {
+		assert.NoError(t, yaml.Unmarshal([]byte(reader.Results.MustString()), &results))
+	}
+	return items, results
+}
+
 func TestRunLocalPath(t *testing.T) {
 	tests := []suite{
 		{
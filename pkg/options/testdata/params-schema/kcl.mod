@@ -0,0 +1,3 @@
+[package]
+name = "params-schema"
+version = "0.0.1"
@@ -0,0 +1,386 @@
+package source
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// CacheDirEnvVar is the environment variable of the source cache directory.
+	CacheDirEnvVar = "KCL_CACHE_DIR"
+	// DefaultCacheTTL is the default time to live of the cache entries of the mutable refs.
+	DefaultCacheTTL = time.Hour
+	// cacheContentDir is the directory of the source content in a cache entry.
+	cacheContentDir = "content"
+	// cacheMetaFile is the metadata file of a cache entry.
+	cacheMetaFile = "meta.json"
+)
+
+// commitRegexp matches the full Git commit SHAs, which are immutable refs.
+var commitRegexp = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// Cache is the content-addressed cache of the fetched sources, which are keyed by the normalized
+// source and ref. The entries of the immutable refs, e.g., the Git commit SHAs, the OCI digests and
+// the HTTP sources with the checksum, never expire, and the entries of the mutable refs, e.g., the Git
+// branches and the OCI tags, expire after the TTL.
+type Cache struct {
+	// Dir is the cache directory, and defaults to DefaultCacheDir().
+	Dir string
+	// TTL is the time to live of the entries of the mutable refs, and defaults to DefaultCacheTTL.
+	TTL time.Duration
+	// Offline uses the cache entries only, including the expired ones, and fails fast when an entry is missing.
+	Offline bool
+}
+
+// CacheEntry is an entry of the source cache.
+type CacheEntry struct {
+	// Key is the cache key of the source.
+	Key string `json:"key"`
+	// Source is the normalized source without the ref and the credentials.
+	Source string `json:"source"`
+	// Ref is the ref of the source, e.g., a Git branch or an OCI tag, which is empty if it is not set.
+	Ref string `json:"ref,omitempty"`
+	// Immutable denotes whether the ref is immutable, and the immutable entries never expire.
+	Immutable bool `json:"immutable"`
+	// FetchedAt is the time when the source was fetched.
+	FetchedAt time.Time `json:"fetchedAt"`
+	// Size is the total size of the source content in bytes.
+	Size int64 `json:"size"`
+}
+
+// CacheMissError is returned when the source is not in the cache in the offline mode.
+type CacheMissError struct {
+	// Source is the missing source.
+	Source string
+}
+
+func (e *CacheMissError) Error() string {
+	return fmt.Sprintf("source %s is not in the cache in the offline mode", Redact(e.Source))
+}
+
+// DefaultCacheDir returns the source cache directory, which is the KCL_CACHE_DIR environment variable,
+// or the krm-kcl/sources directory under the user cache directory.
+func DefaultCacheDir() (string, error) {
+	if dir := os.Getenv(CacheDirEnvVar); dir != "" {
+		return dir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "krm-kcl", "sources"), nil
+}
+
+// NormalizeSource returns the normalized source without the ref and the credentials, the ref and
+// whether the ref is immutable, e.g., git::https://github.com/user/repo.git?ref=main returns
+// git::https://github.com/user/repo, main and false.
+func NormalizeSource(src string) (string, string, bool) {
+	src = strings.TrimSpace(src)
+	if IsOCI(src) {
+		repo := TrimOCIPrefix(src)
+		if i := strings.Index(repo, "@"); i >= 0 {
+			return OCIPrefix(repo[:i]), repo[i+1:], true
+		}
+		// The colon after the last slash separates the tag, and the other colons are the port separators.
+		if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+			return OCIPrefix(repo[:i]), repo[i+1:], false
+		}
+		return OCIPrefix(repo), "", false
+	}
+	forced := ""
+	if IsGit(src) {
+		forced = fmt.Sprintf("%s::", GitScheme)
+		src = strings.TrimPrefix(src, forced)
+	}
+	if IsVCSDomain(src) {
+		forced = fmt.Sprintf("%s::", GitScheme)
+		src = "https://" + src
+	}
+	u, err := url.Parse(src)
+	if err != nil {
+		return forced + src, "", false
+	}
+	u.User = nil
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	query := u.Query()
+	ref := query.Get("ref")
+	query.Del("ref")
+	// The secret parameters e.g., sshkey are not the part of the key.
+	for k := range query {
+		if secretQueryRegexp.MatchString("?" + k + "=" + RedactedValue) {
+			query.Del(k)
+		}
+	}
+	u.RawQuery = query.Encode()
+	if forced != "" {
+		u.Path = strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), ".git")
+	}
+	immutable := forced != "" && commitRegexp.MatchString(ref) || forced == "" && query.Get("checksum") != ""
+	return forced + u.String(), ref, immutable
+}
+
+// Key returns the cache key of the source, which is the SHA-256 digest of the normalized source and ref.
+func (c *Cache) Key(src string) string {
+	return sourceKey(src)
+}
+
+func sourceKey(src string) string {
+	normalized, ref, _ := NormalizeSource(src)
+	sum := sha256.Sum256([]byte(normalized + "#" + ref))
+	return hex.EncodeToString(sum[:])
+}
+
+// Fetch returns a temp copy of the cached content of the source, and the temp directory to be removed
+// by the caller. When the entry is missing or expired, the source is fetched into the cache by the fetch
+// function, which returns the fetched content directory and the temp directory to be removed, if any.
+func (c *Cache) Fetch(src string, fetch func() (string, string, error)) (string, string, error) {
+	dir, err := c.dir()
+	if err != nil {
+		return src, "", err
+	}
+	key := c.Key(src)
+	entry, err := c.entry(key)
+	if err != nil && !os.IsNotExist(err) {
+		return src, "", err
+	}
+	if entry == nil || (!c.Offline && c.expired(entry)) {
+		if c.Offline {
+			return src, "", &CacheMissError{Source: src}
+		}
+		content, tmpDir, err := fetch()
+		if tmpDir != "" {
+			defer os.RemoveAll(tmpDir)
+		}
+		if err != nil {
+			return src, "", err
+		}
+		if err := c.store(dir, key, src, content); err != nil {
+			return src, "", err
+		}
+	}
+	// The cached content is copied to keep the cache intact from the runs.
+	tmpDir, err := os.MkdirTemp("", "kcl-sandbox")
+	if err != nil {
+		return src, "", fmt.Errorf("error creating temp file: %v", err)
+	}
+	if err := copyDir(filepath.Join(dir, key, cacheContentDir), tmpDir); err != nil {
+		return src, tmpDir, err
+	}
+	return tmpDir, tmpDir, nil
+}
+
+// List returns all the cache entries sorted by the source and ref.
+func (c *Cache) List() ([]CacheEntry, error) {
+	dir, err := c.dir()
+	if err != nil {
+		return nil, err
+	}
+	dirs, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var entries []CacheEntry
+	for _, d := range dirs {
+		if !d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			continue
+		}
+		entry, err := c.entry(d.Name())
+		if err != nil {
+			// The entries without the valid metadata are incomplete and ignored.
+			continue
+		}
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Source != entries[j].Source {
+			return entries[i].Source < entries[j].Source
+		}
+		return entries[i].Ref < entries[j].Ref
+	})
+	return entries, nil
+}
+
+// Expired returns whether the cache entry is expired.
+func (c *Cache) Expired(entry CacheEntry) bool {
+	return c.expired(&entry)
+}
+
+// Prune removes the expired cache entries, or all the cache entries if all is true, and returns
+// the removed entries.
+func (c *Cache) Prune(all bool) ([]CacheEntry, error) {
+	entries, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := c.dir()
+	if err != nil {
+		return nil, err
+	}
+	var pruned []CacheEntry
+	for _, entry := range entries {
+		if !all && !c.expired(&entry) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, entry.Key)); err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, entry)
+	}
+	return pruned, nil
+}
+
+func (c *Cache) dir() (string, error) {
+	if c.Dir != "" {
+		return c.Dir, nil
+	}
+	return DefaultCacheDir()
+}
+
+func (c *Cache) ttl() time.Duration {
+	if c.TTL > 0 {
+		return c.TTL
+	}
+	return DefaultCacheTTL
+}
+
+func (c *Cache) expired(entry *CacheEntry) bool {
+	return !entry.Immutable && time.Since(entry.FetchedAt) > c.ttl()
+}
+
+// entry reads the metadata of the cache entry.
+func (c *Cache) entry(key string) (*CacheEntry, error) {
+	dir, err := c.dir()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, key, cacheMetaFile))
+	if err != nil {
+		return nil, err
+	}
+	entry := &CacheEntry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, fmt.Errorf("invalid cache entry %s: %v", key, err)
+	}
+	return entry, nil
+}
+
+// store copies the content into the cache entry of the source. The entry is written into a temp
+// directory and renamed, so that the concurrent runs never see a partial entry.
+func (c *Cache) store(dir, key, src, content string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmpDir, err := os.MkdirTemp(dir, "."+key)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	if err := copyDir(content, filepath.Join(tmpDir, cacheContentDir)); err != nil {
+		return err
+	}
+	normalized, ref, immutable := NormalizeSource(src)
+	entry := CacheEntry{
+		Key:       key,
+		Source:    normalized,
+		Ref:       ref,
+		Immutable: immutable,
+		FetchedAt: time.Now().UTC(),
+		Size:      dirSize(filepath.Join(tmpDir, cacheContentDir)),
+	}
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, cacheMetaFile), data, 0644); err != nil {
+		return err
+	}
+	target := filepath.Join(dir, key)
+	if err := os.RemoveAll(target); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpDir, target); err != nil {
+		// The entry may be stored by a concurrent run in the meantime.
+		if _, statErr := os.Stat(filepath.Join(target, cacheMetaFile)); statErr != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyDir copies the files, the directories and the symbolic links of the source directory into the
+// destination directory, except the .git directories.
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case d.IsDir() && d.Name() == ".git":
+			return filepath.SkipDir
+		case d.IsDir():
+			return os.MkdirAll(target, 0755)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		default:
+			return copyFile(p, target)
+		}
+	})
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// dirSize returns the total size of the regular files in the directory.
+func dirSize(dir string) int64 {
+	var size int64
+	_ = filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,91 @@
+package source
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-getter"
+)
+
+const (
+	// gitConfigCountEnvVar is the environment variable of the number of the git config entries set
+	// through the environment, see https://git-scm.com/docs/git-config#ENVIRONMENT
+	gitConfigCountEnvVar = "GIT_CONFIG_COUNT"
+	// gitConfigKeyEnvVar is the environment variable prefix of the git config entry keys.
+	gitConfigKeyEnvVar = "GIT_CONFIG_KEY_"
+	// gitConfigValueEnvVar is the environment variable prefix of the git config entry values.
+	gitConfigValueEnvVar = "GIT_CONFIG_VALUE_"
+)
+
+// BasicAuth is the username and password of the Git requests to the URL prefix, e.g., https://github.com/
+type BasicAuth struct {
+	URL      string
+	Username string
+	Password string
+}
+
+// header returns the Authorization header of the basic auth.
+func (a BasicAuth) header() string {
+	return "Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(a.Username+":"+a.Password))
+}
+
+// WithBasicAuth returns the getter client option which authenticates the Git requests over HTTP(S) with
+// the username and password. The credentials are passed to git in the Authorization header scoped to the
+// source host through the environment of the git commands only, so they never appear in the source URL,
+// the git command line, the getter errors and the environment of the process. It requires git 2.31 or later.
+func WithBasicAuth(username, password string) getter.ClientOption {
+	return func(c *getter.Client) error {
+		g := withGitGetter(c)
+		g.username, g.password = username, password
+		return nil
+	}
+}
+
+// GitCommandEnv returns the environment of the git commands, which is the environment of the process
+// with the `http.<url>.extraHeader` git config entries of the basic auths appended after the git config
+// entries already set through the environment. The environment of the process is not changed.
+func GitCommandEnv(auths ...BasicAuth) []string {
+	env := os.Environ()
+	count, _ := strconv.Atoi(os.Getenv(gitConfigCountEnvVar))
+	for i, kv := range env {
+		if strings.HasPrefix(kv, gitConfigCountEnvVar+"=") {
+			env = append(env[:i:i], env[i+1:]...)
+			break
+		}
+	}
+	for _, auth := range auths {
+		env = append(env,
+			fmt.Sprintf("%s%d=http.%s.extraHeader", gitConfigKeyEnvVar, count, auth.URL),
+			fmt.Sprintf("%s%d=%s", gitConfigValueEnvVar, count, auth.header()),
+		)
+		count++
+	}
+	return append(env, fmt.Sprintf("%s=%d", gitConfigCountEnvVar, count))
+}
+
+// Host returns the host of the remote source, e.g., oci://ghcr.io/kcl-lang/pkg => ghcr.io, or an empty
+// string if the source is not a remote source.
+func Host(src string) string {
+	switch {
+	case IsOCI(src):
+		src = TrimOCIPrefix(src)
+	case IsGit(src):
+		src = strings.TrimPrefix(src, fmt.Sprintf("%s::", GitScheme))
+	case IsVCSDomain(src):
+	case IsRemoteUrl(src):
+	default:
+		return ""
+	}
+	if i := strings.Index(src, "://"); i >= 0 {
+		src = src[i+3:]
+	}
+	host, _, _ := strings.Cut(src, "/")
+	// Strip the userinfo, e.g., git@github.com
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		host = host[i+1:]
+	}
+	return host
+}
@@ -0,0 +1,236 @@
+package source
+
+import (
+	"context"
+	"crypto"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/go-getter"
+)
+
+const (
+	// DefaultBackoff is the default backoff before the first retry of a failed fetch.
+	DefaultBackoff = time.Second
+	// DefaultMaxBackoff is the default max backoff between the retries of a failed fetch.
+	DefaultMaxBackoff = 30 * time.Second
+)
+
+// FetchEvent is the event of the fetch progress.
+type FetchEvent string
+
+const (
+	// FetchStarted is reported when an attempt of the fetch starts.
+	FetchStarted FetchEvent = "started"
+	// FetchDownloading is reported when the bytes of a file are downloaded, which is only reported by
+	// the getters that track the downloads, e.g., the HTTP getter.
+	FetchDownloading FetchEvent = "downloading"
+	// FetchRetrying is reported when an attempt of the fetch fails and the fetch is retried after the backoff.
+	FetchRetrying FetchEvent = "retrying"
+	// FetchSucceeded is reported when the fetch succeeds.
+	FetchSucceeded FetchEvent = "succeeded"
+	// FetchFailed is reported when the fetch fails, the retries are exhausted or the context is done.
+	FetchFailed FetchEvent = "failed"
+)
+
+// FetchProgress is the progress of a fetch reported to the progress callback.
+type FetchProgress struct {
+	// Event is the event of the progress.
+	Event FetchEvent
+	// Source is the fetched source, which may contain the credentials and should be redacted before it is logged.
+	Source string
+	// Attempt is the attempt number of the fetch starting from 1.
+	Attempt int
+	// Downloaded and Total are the downloaded and the total bytes of the FetchDownloading event,
+	// and Total is -1 if it is unknown.
+	Downloaded, Total int64
+	// Backoff is the backoff before the next attempt of the FetchRetrying event.
+	Backoff time.Duration
+	// Err is the error of the FetchRetrying and FetchFailed events.
+	Err error
+}
+
+// ProgressFunc is the callback which receives the fetch progress. It is called in the fetching goroutine
+// and should return quickly.
+type ProgressFunc func(FetchProgress)
+
+// FetchOptions are the options to fetch the remote source.
+type FetchOptions struct {
+	// Retries is the max number of retries of a failed fetch, and the failed fetch is not retried by default.
+	Retries int
+	// Backoff is the backoff before the first retry, which is doubled for each retry and defaults to DefaultBackoff.
+	Backoff time.Duration
+	// MaxBackoff is the max backoff between the retries, and defaults to DefaultMaxBackoff.
+	MaxBackoff time.Duration
+	// Progress is the callback which receives the fetch progress.
+	Progress ProgressFunc
+	// Cache is the cache of the fetched sources, and the sources are always fetched if it is nil.
+	Cache *Cache
+	// PublicKey verifies the signatures of the OCI and HTTP sources, and defaults to the public key
+	// of the KCL_PUBLIC_KEY environment variable.
+	PublicKey crypto.PublicKey
+	// RequireSignature requires the valid signatures of all the sources, and the sources which can
+	// not be signed, e.g., the Git sources, are rejected.
+	RequireSignature bool
+	// PlainHTTP pulls the OCI sources over the plain HTTP.
+	PlainHTTP bool
+	// Insecure skips the TLS verification of the OCI registries and the HTTP signature downloads.
+	Insecure bool
+	// HTTPClient is the client of the OCI registries and the HTTP signature downloads, and defaults to
+	// the http.DefaultClient, or the client which skips the TLS verification when Insecure is set.
+	HTTPClient *http.Client
+	// Credentials returns the credentials of the OCI registries.
+	Credentials CredentialsFunc
+	// Registry detects the kinds of the sources and fetches them, and defaults to the DefaultRegistry.
+	Registry *Registry
+	// Lock verifies the remote sources and the dependencies, and the Git sources are fetched at the locked
+	// commits. It defaults to the lock file of the KCL_LOCK_FILE environment variable.
+	Lock *Lock
+}
+
+// Sources returns the source registry of the options, or the DefaultRegistry if it is not set.
+func (o *FetchOptions) Sources() *Registry {
+	if o == nil || o.Registry == nil {
+		return DefaultRegistry
+	}
+	return o.Registry
+}
+
+// GetLock returns the lock of the options, or the DefaultLock if it is not set. Nil is returned if no
+// lock is configured.
+func (o *FetchOptions) GetLock() (*Lock, error) {
+	if o == nil || o.Lock == nil {
+		return DefaultLock()
+	}
+	return o.Lock, nil
+}
+
+// signature returns the signature options of the fetch, or nil if the signatures are not verified.
+// The signatures are verified when a public key is configured, which is required when the signatures
+// are required.
+func (o *FetchOptions) signature() (*SignatureOptions, error) {
+	key := o.PublicKey
+	if key == nil {
+		var err error
+		if key, err = DefaultPublicKey(); err != nil {
+			return nil, err
+		}
+	}
+	if key == nil {
+		if o.RequireSignature {
+			return nil, fmt.Errorf("the signature is required but no public key is configured, set the %s environment variable", PublicKeyEnvVar)
+		}
+		return nil, nil
+	}
+	return &SignatureOptions{PublicKey: key, HTTPClient: o.httpClient()}, nil
+}
+
+// httpClient returns the HTTP client of the options.
+func (o *FetchOptions) httpClient() *http.Client {
+	if o.HTTPClient != nil {
+		return o.HTTPClient
+	}
+	if !o.Insecure {
+		return http.DefaultClient
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	return &http.Client{Transport: transport}
+}
+
+// VerifiesSignature returns whether the signatures of the sources are verified.
+func (o *FetchOptions) VerifiesSignature() (bool, error) {
+	if o == nil {
+		o = &FetchOptions{}
+	}
+	sig, err := o.signature()
+	return sig != nil, err
+}
+
+// backoff returns the backoff after the failed attempt.
+func (o *FetchOptions) backoff(attempt int) time.Duration {
+	backoff, max := o.Backoff, o.MaxBackoff
+	if backoff <= 0 {
+		backoff = DefaultBackoff
+	}
+	if max <= 0 {
+		max = DefaultMaxBackoff
+	}
+	for i := 1; i < attempt && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	return backoff
+}
+
+// report reports the progress to the progress callback if any.
+func (o *FetchOptions) report(p FetchProgress) {
+	if o.Progress != nil {
+		p.Source = Redact(p.Source)
+		if p.Err != nil {
+			p.Err = RedactError(p.Err)
+		}
+		o.Progress(p)
+	}
+}
+
+// tracker returns the download tracker of the attempt, or nil if there is no progress callback.
+func (o *FetchOptions) tracker(src string, attempt int) getter.ProgressTracker {
+	if o.Progress == nil {
+		return nil
+	}
+	return &progressTracker{o: o, src: src, attempt: attempt}
+}
+
+// progressTracker reports the downloaded bytes of the getters as the FetchDownloading events.
+type progressTracker struct {
+	o       *FetchOptions
+	src     string
+	attempt int
+}
+
+// TrackProgress implements the getter.ProgressTracker interface.
+func (t *progressTracker) TrackProgress(_ string, currentSize, totalSize int64, stream io.ReadCloser) io.ReadCloser {
+	if totalSize <= currentSize {
+		totalSize = -1
+	}
+	return &progressReader{ReadCloser: stream, t: t, downloaded: currentSize, total: totalSize}
+}
+
+type progressReader struct {
+	io.ReadCloser
+	t                 *progressTracker
+	downloaded, total int64
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.downloaded += int64(n)
+		r.t.o.report(FetchProgress{
+			Event:      FetchDownloading,
+			Source:     r.t.src,
+			Attempt:    r.t.attempt,
+			Downloaded: r.downloaded,
+			Total:      r.total,
+		})
+	}
+	return n, err
+}
+
+// sleep waits for the duration and returns the context error if the context is done before.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,94 @@
+package source
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadThroughGetterWithContext(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			return
+		}
+		// The first two downloads fail.
+		if atomic.AddInt32(&requests, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("a = 1"))
+	}))
+	defer server.Close()
+
+	var events []FetchEvent
+	src, tmpDir, err := ReadThroughGetterWithContext(context.Background(), server.URL+"/main.k", &FetchOptions{
+		Retries: 2,
+		Backoff: time.Millisecond,
+		Progress: func(p FetchProgress) {
+			if len(events) == 0 || events[len(events)-1] != p.Event {
+				events = append(events, p.Event)
+			}
+		},
+	})
+	defer os.RemoveAll(tmpDir)
+	assert.NoError(t, err)
+	assert.Equal(t, []FetchEvent{
+		FetchStarted, FetchRetrying, FetchStarted, FetchRetrying, FetchStarted, FetchDownloading, FetchSucceeded,
+	}, events)
+	data, err := os.ReadFile(filepath.Join(src, "main.k"))
+	assert.NoError(t, err)
+	assert.Equal(t, "a = 1", string(data))
+
+	// The retries are exhausted.
+	atomic.StoreInt32(&requests, 0)
+	_, tmpDir, err = ReadThroughGetterWithContext(context.Background(), server.URL+"/main.k", &FetchOptions{
+		Retries: 1,
+		Backoff: time.Millisecond,
+	})
+	defer os.RemoveAll(tmpDir)
+	assert.ErrorContains(t, err, "bad response code: 503")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
+
+func TestReadThroughGetterWithCanceledContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var last FetchProgress
+	_, tmpDir, err := ReadThroughGetterWithContext(ctx, server.URL+"/main.k", &FetchOptions{
+		Retries: 10,
+		Backoff: time.Hour,
+		Progress: func(p FetchProgress) {
+			// Cancel the fetch in the backoff.
+			if p.Event == FetchRetrying {
+				cancel()
+			}
+			last = p
+		},
+	})
+	defer os.RemoveAll(tmpDir)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, FetchFailed, last.Event)
+	assert.Equal(t, 1, last.Attempt)
+}
+
+func TestFetchBackoff(t *testing.T) {
+	o := &FetchOptions{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	assert.Equal(t, time.Second, o.backoff(1))
+	assert.Equal(t, 2*time.Second, o.backoff(2))
+	assert.Equal(t, 4*time.Second, o.backoff(3))
+	assert.Equal(t, 5*time.Second, o.backoff(4))
+	assert.Equal(t, DefaultBackoff, (&FetchOptions{}).backoff(1))
+	assert.Equal(t, DefaultMaxBackoff, (&FetchOptions{}).backoff(100))
+}
@@ -4,9 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/signal"
 	"path/filepath"
-	"sync"
 
 	"github.com/hashicorp/go-getter"
 )
@@ -15,6 +13,72 @@ import (
 // It gets the pwd, creates temp files, and builds the client to get the code content.
 // If an error occurs during the acquisition process, an error message will be returned.
 func ReadThroughGetter(src string, opts ...getter.ClientOption) (string, string, error) {
+	return ReadThroughGetterWithContext(context.Background(), src, nil, opts...)
+}
+
+// ReadThroughGetterWithContext gets the source code content in the same way as ReadThroughGetter, and stops
+// the fetch when the context is done. The failed fetches are retried with the backoff of the fetch options,
+// and the progress is reported through the progress callback of the fetch options. The source is read
+// from the cache of the fetch options if any.
+func ReadThroughGetterWithContext(ctx context.Context, src string, o *FetchOptions, opts ...getter.ClientOption) (string, string, error) {
+	if o == nil {
+		o = &FetchOptions{}
+	}
+	// The HTTP sources are verified against the signatures, and then pinned to the verified checksums.
+	sig, err := o.signature()
+	if err != nil {
+		return src, "", err
+	}
+	if sig != nil {
+		if !IsRemoteUrl(src) {
+			if o.RequireSignature {
+				return src, "", &SignatureError{Source: src, Err: fmt.Errorf("the source type does not support signatures")}
+			}
+		} else if o.Cache != nil && o.Cache.Offline {
+			return src, "", &SignatureError{Source: src, Err: fmt.Errorf("the signature can not be verified in the offline mode")}
+		} else {
+			digest, err := VerifyBlob(ctx, src, sig)
+			if err != nil {
+				return src, "", err
+			}
+			src = WithChecksum(src, digest)
+		}
+	}
+	if o.Cache != nil {
+		return o.Cache.Fetch(src, func() (string, string, error) {
+			return readThroughGetter(ctx, src, o, opts...)
+		})
+	}
+	return readThroughGetter(ctx, src, o, opts...)
+}
+
+// readThroughGetter gets the source code content with the retries.
+func readThroughGetter(ctx context.Context, src string, o *FetchOptions, opts ...getter.ClientOption) (string, string, error) {
+	for attempt := 1; ; attempt++ {
+		o.report(FetchProgress{Event: FetchStarted, Source: src, Attempt: attempt})
+		dst, tmpDir, err := getThrough(ctx, src, o.tracker(src, attempt), opts...)
+		if err == nil {
+			o.report(FetchProgress{Event: FetchSucceeded, Source: src, Attempt: attempt})
+			return dst, tmpDir, nil
+		}
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		} else if attempt <= o.Retries {
+			backoff := o.backoff(attempt)
+			o.report(FetchProgress{Event: FetchRetrying, Source: src, Attempt: attempt, Backoff: backoff, Err: err})
+			os.RemoveAll(tmpDir)
+			if err = sleep(ctx, backoff); err == nil {
+				continue
+			}
+		}
+		o.report(FetchProgress{Event: FetchFailed, Source: src, Attempt: attempt, Err: err})
+		return src, tmpDir, err
+	}
+}
+
+// getThrough gets the source code content into a new temp directory once, and returns the path of the
+// source code content and the temp directory.
+func getThrough(ctx context.Context, src string, tracker getter.ProgressTracker, opts ...getter.ClientOption) (string, string, error) {
 	// Get the pwd
 	pwd, err := os.Getwd()
 	if err != nil {
@@ -23,50 +87,30 @@ func ReadThroughGetter(src string, opts ...getter.ClientOption) (string, string,
 	// Create temp files.
 	tmpDir, err := os.MkdirTemp("", "kcl-sandbox")
 	if err != nil {
-		return "", tmpDir, fmt.Errorf("error creating temp file: %v", err)
+		return src, tmpDir, fmt.Errorf("error creating temp file: %v", err)
 	}
-
+	dst := tmpDir
 	// go-getter should download the source code to a directory which not exists.
 	// if the path exists, it will return an error.
 	if IsGit(src) || IsVCSDomain(src) {
-		tmpDir = filepath.Join(tmpDir, "git")
+		dst = filepath.Join(tmpDir, "git")
+	}
+	if tracker != nil {
+		opts = append(opts, getter.WithProgress(tracker))
 	}
-
-	// Getter context
-	ctx, cancel := context.WithCancel(context.Background())
 	// Build the client
 	client := &getter.Client{
 		Ctx:     ctx,
 		Src:     src,
-		Dst:     tmpDir,
+		Dst:     dst,
 		Pwd:     pwd,
 		Mode:    getter.ClientModeAny,
 		Options: opts,
 	}
-
-	wg := sync.WaitGroup{}
-	wg.Add(1)
-	errChan := make(chan error, 2)
-	go func() {
-		defer wg.Done()
-		defer cancel()
-		if err := client.Get(); err != nil {
-			errChan <- err
-		}
-	}()
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	select {
-	case <-c:
-		signal.Reset(os.Interrupt)
-		cancel()
-		wg.Wait()
-	case <-ctx.Done():
-		wg.Wait()
-	case err := <-errChan:
-		wg.Wait()
-		return src, tmpDir, err
+	if err := client.Get(); err != nil {
+		// The getter errors may echo the source URL with the credentials.
+		return src, tmpDir, RedactError(err)
 	}
 	// Read source from the temp directory
-	return tmpDir, tmpDir, nil
+	return dst, tmpDir, nil
 }
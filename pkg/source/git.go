@@ -1,8 +1,18 @@
 package source
 
 import (
+	"bufio"
+	"context"
 	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
+
+	"github.com/hashicorp/go-getter"
 )
 
 const (
@@ -25,3 +35,175 @@ func IsGit(src string) bool {
 func IsVCSDomain(src string) bool {
 	return strings.HasPrefix(src, GitHubDomain) || strings.HasPrefix(src, GitLabDomain) || strings.HasPrefix(src, BitBucketDomain)
 }
+
+// GitSource is the built-in source of the Git repositories.
+type GitSource struct{}
+
+// Detect implements Source.
+func (s *GitSource) Detect(src string) bool {
+	return IsGit(src) || IsVCSDomain(src)
+}
+
+// Fetch implements Source, and the repository is cloned with the getter.
+func (s *GitSource) Fetch(ctx context.Context, src string, o *FetchOptions, opts ...getter.ClientOption) (string, string, error) {
+	return ReadThroughGetterWithContext(ctx, src, o, opts...)
+}
+
+// GitCommit returns the commit of the HEAD of the Git repository cloned by the getter into the directory.
+// The commit is read from the repository files, e.g., `.git/HEAD`, the loose refs and the packed refs,
+// without running git.
+func GitCommit(dir string) (string, error) {
+	gitDir := filepath.Join(dir, ".git")
+	data, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return "", err
+	}
+	head := strings.TrimSpace(string(data))
+	// The symbolic refs are resolved once, e.g., `ref: refs/heads/main`
+	ref, ok := strings.CutPrefix(head, "ref: ")
+	if !ok {
+		return head, nil
+	}
+	if data, err := os.ReadFile(filepath.Join(gitDir, filepath.FromSlash(ref))); err == nil {
+		return strings.TrimSpace(string(data)), nil
+	}
+	f, err := os.Open(filepath.Join(gitDir, "packed-refs"))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve the git ref %s: %v", ref, err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if commit, name, ok := strings.Cut(scanner.Text(), " "); ok && name == ref {
+			return commit, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("failed to resolve the git ref %s", ref)
+}
+
+// WithGitCommit returns the getter client option which records the commit of the HEAD of the cloned Git
+// repository. The commit is read before the getter copies the subdirectory of the source, e.g.,
+// git::https://github.com/kcl-lang/krm-kcl//examples?ref=main, out of the repository.
+func WithGitCommit(commit *string) getter.ClientOption {
+	return func(c *getter.Client) error {
+		withGitGetter(c).commit = commit
+		return nil
+	}
+}
+
+// gitGetter is the git getter of the sources. The repositories over HTTP(S) with the basic auth are
+// cloned with the git commands whose own environment carries the Authorization header, and the others
+// are cloned by the go-getter git getter.
+type gitGetter struct {
+	*getter.GitGetter
+	username string
+	password string
+	// commit records the commit of the cloned repository if it is not nil.
+	commit *string
+}
+
+// withGitGetter installs the git getter into the getter client once, and returns it to be configured
+// by the client options.
+func withGitGetter(c *getter.Client) *gitGetter {
+	if g, ok := c.Getters[GitScheme].(*gitGetter); ok {
+		return g
+	}
+	base := c.Getters
+	if base == nil {
+		base = getter.Getters
+	}
+	getters := make(map[string]getter.Getter, len(base))
+	for scheme, g := range base {
+		getters[scheme] = g
+	}
+	g := &gitGetter{GitGetter: new(getter.GitGetter)}
+	getters[GitScheme] = g
+	c.Getters = getters
+	return g
+}
+
+// Get implements getter.Getter.
+func (g *gitGetter) Get(dst string, u *url.URL) error {
+	var err error
+	if (g.username != "" || g.password != "") && (u.Scheme == HttpsScheme || u.Scheme == HttpScheme) {
+		err = g.clone(dst, u)
+	} else {
+		err = g.GitGetter.Get(dst, u)
+	}
+	if err != nil || g.commit == nil {
+		return err
+	}
+	*g.commit, err = GitCommit(dst)
+	return err
+}
+
+// GetFile implements getter.Getter, and the repository is cloned to copy the file every time.
+func (g *gitGetter) GetFile(dst string, u *url.URL) error {
+	td, err := os.MkdirTemp("", "getter")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(td)
+	repo := *u
+	repo.Path = path.Dir(u.Path)
+	if err := g.Get(td, &repo); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(filepath.Join(td, path.Base(u.Path)))
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0644)
+}
+
+// clone clones the repository in the same way as the go-getter git getter, e.g., the ref and the depth
+// parameters and the submodules, and the basic auth scoped to the host of the URL is only passed in the
+// environment of the git commands.
+func (g *gitGetter) clone(dst string, u *url.URL) error {
+	ctx := g.Context()
+	if g.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.Timeout)
+		defer cancel()
+	}
+	q := u.Query()
+	ref := q.Get("ref")
+	depth, _ := strconv.Atoi(q.Get("depth"))
+	q.Del("ref")
+	q.Del("depth")
+	repo := *u
+	repo.RawQuery = q.Encode()
+	env := GitCommandEnv(BasicAuth{URL: fmt.Sprintf("%s://%s/", u.Scheme, u.Host), Username: g.username, Password: g.password})
+	git := func(dir string, args ...string) error {
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = dir
+		cmd.Env = env
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("error running %s: %v\n%s", strings.Join(cmd.Args, " "), err, out)
+		}
+		return nil
+	}
+	args := []string{"clone"}
+	if depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(depth))
+		if ref != "" {
+			args = append(args, "--branch", ref)
+		}
+	}
+	if err := git("", append(args, "--", repo.String(), dst)...); err != nil {
+		return err
+	}
+	if ref != "" && depth <= 0 {
+		if err := git(dst, "checkout", ref); err != nil {
+			return err
+		}
+	}
+	args = []string{"submodule", "update", "--init", "--recursive"}
+	if depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(depth))
+	}
+	return git(dst, args...)
+}
@@ -1,8 +1,11 @@
 package source
 
 import (
+	"context"
 	"fmt"
 	"strings"
+
+	"github.com/hashicorp/go-getter"
 )
 
 const (
@@ -16,3 +19,16 @@ const (
 func IsRemoteUrl(src string) bool {
 	return strings.HasPrefix(src, fmt.Sprintf("%s://", HttpScheme)) || strings.HasPrefix(src, fmt.Sprintf("%s://", HttpsScheme))
 }
+
+// HttpSource is the built-in source of the files and the archives at the HTTP and HTTPS URLs.
+type HttpSource struct{}
+
+// Detect implements Source.
+func (s *HttpSource) Detect(src string) bool {
+	return IsRemoteUrl(src)
+}
+
+// Fetch implements Source, and the source is downloaded with the getter.
+func (s *HttpSource) Fetch(ctx context.Context, src string, o *FetchOptions, opts ...getter.ClientOption) (string, string, error) {
+	return ReadThroughGetterWithContext(ctx, src, o, opts...)
+}
@@ -1,8 +1,11 @@
 package source
 
 import (
+	"context"
 	"path/filepath"
 	"strings"
+
+	"github.com/hashicorp/go-getter"
 )
 
 // IsLocal determines whether or not a source is to be treated as a local path.
@@ -12,3 +15,16 @@ func IsLocal(src string) bool {
 	}
 	return false
 }
+
+// LocalSource is the built-in source of the local files and directories.
+type LocalSource struct{}
+
+// Detect implements Source.
+func (s *LocalSource) Detect(src string) bool {
+	return IsLocal(src)
+}
+
+// Fetch implements Source, and the local path is used as is.
+func (s *LocalSource) Fetch(ctx context.Context, src string, o *FetchOptions, opts ...getter.ClientOption) (string, string, error) {
+	return src, "", nil
+}
@@ -0,0 +1,262 @@
+package source
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	k8syaml "sigs.k8s.io/yaml"
+)
+
+const (
+	// LockFileName is the default name of the lock file.
+	LockFileName = "krm-kcl.lock"
+	// LockFileEnvVar is the environment variable of the lock file honored by the KCL runs.
+	LockFileEnvVar = "KCL_LOCK_FILE"
+	// LockAPIVersion is the API version of the lock file.
+	LockAPIVersion = "krm.kcl.dev/v1alpha1"
+	// LockKind is the kind of the lock file.
+	LockKind = "KCLRunLock"
+)
+
+// Lock locks the remote sources and the dependencies of the KCLRuns to the immutable digests of
+// their content, and the Git sources to the commits.
+type Lock struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	// Sources are the locked remote sources.
+	Sources []LockedSource `json:"sources,omitempty"`
+	// Dependencies are the locked dependencies, including the indirect ones.
+	Dependencies []LockedDependency `json:"dependencies,omitempty"`
+}
+
+// LockedSource is a remote source locked to the digest of its content.
+type LockedSource struct {
+	// Source is the source of the KCLRun without the credentials.
+	Source string `json:"source"`
+	// Commit is the commit of the Git source.
+	Commit string `json:"commit,omitempty"`
+	// Digest is the digest of the source content, e.g., sha256:...
+	Digest string `json:"digest"`
+}
+
+// LockedDependency is a dependency locked to the digest of its content.
+type LockedDependency struct {
+	// Name is the package name of the dependency.
+	Name string `json:"name"`
+	// Digest is the digest of the dependency content, e.g., sha256:...
+	Digest string `json:"digest"`
+}
+
+// LockDriftError is returned when the sources or the dependencies drift from the lock file.
+type LockDriftError struct {
+	// Drifts are all the drifts from the lock file.
+	Drifts []string
+}
+
+func (e *LockDriftError) Error() string {
+	return fmt.Sprintf("lock drift: [%s]", strings.Join(e.Drifts, ", "))
+}
+
+// NewLock returns an empty lock.
+func NewLock() *Lock {
+	return &Lock{APIVersion: LockAPIVersion, Kind: LockKind}
+}
+
+// LoadLock reads the lock file.
+func LoadLock(path string) (*Lock, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	lock := &Lock{}
+	if err := k8syaml.UnmarshalStrict(data, lock); err != nil {
+		return nil, fmt.Errorf("invalid lock file %s: %v", path, err)
+	}
+	if lock.APIVersion != LockAPIVersion || lock.Kind != LockKind {
+		return nil, fmt.Errorf("invalid lock file %s: expect %s %s, but we got: %s %s", path, LockAPIVersion, LockKind, lock.APIVersion, lock.Kind)
+	}
+	return lock, nil
+}
+
+// DefaultLock reads the lock file of the KCL_LOCK_FILE environment variable, and returns nil if it is not set.
+func DefaultLock() (*Lock, error) {
+	path := os.Getenv(LockFileEnvVar)
+	if path == "" {
+		return nil, nil
+	}
+	return LoadLock(path)
+}
+
+// Write writes the lock file with the sources and the dependencies sorted.
+func (l *Lock) Write(path string) error {
+	sort.Slice(l.Sources, func(i, j int) bool { return l.Sources[i].Source < l.Sources[j].Source })
+	sort.Slice(l.Dependencies, func(i, j int) bool { return l.Dependencies[i].Name < l.Dependencies[j].Name })
+	data, err := k8syaml.Marshal(l)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Source returns the locked source, or nil if the source is not locked. The sources are matched by the
+// normalized source and ref, e.g., with or without the credentials.
+func (l *Lock) Source(src string) *LockedSource {
+	key := sourceKey(src)
+	for i := range l.Sources {
+		if sourceKey(l.Sources[i].Source) == key {
+			return &l.Sources[i]
+		}
+	}
+	return nil
+}
+
+// AddSource locks the source, and the credentials of the source are not written.
+func (l *Lock) AddSource(locked LockedSource) {
+	locked.Source = Redact(locked.Source)
+	if existing := l.Source(locked.Source); existing != nil {
+		*existing = locked
+		return
+	}
+	l.Sources = append(l.Sources, locked)
+}
+
+// AddDependency locks the dependency, and returns an error if the dependency is locked to another digest,
+// e.g., two KCLRuns depend on the different versions of a package.
+func (l *Lock) AddDependency(locked LockedDependency) error {
+	for _, dep := range l.Dependencies {
+		if dep.Name == locked.Name {
+			if dep.Digest != locked.Digest {
+				return fmt.Errorf("dependency %s is resolved to the different digests %s and %s", locked.Name, dep.Digest, locked.Digest)
+			}
+			return nil
+		}
+	}
+	l.Dependencies = append(l.Dependencies, locked)
+	return nil
+}
+
+// PinSource returns the source pinned to the locked commit for the Git sources, or the source itself
+// for the other sources. An error is returned if the source is not locked.
+func (l *Lock) PinSource(src string) (string, error) {
+	locked := l.Source(src)
+	if locked == nil {
+		return src, &LockDriftError{Drifts: []string{fmt.Sprintf("source %s is not locked", Redact(src))}}
+	}
+	if locked.Commit == "" {
+		return src, nil
+	}
+	base, query, _ := strings.Cut(src, "?")
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return src, err
+	}
+	values.Set("ref", locked.Commit)
+	return base + "?" + values.Encode(), nil
+}
+
+// VerifySource verifies the fetched content of the source against the lock.
+func (l *Lock) VerifySource(src, dir string) error {
+	locked := l.Source(src)
+	if locked == nil {
+		return &LockDriftError{Drifts: []string{fmt.Sprintf("source %s is not locked", Redact(src))}}
+	}
+	digest, err := DirDigest(dir)
+	if err != nil {
+		return err
+	}
+	if digest != locked.Digest {
+		return &LockDriftError{Drifts: []string{fmt.Sprintf("source %s: expect digest %s, but we got: %s", Redact(src), locked.Digest, digest)}}
+	}
+	return nil
+}
+
+// VerifyDependencies verifies the resolved dependencies, which are the package names and the local
+// paths, against the lock and returns all the drifts.
+func (l *Lock) VerifyDependencies(deps map[string]string) error {
+	names := make([]string, 0, len(deps))
+	for name := range deps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var drifts []string
+	for _, name := range names {
+		var locked *LockedDependency
+		for i := range l.Dependencies {
+			if l.Dependencies[i].Name == name {
+				locked = &l.Dependencies[i]
+			}
+		}
+		if locked == nil {
+			drifts = append(drifts, fmt.Sprintf("dependency %s is not locked", name))
+			continue
+		}
+		digest, err := DirDigest(deps[name])
+		if err != nil {
+			return err
+		}
+		if digest != locked.Digest {
+			drifts = append(drifts, fmt.Sprintf("dependency %s: expect digest %s, but we got: %s", name, locked.Digest, digest))
+		}
+	}
+	if len(drifts) > 0 {
+		return &LockDriftError{Drifts: drifts}
+	}
+	return nil
+}
+
+// DirDigest returns the SHA-256 digest of the directory content, which covers the relative paths and the
+// content of the files and the symbolic links, except the .git directories.
+func DirDigest(dir string) (string, error) {
+	h := sha256.New()
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s\x00", filepath.ToSlash(rel))
+		if d.Type()&fs.ModeSymlink != 0 {
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "link:%s\x00", filepath.ToSlash(link))
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if _, err := io.Copy(h, f); err != nil {
+			return err
+		}
+		h.Write([]byte{0})
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// IsRemote determines whether or not a source is to be treated as a remote source.
+func IsRemote(src string) bool {
+	return IsOCI(src) || IsRemoteUrl(src) || IsGit(src) || IsVCSDomain(src)
+}
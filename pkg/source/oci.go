@@ -1,8 +1,11 @@
 package source
 
 import (
+	"context"
 	"fmt"
 	"strings"
+
+	"github.com/hashicorp/go-getter"
 )
 
 const (
@@ -23,3 +26,25 @@ func TrimOCIPrefix(src string) string {
 func OCIPrefix(src string) string {
 	return fmt.Sprintf("%s://%s", OCIScheme, src)
 }
+
+// OCISource is the built-in source of the OCI artifacts.
+type OCISource struct{}
+
+// Detect implements Source.
+func (s *OCISource) Detect(src string) bool {
+	return IsOCI(src)
+}
+
+// Fetch implements Source. The artifacts are pulled before the run to be verified against the digests
+// and the signatures, and the other artifacts are used as is and pulled by the KCL runner together with
+// the dependencies.
+func (s *OCISource) Fetch(ctx context.Context, src string, o *FetchOptions, opts ...getter.ClientOption) (string, string, error) {
+	verify, err := o.VerifiesSignature()
+	if err != nil {
+		return src, "", err
+	}
+	if verify || IsOCIDigest(src) {
+		return FetchOCI(ctx, src, o)
+	}
+	return src, "", nil
+}
@@ -0,0 +1,322 @@
+package source
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2/content"
+	"oras.land/oras-go/v2/registry/remote"
+	"oras.land/oras-go/v2/registry/remote/auth"
+)
+
+const (
+	// dockerManifestMediaType is the media type of the Docker image manifests.
+	dockerManifestMediaType = "application/vnd.docker.distribution.manifest.v2+json"
+	// maxManifestSize is the max size of the manifests in bytes.
+	maxManifestSize = 4 << 20
+	// maxBlobSize is the max size of the OCI layers and the HTTP sources verified against the signatures in bytes.
+	maxBlobSize = 64 << 20
+	// maxExtractedSize is the max size of the content extracted from an OCI layer in bytes.
+	maxExtractedSize = 256 << 20
+)
+
+// digestRegexp matches the SHA-256 digests, e.g., sha256:...
+var digestRegexp = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// OCIRef is the reference of an OCI source, e.g., oci://ghcr.io/kcl-lang/set-annotation:0.1.0
+// or oci://ghcr.io/kcl-lang/set-annotation@sha256:...
+type OCIRef struct {
+	// Registry is the registry host, e.g., ghcr.io
+	Registry string
+	// Repository is the repository, e.g., kcl-lang/set-annotation
+	Repository string
+	// Tag is the tag, which is empty if it is not set.
+	Tag string
+	// Digest is the manifest digest, which is empty if it is not set.
+	Digest string
+}
+
+// ParseOCIRef parses the OCI source into the reference.
+func ParseOCIRef(src string) (*OCIRef, error) {
+	if !IsOCI(src) {
+		return nil, fmt.Errorf("invalid OCI source %s: expect the %s:// prefix", Redact(src), OCIScheme)
+	}
+	ref := &OCIRef{}
+	repo := TrimOCIPrefix(src)
+	if i := strings.Index(repo, "@"); i >= 0 {
+		repo, ref.Digest = repo[:i], repo[i+1:]
+		if !digestRegexp.MatchString(ref.Digest) {
+			return nil, fmt.Errorf("invalid OCI source %s: invalid digest %q, expect sha256:<64 hex characters>", Redact(src), ref.Digest)
+		}
+	}
+	// The colon after the last slash separates the tag, and the other colons are the port separators.
+	if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+		repo, ref.Tag = repo[:i], repo[i+1:]
+	}
+	ref.Registry, ref.Repository, _ = strings.Cut(repo, "/")
+	if ref.Registry == "" || ref.Repository == "" {
+		return nil, fmt.Errorf("invalid OCI source %s: expect oci://<registry>/<repository>", Redact(src))
+	}
+	return ref, nil
+}
+
+// IsOCIDigest determines whether or not the OCI source is pinned by the digest.
+func IsOCIDigest(src string) bool {
+	return IsOCI(src) && strings.Contains(src, "@")
+}
+
+// reference returns the digest, the tag or the default latest tag of the reference.
+func (r *OCIRef) reference() string {
+	switch {
+	case r.Digest != "":
+		return r.Digest
+	case r.Tag != "":
+		return r.Tag
+	default:
+		return "latest"
+	}
+}
+
+// String returns the OCI source of the reference.
+func (r *OCIRef) String() string {
+	s := OCIPrefix(r.Registry + "/" + r.Repository)
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// registryClient is the client of the OCI distribution API of a repository, which is the oras-go
+// repository authenticated with the credentials of the fetch options.
+type registryClient struct {
+	ref  *OCIRef
+	repo *remote.Repository
+}
+
+// CredentialsFunc returns the username and the password of the host, or the empty strings if
+// there are no credentials for the host.
+type CredentialsFunc func(host string) (string, string, error)
+
+func newRegistryClient(ref *OCIRef, o *FetchOptions) (*registryClient, error) {
+	repo, err := remote.NewRepository(ref.Registry + "/" + ref.Repository)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OCI source %s: %v", ref, err)
+	}
+	host, _, err := net.SplitHostPort(ref.Registry)
+	if err != nil {
+		host = ref.Registry
+	}
+	// The local registries are served over the plain HTTP like the Docker daemon does.
+	local := host == "localhost" || net.ParseIP(host).IsLoopback()
+	repo.PlainHTTP = o.PlainHTTP || local
+	repo.ManifestMediaTypes = []string{ocispec.MediaTypeImageManifest, dockerManifestMediaType}
+	repo.MaxMetadataBytes = maxManifestSize
+	client := &auth.Client{
+		Client: o.httpClient(),
+		Cache:  auth.NewCache(),
+	}
+	if o.Credentials != nil {
+		client.Credential = func(_ context.Context, hostport string) (auth.Credential, error) {
+			username, password, err := o.Credentials(hostport)
+			if err != nil {
+				return auth.EmptyCredential, err
+			}
+			return auth.Credential{Username: username, Password: password}, nil
+		}
+	}
+	repo.Client = client
+	return &registryClient{ref: ref, repo: repo}, nil
+}
+
+// manifest returns the manifest of the reference, e.g., a tag or a digest, and its digest. The digest
+// of the manifest is verified by the repository if the reference is a digest.
+func (c *registryClient) manifest(ctx context.Context, reference string) (*ocispec.Manifest, string, error) {
+	desc, rc, err := c.repo.FetchReference(ctx, reference)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rc.Close()
+	if desc.Size > maxManifestSize {
+		return nil, "", fmt.Errorf("the manifest of %s exceeds the max size %d bytes", c.ref.Repository, maxManifestSize)
+	}
+	data, err := content.ReadAll(io.LimitReader(rc, maxManifestSize), desc)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid manifest of %s: %v", c.ref.Repository, err)
+	}
+	manifest := &ocispec.Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, "", fmt.Errorf("invalid manifest of %s: %v", c.ref.Repository, err)
+	}
+	return manifest, desc.Digest.String(), nil
+}
+
+// blob returns the content of the blob, which is verified against its size and digest.
+func (c *registryClient) blob(ctx context.Context, desc ocispec.Descriptor) ([]byte, error) {
+	if desc.Size > maxBlobSize {
+		return nil, fmt.Errorf("the blob %s of %s exceeds the max size %d bytes", desc.Digest, c.ref.Repository, maxBlobSize)
+	}
+	rc, err := c.repo.Blobs().Fetch(ctx, desc)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := content.ReadAll(io.LimitReader(rc, desc.Size), desc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid blob %s of %s: %v", desc.Digest, c.ref.Repository, err)
+	}
+	return data, nil
+}
+
+// FetchOCI pulls the OCI source into a new temp directory, and returns the package directory and the
+// temp directory to be removed. The manifest digest is verified if the source is pinned by the digest,
+// and the signature is verified with the public key of the fetch options. The source is read through
+// the cache of the fetch options if any, and the signed content is cached by the verified digest.
+func FetchOCI(ctx context.Context, src string, o *FetchOptions) (string, string, error) {
+	if o == nil {
+		o = &FetchOptions{}
+	}
+	ref, err := ParseOCIRef(src)
+	if err != nil {
+		return src, "", err
+	}
+	sig, err := o.signature()
+	if err != nil {
+		return src, "", err
+	}
+	if sig == nil {
+		if o.Cache != nil {
+			return o.Cache.Fetch(src, func() (string, string, error) { return pullOCI(ctx, ref, o) })
+		}
+		return pullOCI(ctx, ref, o)
+	}
+	// The signature is always verified against the registry.
+	if o.Cache != nil && o.Cache.Offline {
+		return src, "", &SignatureError{Source: src, Err: fmt.Errorf("the signature can not be verified in the offline mode")}
+	}
+	client, err := newRegistryClient(ref, o)
+	if err != nil {
+		return src, "", err
+	}
+	manifest, digest, err := client.manifest(ctx, ref.reference())
+	if err != nil {
+		return src, "", err
+	}
+	if err := client.verifySignature(ctx, digest, sig); err != nil {
+		return src, "", &SignatureError{Source: src, Err: err}
+	}
+	if o.Cache != nil {
+		pinned := &OCIRef{Registry: ref.Registry, Repository: ref.Repository, Digest: digest}
+		return o.Cache.Fetch(pinned.String(), func() (string, string, error) {
+			return pullOCILayers(ctx, client, manifest)
+		})
+	}
+	return pullOCILayers(ctx, client, manifest)
+}
+
+// pullOCI pulls the OCI source without the signature verification.
+func pullOCI(ctx context.Context, ref *OCIRef, o *FetchOptions) (string, string, error) {
+	client, err := newRegistryClient(ref, o)
+	if err != nil {
+		return ref.String(), "", err
+	}
+	manifest, _, err := client.manifest(ctx, ref.reference())
+	if err != nil {
+		return ref.String(), "", err
+	}
+	return pullOCILayers(ctx, client, manifest)
+}
+
+// pullOCILayers pulls the layers of the manifest into a new temp directory. The tar layers are extracted,
+// and the other layers are written as the files named by their title annotations.
+func pullOCILayers(ctx context.Context, client *registryClient, manifest *ocispec.Manifest) (string, string, error) {
+	tmpDir, err := os.MkdirTemp("", "kcl-sandbox")
+	if err != nil {
+		return "", "", fmt.Errorf("error creating temp file: %v", err)
+	}
+	for _, layer := range manifest.Layers {
+		data, err := client.blob(ctx, layer)
+		if err != nil {
+			return tmpDir, tmpDir, err
+		}
+		switch title := layer.Annotations[ocispec.AnnotationTitle]; {
+		case strings.Contains(layer.MediaType, "tar"):
+			if err := extractTar(data, tmpDir); err != nil {
+				return tmpDir, tmpDir, fmt.Errorf("failed to extract the layer %s: %v", layer.Digest, err)
+			}
+		case title != "" && filepath.Base(title) == title:
+			if err := os.WriteFile(filepath.Join(tmpDir, title), data, 0644); err != nil {
+				return tmpDir, tmpDir, err
+			}
+		}
+	}
+	return tmpDir, tmpDir, nil
+}
+
+// extractTar extracts the tar or the gzipped tar archive into the directory, and the entries outside
+// the directory are rejected. The extracted content is limited to maxExtractedSize bytes.
+func extractTar(data []byte, dir string) error {
+	var r io.Reader = bytes.NewReader(data)
+	if len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	limited := &io.LimitedReader{R: r, N: maxExtractedSize}
+	tr := tar.NewReader(limited)
+	for {
+		header, err := tr.Next()
+		if limited.N <= 0 {
+			return fmt.Errorf("the extracted content exceeds the max size %d bytes", maxExtractedSize)
+		} else if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, filepath.FromSlash(header.Name))
+		if rel, err := filepath.Rel(dir, target); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("invalid entry %q outside the package", header.Name)
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return err
+			}
+			if limited.N <= 0 {
+				f.Close()
+				return fmt.Errorf("the extracted content exceeds the max size %d bytes", maxExtractedSize)
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package source
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/kyaml/errors"
+)
+
+// fakeRegistry is a registry stand-in which serves the manifests and the blobs of the OCI distribution API.
+type fakeRegistry struct {
+	*httptest.Server
+	manifests map[string][]byte
+	blobs     map[string][]byte
+	// token is the bearer token required by the registry if it is not empty.
+	token string
+}
+
+func newFakeRegistry(t *testing.T) *fakeRegistry {
+	r := &fakeRegistry{manifests: map[string][]byte{}, blobs: map[string][]byte{}}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/token" {
+			_ = json.NewEncoder(w).Encode(map[string]string{"token": r.token})
+			return
+		}
+		if r.token != "" && req.Header.Get("Authorization") != "Bearer "+r.token {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="fake"`, r.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		path := strings.TrimPrefix(req.URL.Path, "/v2/kcl-lang/fn/")
+		var data []byte
+		var ok bool
+		if ref, found := strings.CutPrefix(path, "manifests/"); found {
+			data, ok = r.manifests[ref]
+			w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+		} else if digest, found := strings.CutPrefix(path, "blobs/"); found {
+			data, ok = r.blobs[digest]
+		}
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+// src returns the OCI source of the reference, e.g., a tag or a digest.
+func (r *fakeRegistry) src(reference string) string {
+	host := strings.TrimPrefix(r.URL, "http://")
+	if strings.HasPrefix(reference, "sha256:") {
+		return OCIPrefix(host + "/kcl-lang/fn@" + reference)
+	}
+	return OCIPrefix(host + "/kcl-lang/fn:" + reference)
+}
+
+// push pushes the manifest of the layers with the tag and returns the manifest digest.
+func (r *fakeRegistry) push(t *testing.T, tag string, layers ...ocispec.Descriptor) string {
+	manifest, err := json.Marshal(ocispec.Manifest{MediaType: ocispec.MediaTypeImageManifest, Layers: layers})
+	assert.NoError(t, err)
+	digest := sha256Digest(manifest)
+	r.manifests[tag] = manifest
+	r.manifests[digest] = manifest
+	return digest
+}
+
+// layer adds the blob and returns its descriptor.
+func (r *fakeRegistry) layer(mediaType string, data []byte, annotations map[string]string) ocispec.Descriptor {
+	d := digest.FromBytes(data)
+	r.blobs[d.String()] = data
+	return ocispec.Descriptor{MediaType: mediaType, Digest: d, Size: int64(len(data)), Annotations: annotations}
+}
+
+// sign pushes the cosign signature of the manifest digest signed by the key.
+func (r *fakeRegistry) sign(t *testing.T, digest string, key *ecdsa.PrivateKey) {
+	payload := []byte(fmt.Sprintf(`{"critical":{"identity":{"docker-reference":"kcl-lang/fn"},"image":{"docker-manifest-digest":%q},"type":%q},"optional":null}`, digest, cosignSignatureType))
+	r.push(t, strings.Replace(digest, ":", "-", 1)+SignatureSuffix, r.layer("application/vnd.dev.cosign.simplesigning.v1+json", payload, map[string]string{
+		cosignSignatureAnnotation: sign(t, key, payload),
+	}))
+}
+
+func sign(t *testing.T, key *ecdsa.PrivateKey, payload []byte) string {
+	digest := sha256.Sum256(payload)
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	assert.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(signature)
+}
+
+func packageTar(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, content := range files {
+		assert.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func sha256Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func generateKey(t *testing.T) (*ecdsa.PrivateKey, crypto.PublicKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	assert.NoError(t, err)
+	pub, err := ParsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	assert.NoError(t, err)
+	return key, pub
+}
+
+func TestParseOCIRef(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	testcases := []struct {
+		src          string
+		expectRef    *OCIRef
+		expectErrMsg string
+	}{
+		{
+			src:       "oci://ghcr.io/kcl-lang/set-annotation",
+			expectRef: &OCIRef{Registry: "ghcr.io", Repository: "kcl-lang/set-annotation"},
+		},
+		{
+			src:       "oci://localhost:5001/kcl-lang/set-annotation:0.1.0",
+			expectRef: &OCIRef{Registry: "localhost:5001", Repository: "kcl-lang/set-annotation", Tag: "0.1.0"},
+		},
+		{
+			src:       "oci://ghcr.io/kcl-lang/set-annotation:0.1.0@" + digest,
+			expectRef: &OCIRef{Registry: "ghcr.io", Repository: "kcl-lang/set-annotation", Tag: "0.1.0", Digest: digest},
+		},
+		{
+			src:          "oci://ghcr.io/kcl-lang/set-annotation@sha256:abc",
+			expectErrMsg: "invalid OCI source oci://ghcr.io/kcl-lang/set-annotation@sha256:abc: invalid digest \"sha256:abc\", expect sha256:<64 hex characters>",
+		},
+		{
+			src:          "oci://ghcr.io",
+			expectErrMsg: "invalid OCI source oci://ghcr.io: expect oci://<registry>/<repository>",
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.src, func(t *testing.T) {
+			ref, err := ParseOCIRef(tc.src)
+			if tc.expectErrMsg != "" {
+				assert.EqualError(t, err, tc.expectErrMsg)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectRef, ref)
+				assert.Equal(t, tc.src, ref.String())
+			}
+		})
+	}
+}
+
+func TestFetchOCI(t *testing.T) {
+	registry := newFakeRegistry(t)
+	registry.token = "token"
+	digest := registry.push(t, "0.1.0", registry.layer("application/vnd.oci.image.layer.v1.tar", packageTar(t, map[string]string{
+		"kcl.mod": "[package]\nname = \"fn\"\n",
+		"main.k":  "a = 1",
+	}), nil))
+	key, pub := generateKey(t)
+	otherKey, _ := generateKey(t)
+
+	// The tags and the digests are pulled.
+	for _, src := range []string{registry.src("0.1.0"), registry.src(digest)} {
+		dir, tmpDir, err := FetchOCI(context.Background(), src, nil)
+		assert.NoError(t, err)
+		data, err := os.ReadFile(filepath.Join(dir, "main.k"))
+		assert.NoError(t, err)
+		assert.Equal(t, "a = 1", string(data))
+		assert.NoError(t, os.RemoveAll(tmpDir))
+	}
+
+	// The digest of the manifest is verified.
+	wrong := "sha256:" + strings.Repeat("0", 64)
+	registry.manifests[wrong] = registry.manifests["0.1.0"]
+	_, _, err := FetchOCI(context.Background(), registry.src(wrong), nil)
+	assert.ErrorContains(t, err, "digest mismatch")
+
+	// The unsigned sources are rejected when the public key is set.
+	_, _, err = FetchOCI(context.Background(), registry.src("0.1.0"), &FetchOptions{PublicKey: pub})
+	var sigErr *SignatureError
+	assert.True(t, errors.As(err, &sigErr))
+	assert.Contains(t, err.Error(), "signature verification failed for "+registry.src("0.1.0")+": the signature is missing")
+
+	// The signatures of the other keys are rejected.
+	registry.sign(t, digest, otherKey)
+	_, _, err = FetchOCI(context.Background(), registry.src("0.1.0"), &FetchOptions{PublicKey: pub})
+	assert.EqualError(t, err, "signature verification failed for "+registry.src("0.1.0")+": the signature does not match the public key")
+
+	registry.sign(t, digest, key)
+	dir, tmpDir, err := FetchOCI(context.Background(), registry.src("0.1.0"), &FetchOptions{PublicKey: pub, RequireSignature: true})
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(dir, "main.k"))
+	assert.NoError(t, os.RemoveAll(tmpDir))
+
+	// The public key is required when the signatures are required.
+	t.Setenv(PublicKeyEnvVar, "")
+	_, _, err = FetchOCI(context.Background(), registry.src("0.1.0"), &FetchOptions{RequireSignature: true})
+	assert.EqualError(t, err, "the signature is required but no public key is configured, set the KCL_PUBLIC_KEY environment variable")
+}
+
+func TestVerifyBlob(t *testing.T) {
+	key, pub := generateKey(t)
+	code := []byte("a = 1")
+	signature := sign(t, key, code)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/main.k", "/unsigned.k":
+			_, _ = w.Write(code)
+		case "/main.k" + SignatureSuffix:
+			_, _ = w.Write([]byte(signature))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	digest, err := VerifyBlob(context.Background(), server.URL+"/main.k", &SignatureOptions{PublicKey: pub})
+	assert.NoError(t, err)
+	assert.Equal(t, sha256Digest(code), digest)
+
+	_, err = VerifyBlob(context.Background(), server.URL+"/main.k?checksum=sha256:"+strings.Repeat("0", 64), &SignatureOptions{PublicKey: pub})
+	assert.EqualError(t, err, "signature verification failed for "+server.URL+"/main.k?checksum=sha256:"+strings.Repeat("0", 64)+": the source does not match the checksum sha256:"+strings.Repeat("0", 64))
+
+	_, err = VerifyBlob(context.Background(), server.URL+"/unsigned.k", &SignatureOptions{PublicKey: pub})
+	assert.EqualError(t, err, "signature verification failed for "+server.URL+"/unsigned.k: the signature is missing: bad response code: 404")
+
+	// The verified sources are fetched with the verified checksum.
+	src, tmpDir, err := ReadThroughGetterWithContext(context.Background(), server.URL+"/main.k", &FetchOptions{PublicKey: pub})
+	defer os.RemoveAll(tmpDir)
+	assert.NoError(t, err)
+	data, err := os.ReadFile(filepath.Join(src, "main.k"))
+	assert.NoError(t, err)
+	assert.Equal(t, code, data)
+
+	// The Git sources can not be signed.
+	_, _, err = ReadThroughGetterWithContext(context.Background(), "git::https://github.com/kcl-lang/krm-kcl", &FetchOptions{PublicKey: pub, RequireSignature: true})
+	assert.EqualError(t, err, "signature verification failed for git::https://github.com/kcl-lang/krm-kcl: the source type does not support signatures")
+}
+
+func TestDownload(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("a = 1"))
+	}))
+	defer server.Close()
+
+	// The TLS verification is skipped by the client of the insecure fetch options.
+	_, err := download(context.Background(), (&FetchOptions{}).httpClient(), server.URL, maxBlobSize)
+	assert.Error(t, err)
+	data, err := download(context.Background(), (&FetchOptions{Insecure: true}).httpClient(), server.URL, maxBlobSize)
+	assert.NoError(t, err)
+	assert.Equal(t, "a = 1", string(data))
+
+	// The content is limited to the max size.
+	_, err = download(context.Background(), server.Client(), server.URL, 4)
+	assert.EqualError(t, err, "the content exceeds the max size 4 bytes")
+}
+
+func TestFetchOCIBlobSizeLimit(t *testing.T) {
+	registry := newFakeRegistry(t)
+	layer := registry.layer(ocispec.MediaTypeImageLayer, packageTar(t, map[string]string{"main.k": "a = 1"}), nil)
+	// The layer size in the manifest is not trusted.
+	layer.Size = maxBlobSize + 1
+	registry.push(t, "0.1.0", layer)
+	_, tmpDir, err := FetchOCI(context.Background(), registry.src("0.1.0"), nil)
+	defer os.RemoveAll(tmpDir)
+	assert.ErrorContains(t, err, fmt.Sprintf("exceeds the max size %d bytes", maxBlobSize))
+}
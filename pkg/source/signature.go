@@ -0,0 +1,248 @@
+package source
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	// PublicKeyEnvVar is the environment variable of the public key file which verifies the source signatures.
+	PublicKeyEnvVar = "KCL_PUBLIC_KEY"
+	// SignatureSuffix is the suffix of the signature files of the HTTP sources, e.g., main.k.sig
+	SignatureSuffix = ".sig"
+	// cosignSignatureAnnotation is the annotation of the cosign signatures on the signature layers.
+	cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+	// cosignSignatureType is the type of the cosign simple signing payloads.
+	cosignSignatureType = "cosign container image signature"
+	// maxSignatureSize is the max size of the signature files in bytes.
+	maxSignatureSize = 64 << 10
+)
+
+// SignatureOptions verify the signatures of the sources.
+type SignatureOptions struct {
+	// PublicKey is the public key which verifies the signatures, e.g., the cosign.pub of `cosign generate-key-pair`.
+	PublicKey crypto.PublicKey
+	// HTTPClient downloads the HTTP sources and their signatures, and defaults to the http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// SignatureError is returned when the signature of a source is missing or does not match the public key.
+type SignatureError struct {
+	// Source is the source without the credentials.
+	Source string
+	// Err is the reason of the failure.
+	Err error
+}
+
+func (e *SignatureError) Error() string {
+	return fmt.Sprintf("signature verification failed for %s: %v", Redact(e.Source), e.Err)
+}
+
+func (e *SignatureError) Unwrap() error {
+	return e.Err
+}
+
+// LoadPublicKey reads the PEM encoded public key file, e.g., the cosign.pub file.
+func LoadPublicKey(path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePublicKey(data)
+}
+
+// ParsePublicKey parses the PEM encoded ECDSA, Ed25519 or RSA public key.
+func ParsePublicKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("invalid public key: expect a PEM encoded public key")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %v", err)
+	}
+	switch key.(type) {
+	case *ecdsa.PublicKey, ed25519.PublicKey, *rsa.PublicKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("invalid public key: unsupported key type %T", key)
+	}
+}
+
+// DefaultPublicKey reads the public key file of the KCL_PUBLIC_KEY environment variable, and returns nil
+// if it is not set.
+func DefaultPublicKey() (crypto.PublicKey, error) {
+	path := os.Getenv(PublicKeyEnvVar)
+	if path == "" {
+		return nil, nil
+	}
+	return LoadPublicKey(path)
+}
+
+// verifySignature verifies the signature of the payload in the cosign format, which is the ECDSA ASN.1,
+// the RSA PKCS #1 v1.5 signature of the SHA-256 digest, or the Ed25519 signature of the payload.
+func verifySignature(key crypto.PublicKey, payload, signature []byte) error {
+	digest := sha256.Sum256(payload)
+	var ok bool
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		ok = ecdsa.VerifyASN1(k, digest[:], signature)
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(k, payload, signature)
+	case *rsa.PublicKey:
+		ok = rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], signature) == nil
+	default:
+		return fmt.Errorf("unsupported key type %T", key)
+	}
+	if !ok {
+		return fmt.Errorf("the signature does not match the public key")
+	}
+	return nil
+}
+
+// cosignPayload is the cosign simple signing payload of the OCI signatures.
+type cosignPayload struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+}
+
+// verifySignature verifies the cosign signatures of the manifest digest, which are stored in the
+// sha256-<hex>.sig tag of the repository. One of the signatures must match the public key.
+func (c *registryClient) verifySignature(ctx context.Context, digest string, sig *SignatureOptions) error {
+	tag := strings.Replace(digest, ":", "-", 1) + SignatureSuffix
+	manifest, _, err := c.manifest(ctx, tag)
+	if err != nil {
+		return fmt.Errorf("the signature is missing: %v", err)
+	}
+	var errs []string
+	for _, layer := range manifest.Layers {
+		encoded, ok := layer.Annotations[cosignSignatureAnnotation]
+		if !ok {
+			continue
+		}
+		signature, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("invalid signature encoding: %v", err))
+			continue
+		}
+		payload, err := c.blob(ctx, layer)
+		if err != nil {
+			return err
+		}
+		if err := verifySignature(sig.PublicKey, payload, signature); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		var p cosignPayload
+		if err := json.Unmarshal(payload, &p); err != nil || p.Critical.Type != cosignSignatureType {
+			errs = append(errs, "invalid signature payload")
+			continue
+		}
+		if p.Critical.Image.DockerManifestDigest != digest {
+			errs = append(errs, fmt.Sprintf("the signature is for the digest %s", p.Critical.Image.DockerManifestDigest))
+			continue
+		}
+		return nil
+	}
+	if len(errs) == 0 {
+		return fmt.Errorf("the signature is missing")
+	}
+	return fmt.Errorf("%s", strings.Join(errs, ", "))
+}
+
+// VerifyBlob downloads the HTTP source and its signature, which is the base64 encoded signature of
+// `cosign sign-blob` at the source URL with the .sig suffix, e.g., https://example.com/main.k.sig,
+// and returns the SHA-256 digest of the verified source, e.g., sha256:...
+func VerifyBlob(ctx context.Context, src string, sig *SignatureOptions) (string, error) {
+	u, err := url.Parse(src)
+	if err != nil {
+		return "", err
+	}
+	// The go-getter parameters are not the part of the source URL.
+	query := u.Query()
+	checksum := query.Get("checksum")
+	for _, k := range []string{"checksum", "archive", "filename"} {
+		query.Del(k)
+	}
+	u.RawQuery = query.Encode()
+	blob, err := download(ctx, sig.HTTPClient, u.String(), maxBlobSize)
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256(blob)
+	if checksum != "" && !strings.EqualFold(checksum, "sha256:"+hex.EncodeToString(digest[:])) {
+		return "", &SignatureError{Source: src, Err: fmt.Errorf("the source does not match the checksum %s", checksum)}
+	}
+	sigURL := *u
+	sigURL.Path += SignatureSuffix
+	encoded, err := download(ctx, sig.HTTPClient, sigURL.String(), maxSignatureSize)
+	if err != nil {
+		return "", &SignatureError{Source: src, Err: fmt.Errorf("the signature is missing: %v", err)}
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return "", &SignatureError{Source: src, Err: fmt.Errorf("invalid signature encoding: %v", err)}
+	}
+	if err := verifySignature(sig.PublicKey, blob, signature); err != nil {
+		return "", &SignatureError{Source: src, Err: err}
+	}
+	return "sha256:" + hex.EncodeToString(digest[:]), nil
+}
+
+// WithChecksum returns the HTTP source with the go-getter checksum parameter, e.g., ?checksum=sha256:...
+// which makes the getter verify the downloaded source.
+func WithChecksum(src, checksum string) string {
+	base, query, _ := strings.Cut(src, "?")
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return src
+	}
+	values.Set("checksum", checksum)
+	return base + "?" + values.Encode()
+}
+
+// download downloads the URL with the client, and returns an error if the content exceeds the max bytes.
+func download(ctx context.Context, client *http.Client, u string, max int64) ([]byte, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, RedactError(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bad response code: %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > max {
+		return nil, fmt.Errorf("the content exceeds the max size %d bytes", max)
+	}
+	return data, nil
+}
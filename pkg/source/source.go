@@ -0,0 +1,133 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/go-getter"
+)
+
+const (
+	// LocalSourceName is the name of the built-in local source.
+	LocalSourceName = "local"
+	// HttpSourceName is the name of the built-in HTTP source.
+	HttpSourceName = "http"
+	// GitSourceName is the name of the built-in Git source.
+	GitSourceName = "git"
+	// OCISourceName is the name of the built-in OCI source.
+	OCISourceName = "oci"
+)
+
+// Source is a kind of the KCL sources, e.g., the Git repositories or the OCI artifacts, which detects
+// the source strings of the kind and fetches them.
+type Source interface {
+	// Detect determines whether or not the source string is of the kind, e.g., it has the scheme of the kind.
+	Detect(src string) bool
+	// Fetch fetches the source with the context and the fetch options, and returns the local path of the
+	// fetched file or directory and the temp directory to be removed by the caller, which is empty if
+	// nothing needs to be removed.
+	Fetch(ctx context.Context, src string, o *FetchOptions, opts ...getter.ClientOption) (string, string, error)
+}
+
+// Registry is the set of the named sources, which detects the kind of a source string and fetches it,
+// and the embedders can register their own sources, e.g., an in-house artifact store.
+type Registry struct {
+	mu sync.RWMutex
+	// names are the source names in the registration order.
+	names   []string
+	sources map[string]Source
+}
+
+// DefaultRegistry is the registry with the built-in sources, which is used when the fetch options
+// have no registry.
+var DefaultRegistry = NewDefaultRegistry()
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{sources: map[string]Source{}}
+}
+
+// NewDefaultRegistry returns a registry with the built-in sources, which are detected in the order of
+// the OCI, local, HTTP and Git sources, the same precedence as the sources were always resolved.
+func NewDefaultRegistry() *Registry {
+	r := NewRegistry()
+	// The sources registered later are detected first.
+	_ = r.Register(GitSourceName, &GitSource{})
+	_ = r.Register(HttpSourceName, &HttpSource{})
+	_ = r.Register(LocalSourceName, &LocalSource{})
+	_ = r.Register(OCISourceName, &OCISource{})
+	return r
+}
+
+// Register registers the source with the name, and replaces the source registered with the same name.
+// The sources registered later are detected first, so they take precedence over the built-in sources.
+func (r *Registry) Register(name string, s Source) error {
+	if name == "" {
+		return fmt.Errorf("the source name must not be empty")
+	}
+	if s == nil {
+		return fmt.Errorf("source %s must not be nil", name)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.unregister(name)
+	r.names = append(r.names, name)
+	r.sources[name] = s
+	return nil
+}
+
+// Unregister removes the source with the name, and does nothing if it is not registered.
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.unregister(name)
+}
+
+func (r *Registry) unregister(name string) {
+	if _, ok := r.sources[name]; !ok {
+		return
+	}
+	delete(r.sources, name)
+	for i, n := range r.names {
+		if n == name {
+			r.names = append(r.names[:i:i], r.names[i+1:]...)
+			break
+		}
+	}
+}
+
+// Detect returns the name and the source which detects the source string, or false if no source
+// detects it, e.g., the inline code.
+func (r *Registry) Detect(src string) (string, Source, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for i := len(r.names) - 1; i >= 0; i-- {
+		name := r.names[i]
+		if s := r.sources[name]; s.Detect(src) {
+			return name, s, true
+		}
+	}
+	return "", nil, false
+}
+
+// Names returns the names of the registered sources in the detection order.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.names))
+	for i := len(r.names) - 1; i >= 0; i-- {
+		names = append(names, r.names[i])
+	}
+	return names
+}
+
+// Register registers the source with the name into the DefaultRegistry.
+func Register(name string, s Source) error {
+	return DefaultRegistry.Register(name, s)
+}
+
+// Detect returns the name and the source of the DefaultRegistry which detects the source string.
+func Detect(src string) (string, Source, bool) {
+	return DefaultRegistry.Detect(src)
+}
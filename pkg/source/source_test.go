@@ -0,0 +1,111 @@
+package source
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-getter"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSource is the source of the fake:// scheme, which writes the source path as the KCL code.
+type fakeSource struct {
+	fetched []string
+}
+
+func (s *fakeSource) Detect(src string) bool {
+	return strings.HasPrefix(src, "fake://")
+}
+
+func (s *fakeSource) Fetch(ctx context.Context, src string, o *FetchOptions, opts ...getter.ClientOption) (string, string, error) {
+	s.fetched = append(s.fetched, src)
+	tmpDir, err := os.MkdirTemp("", "kcl-sandbox")
+	if err != nil {
+		return src, "", err
+	}
+	file := filepath.Join(tmpDir, "main.k")
+	return file, tmpDir, os.WriteFile(file, []byte(strings.TrimPrefix(src, "fake://")), 0644)
+}
+
+func TestRegistryDetect(t *testing.T) {
+	r := NewDefaultRegistry()
+	fake := &fakeSource{}
+	assert.NoError(t, r.Register("fake", fake))
+	testcases := []struct {
+		src        string
+		expectName string
+	}{
+		{src: "./main.k", expectName: LocalSourceName},
+		{src: "/tmp/main.k", expectName: LocalSourceName},
+		{src: "https://example.com/main.k", expectName: HttpSourceName},
+		{src: "git::https://github.com/kcl-lang/krm-kcl", expectName: GitSourceName},
+		{src: "github.com/kcl-lang/krm-kcl/examples/mutation/set-labels", expectName: GitSourceName},
+		{src: "oci://ghcr.io/kcl-lang/set-annotation", expectName: OCISourceName},
+		{src: "fake://a = 1", expectName: "fake"},
+		{src: "a = 1"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.src, func(t *testing.T) {
+			name, s, ok := r.Detect(tc.src)
+			assert.Equal(t, tc.expectName, name)
+			assert.Equal(t, tc.expectName != "", ok)
+			assert.Equal(t, ok, s != nil)
+		})
+	}
+	assert.Equal(t, []string{"fake", OCISourceName, LocalSourceName, HttpSourceName, GitSourceName}, r.Names())
+}
+
+func TestDefaultRegistryPrecedence(t *testing.T) {
+	// The built-in sources keep the precedence of the OCI, local, HTTP and Git sources.
+	assert.Equal(t, []string{OCISourceName, LocalSourceName, HttpSourceName, GitSourceName}, NewDefaultRegistry().Names())
+}
+
+func TestRegistryRegister(t *testing.T) {
+	r := NewRegistry()
+	assert.EqualError(t, r.Register("", &fakeSource{}), "the source name must not be empty")
+	assert.EqualError(t, r.Register("fake", nil), "source fake must not be nil")
+
+	// The sources registered later take precedence over the built-in sources.
+	assert.NoError(t, r.Register(HttpSourceName, &HttpSource{}))
+	override := &fakeSource{}
+	assert.NoError(t, r.Register("fake", override))
+	_, s, ok := r.Detect("fake://a = 1")
+	assert.True(t, ok)
+	assert.Same(t, override, s)
+
+	// The source with the same name is replaced.
+	replaced := &fakeSource{}
+	assert.NoError(t, r.Register("fake", replaced))
+	_, s, _ = r.Detect("fake://a = 1")
+	assert.Same(t, replaced, s)
+	assert.Equal(t, []string{"fake", HttpSourceName}, r.Names())
+
+	r.Unregister("fake")
+	_, _, ok = r.Detect("fake://a = 1")
+	assert.False(t, ok)
+	assert.Equal(t, []string{HttpSourceName}, r.Names())
+}
+
+func TestFetchOptionsSources(t *testing.T) {
+	var o *FetchOptions
+	assert.Same(t, DefaultRegistry, o.Sources())
+	r := NewRegistry()
+	o = &FetchOptions{Registry: r}
+	assert.Same(t, r, o.Sources())
+}
+
+func TestBuiltinSourceFetch(t *testing.T) {
+	r := NewDefaultRegistry()
+	// The local sources and the OCI sources which are not pinned are used as is.
+	for _, src := range []string{"./main.k", "oci://ghcr.io/kcl-lang/set-annotation:0.1.1"} {
+		_, s, ok := r.Detect(src)
+		assert.True(t, ok)
+		dir, tmpDir, err := s.Fetch(context.Background(), src, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, src, dir)
+		assert.Empty(t, tmpDir)
+	}
+}
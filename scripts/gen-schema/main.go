@@ -0,0 +1,50 @@
+// gen-schema generates the OpenAPI v3 schema and the CRD manifest of the KCLRun resource.
+//
+// Usage: go run ./scripts/gen-schema [output dir]
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"kcl-lang.io/krm-kcl/pkg/config"
+)
+
+func main() {
+	dir := "config"
+	if len(os.Args) > 1 {
+		dir = os.Args[1]
+	}
+	if err := generate(dir); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+func generate(dir string) error {
+	files := map[string][]byte{}
+	for _, apiVersion := range config.KCLRunAPIVersions {
+		schema, err := json.MarshalIndent(config.OpenAPISchemaFor(apiVersion), "", "  ")
+		if err != nil {
+			return err
+		}
+		files[config.OpenAPISchemaFile(apiVersion)] = append(schema, '\n')
+	}
+	crd, err := config.CustomResourceDefinition()
+	if err != nil {
+		return err
+	}
+	files[config.CRDFile] = crd
+	for file, data := range files {
+		path := filepath.Join(dir, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}